@@ -5,6 +5,7 @@
 package pebble
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -12,6 +13,7 @@ import (
 	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/cockroachdb/errors"
@@ -21,6 +23,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/private"
 	"github.com/cockroachdb/pebble/internal/rangedel"
 	"github.com/cockroachdb/pebble/internal/rawalloc"
+	"github.com/golang/snappy"
 )
 
 const (
@@ -224,9 +227,49 @@ type Batch struct {
 	// memtable.
 	flushable *flushableBatch
 
+	// disableWAL is true if the batch is not written to the WAL. See
+	// WriteOptions.DisableWAL.
+	disableWAL bool
+
+	// walData is the Snappy encoding of data which is written to the WAL in
+	// place of data when Options.Experimental.WALCompression is enabled and
+	// compression makes the batch smaller. It is empty otherwise. The batch
+	// header is stored uncompressed at walHeaderOffset so that the sequence
+	// number can be set after the batch is compressed. See compressWAL.
+	walData         []byte
+	walHeaderOffset int
+
 	commit    sync.WaitGroup
 	commitErr error
 	applied   uint32 // updated atomically
+
+	// commitStats are the stats of committing the batch. See CommitStats.
+	commitStats BatchCommitStats
+}
+
+// BatchCommitStats are the stats of committing a batch, which can be used to
+// diagnose the causes of high commit latency.
+type BatchCommitStats struct {
+	// TotalDuration is the time spent committing the batch in DB.Apply or
+	// Batch.Commit. The other durations are disjoint parts of it.
+	TotalDuration time.Duration
+	// QueueDuration is the time spent waiting to enter the commit pipeline,
+	// which bounds the number of concurrent commits and serializes writes to
+	// the WAL.
+	QueueDuration time.Duration
+	// WALWriteDuration is the time spent writing the batch to the WAL. It does
+	// not include waiting for the WAL to be synced.
+	WALWriteDuration time.Duration
+	// WriteStallDuration is the time spent waiting for flushes and
+	// compactions because the memtable or L0 limits on writes were reached.
+	WriteStallDuration time.Duration
+	// MemTableApplyDuration is the time spent applying the batch to the
+	// memtable.
+	MemTableApplyDuration time.Duration
+	// CommitWaitDuration is the time spent waiting for the WAL to be synced,
+	// if requested, and for earlier batches to be applied so that the batch
+	// can be made visible.
+	CommitWaitDuration time.Duration
 }
 
 var _ Reader = (*Batch)(nil)
@@ -378,7 +421,7 @@ func (b *Batch) Get(key []byte) ([]byte, io.Closer, error) {
 	if b.index == nil {
 		return nil, nil, ErrNotIndexed
 	}
-	return b.db.getInternal(key, b, nil /* snapshot */)
+	return b.db.getInternal(context.Background(), key, b, nil /* snapshot */)
 }
 
 func (b *Batch) prepareDeferredKeyValueRecord(keyLen, valueLen int, kind InternalKeyKind) {
@@ -732,6 +775,12 @@ func (b *Batch) Commit(o *WriteOptions) error {
 	return b.db.Apply(b, o)
 }
 
+// CommitStats returns the stats of committing the batch. The stats are zero if
+// the batch has not been committed.
+func (b *Batch) CommitStats() BatchCommitStats {
+	return b.commitStats
+}
+
 // Close closes the batch without committing it.
 func (b *Batch) Close() error {
 	b.release()
@@ -767,8 +816,15 @@ func (b *Batch) Reset() {
 	b.deferredOp = DeferredBatchOp{}
 	b.tombstones = nil
 	b.flushable = nil
+	b.disableWAL = false
+	if cap(b.walData) > batchMaxRetainedSize {
+		b.walData = nil
+	} else {
+		b.walData = b.walData[:0]
+	}
 	b.commit = sync.WaitGroup{}
 	b.commitErr = nil
+	b.commitStats = BatchCommitStats{}
 	atomic.StoreUint32(&b.applied, 0)
 	if b.data != nil {
 		if cap(b.data) > batchMaxRetainedSize {
@@ -781,6 +837,7 @@ func (b *Batch) Reset() {
 			// Otherwise, reset the buffer for re-use.
 			b.data = b.data[:batchHeaderLen]
 			b.setSeqNum(0)
+			binary.LittleEndian.PutUint32(b.countData(), 0)
 		}
 	}
 	if b.index != nil {
@@ -789,6 +846,53 @@ func (b *Batch) Reset() {
 	}
 }
 
+// compressWAL sets walData to the Snappy encoding of the batch's data if that
+// is smaller than the data. Compression is performed before the batch enters
+// the commit pipeline, which serializes writes to the WAL, and thus before the
+// batch is assigned a sequence number. The encoding stores the header as a
+// literal followed by the encoding of the rest of the data, so that the header
+// can later be updated in place by walRecord. Snappy copy offsets are relative
+// to the current position, so the encoding of the rest of the data remains
+// valid following the literal.
+func (b *Batch) compressWAL() {
+	b.walData = b.walData[:0]
+	repr := b.Repr()
+	body := repr[batchHeaderLen:]
+	maxLen := snappy.MaxEncodedLen(len(body))
+	if maxLen < 0 {
+		return
+	}
+	n := binary.MaxVarintLen64 + 1 + batchHeaderLen + maxLen
+	if cap(b.walData) < n {
+		b.walData = make([]byte, 0, n)
+	}
+	buf := b.walData[:n]
+	i := binary.PutUvarint(buf, uint64(len(repr)))
+	// Snappy literal tag for a literal of batchHeaderLen bytes.
+	buf[i] = (batchHeaderLen - 1) << 2
+	b.walHeaderOffset = i + 1
+	i = b.walHeaderOffset + copy(buf[b.walHeaderOffset:], repr[:batchHeaderLen])
+	// Append the encoding of the body without its length prefix. The copy
+	// handles the overlap between the encoding and its destination.
+	enc := snappy.Encode(buf[i:], body)
+	_, m := binary.Uvarint(enc)
+	i += copy(buf[i:], enc[m:])
+	if i < len(repr) {
+		b.walData = buf[:i]
+	}
+}
+
+// walRecord returns the record to write to the WAL for the batch, and whether
+// the record is compressed.
+func (b *Batch) walRecord() (_ []byte, compressed bool) {
+	repr := b.Repr()
+	if len(b.walData) == 0 {
+		return repr, false
+	}
+	copy(b.walData[b.walHeaderOffset:], repr[:batchHeaderLen])
+	return b.walData, true
+}
+
 // seqNumData returns the 8 byte little-endian sequence number. Zero means that
 // the batch has not yet been applied.
 func (b *Batch) seqNumData() []byte {
@@ -845,6 +949,23 @@ func (b *Batch) Count() uint32 {
 	return uint32(b.count)
 }
 
+// Len returns the current size of the batch representation in bytes. It can be
+// used to bound the size of batches, such as when chunking a bulk write.
+func (b *Batch) Len() int {
+	if len(b.data) == 0 {
+		return batchHeaderLen
+	}
+	return len(b.data)
+}
+
+// MemTableSize returns an upper bound on the memtable space required to apply
+// the batch, which exceeds Len due to the overhead of the memtable skiplist
+// nodes. It is not computed for a batch whose representation was set with
+// SetRepr, unless the batch was created by a DB.
+func (b *Batch) MemTableSize() uint64 {
+	return b.memTableSize
+}
+
 // Reader returns a BatchReader for the current batch contents. If the batch is
 // mutated, the new entries will not be visible to the reader.
 func (b *Batch) Reader() BatchReader {
@@ -12,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
@@ -193,6 +194,49 @@ func TestBatchEmpty(t *testing.T) {
 	require.NoError(t, iter2.Close())
 }
 
+func TestBatchLen(t *testing.T) {
+	var b Batch
+	require.Equal(t, batchHeaderLen, b.Len())
+	require.Equal(t, uint64(0), b.MemTableSize())
+
+	require.NoError(t, b.Set([]byte("a"), []byte("b"), nil))
+	require.Equal(t, batchHeaderLen+5, b.Len())
+	require.Equal(t, len(b.Repr()), b.Len())
+	require.Equal(t, memTableEntrySize(1, 1), b.MemTableSize())
+
+	require.NoError(t, b.DeleteRange([]byte("c"), []byte("dd"), nil))
+	require.Equal(t, batchHeaderLen+11, b.Len())
+	require.Equal(t, memTableEntrySize(1, 1)+memTableEntrySize(1, 2), b.MemTableSize())
+
+	b.Reset()
+	require.Equal(t, batchHeaderLen, b.Len())
+	require.Equal(t, uint64(0), b.MemTableSize())
+}
+
+func TestBatchCommitStats(t *testing.T) {
+	d, err := Open("", &Options{
+		FS: vfs.NewMem(),
+	})
+	require.NoError(t, err)
+	defer d.Close()
+
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("a"), []byte("b"), nil))
+	require.Equal(t, BatchCommitStats{}, b.CommitStats())
+	require.NoError(t, b.Commit(Sync))
+
+	stats := b.CommitStats()
+	require.Less(t, int64(0), int64(stats.TotalDuration))
+	require.LessOrEqual(t, int64(stats.QueueDuration+stats.WALWriteDuration+
+		stats.WriteStallDuration+stats.MemTableApplyDuration+stats.CommitWaitDuration),
+		int64(stats.TotalDuration))
+	require.Equal(t, time.Duration(0), stats.WriteStallDuration)
+
+	b.Reset()
+	require.Equal(t, BatchCommitStats{}, b.CommitStats())
+	require.NoError(t, b.Close())
+}
+
 func TestBatchReset(t *testing.T) {
 	db, err := Open("", &Options{
 		FS: vfs.NewMem(),
@@ -218,6 +262,9 @@ func TestBatchReset(t *testing.T) {
 	require.True(t, b.SeqNum() > 0)
 	require.True(t, b.memTableSize > 0)
 	require.NotEqual(t, b.deferredOp, DeferredBatchOp{})
+	// Repr writes the count to the batch header, which Reset must clear so
+	// that the repr of the reset batch is that of an empty batch.
+	require.Equal(t, uint32(2), binary.LittleEndian.Uint32(b.Repr()[8:12]))
 
 	b.Reset()
 	require.Equal(t, db, b.db)
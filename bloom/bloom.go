@@ -53,6 +53,11 @@ func (f tableFilter) MayContain(key []byte) bool {
 	}
 	n := len(f) - 5
 	nProbes := f[n]
+	if nProbes > 127 {
+		// This is reserved for newer filter implementations, such as the one
+		// used by RocksDB format version 5. Consider it a match.
+		return true
+	}
 	nLines := binary.LittleEndian.Uint32(f[n+1:])
 	cacheLineBits := 8 * (uint32(n) / nLines)
 
@@ -143,6 +143,17 @@ loop:
 	}
 }
 
+func TestNewFilterFormat(t *testing.T) {
+	// RocksDB format version 5 marks filters which use a newer implementation
+	// with -1 in place of the number of probes. Such filters must match every
+	// key.
+	f := make(tableFilter, cacheLineSize+5)
+	f[cacheLineSize] = 0xff
+	for _, key := range []string{"a", "b", "hello", "world"} {
+		require.True(t, f.MayContain([]byte(key)), key)
+	}
+}
+
 func TestHash(t *testing.T) {
 	testCases := []struct {
 		s        string
@@ -8,6 +8,7 @@ import (
 	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/cockroachdb/pebble/internal/record"
@@ -242,7 +243,9 @@ func (p *commitPipeline) Commit(b *Batch, syncWAL bool) error {
 		return nil
 	}
 
+	start := time.Now()
 	p.sem <- struct{}{}
+	b.commitStats.QueueDuration = time.Since(start)
 
 	// Prepare the batch for committing: enqueuing the batch in the pending
 	// queue, determining the batch sequence number and writing the data to the
@@ -257,13 +260,18 @@ func (p *commitPipeline) Commit(b *Batch, syncWAL bool) error {
 	}
 
 	// Apply the batch to the memtable.
-	if err := p.env.apply(b, mem); err != nil {
+	start = time.Now()
+	err = p.env.apply(b, mem)
+	b.commitStats.MemTableApplyDuration = time.Since(start)
+	if err != nil {
 		b.db = nil // prevent batch reuse on error
 		return err
 	}
 
 	// Publish the batch sequence number.
+	start = time.Now()
 	p.publish(b)
+	b.commitStats.CommitWaitDuration = time.Since(start)
 
 	<-p.sem
 
@@ -361,7 +369,9 @@ func (p *commitPipeline) prepare(b *Batch, syncWAL bool) (*memTable, error) {
 		syncWG, syncErr = &b.commit, &b.commitErr
 	}
 
+	start := time.Now()
 	p.mu.Lock()
+	b.commitStats.QueueDuration += time.Since(start)
 
 	// Enqueue the batch in the pending queue. Note that while the pending queue
 	// is lock-free, we want the order of batches to be the same as the sequence
@@ -13,6 +13,7 @@ import (
 	"runtime/pprof"
 	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -57,6 +58,33 @@ func (i noCloseIter) Close() error {
 	return nil
 }
 
+// subcompactionIter wraps the input iterator of a subcompaction, limiting it
+// to the subcompaction's key range [lower, upper). The range tombstones
+// returned by the wrapped iterator must already be truncated to the range.
+type subcompactionIter struct {
+	internalIterator
+	cmp          Compare
+	lower, upper []byte
+}
+
+func (i *subcompactionIter) First() (*InternalKey, []byte) {
+	if i.lower == nil {
+		return i.checkUpper(i.internalIterator.First())
+	}
+	return i.checkUpper(i.internalIterator.SeekGE(i.lower))
+}
+
+func (i *subcompactionIter) Next() (*InternalKey, []byte) {
+	return i.checkUpper(i.internalIterator.Next())
+}
+
+func (i *subcompactionIter) checkUpper(key *InternalKey, val []byte) (*InternalKey, []byte) {
+	if key != nil && i.upper != nil && i.cmp(key.UserKey, i.upper) >= 0 {
+		return nil, nil
+	}
+	return key, val
+}
+
 type userKeyRange struct {
 	start, end []byte
 }
@@ -278,6 +306,42 @@ func (l *l0LimitSplitter) onNewOutput(key *InternalKey) []byte {
 	return l.limit
 }
 
+// outputSplitKeySplitter is a compactionOutputSplitter that splits outputs
+// before the split keys returned by Options.OutputSplitKey.
+type outputSplitKeySplitter struct {
+	c        *compaction
+	splitKey func(key []byte) []byte
+	limit    []byte
+}
+
+func (s *outputSplitKeySplitter) shouldSplitBefore(
+	key *InternalKey, tw *sstable.Writer,
+) compactionSplitSuggestion {
+	if s.limit != nil && s.c.cmp(key.UserKey, s.limit) >= 0 {
+		return splitNow
+	}
+	return noSplit
+}
+
+func (s *outputSplitKeySplitter) onNewOutput(key *InternalKey) []byte {
+	s.limit = nil
+	// If the new output only contains range tombstones, use the start key of
+	// the first pending tombstone to find the next split key, as
+	// l0LimitSplitter does.
+	start := s.c.rangeDelFrag.Start()
+	if key != nil {
+		start = key.UserKey
+	}
+	if start != nil {
+		// Split keys which do not advance the output are ignored, as the
+		// limit must be greater than the start of the output.
+		if k := s.splitKey(start); k != nil && s.c.cmp(k, start) > 0 {
+			s.limit = k
+		}
+	}
+	return s.limit
+}
+
 // splitterGroup is a compactionOutputSplitter that splits whenever one of its
 // child splitters advises a compaction split.
 type splitterGroup struct {
@@ -393,12 +457,14 @@ func (n *nonZeroSeqNumSplitter) onNewOutput(key *InternalKey) []byte {
 
 // compactionFile is a vfs.File wrapper that, on every write, updates a metric
 // in `versions` on bytes written by in-progress compactions so far. It also
-// increments a per-compaction `written` int.
+// increments a per-compaction `written` int, and waits for the compaction rate
+// limiter, if any.
 type compactionFile struct {
 	vfs.File
 
 	versions *versionSet
 	written  *int64
+	limiter  limiter
 }
 
 // Write implements the io.Writer interface.
@@ -410,6 +476,9 @@ func (c *compactionFile) Write(p []byte) (n int, err error) {
 
 	*c.written += int64(n)
 	c.versions.incrementCompactionBytes(int64(n))
+	if c.limiter != nil {
+		err = waitN(c.limiter, uint64(n))
+	}
 	return n, err
 }
 
@@ -472,6 +541,12 @@ type compaction struct {
 	smallest InternalKey
 	largest  InternalKey
 
+	// subcompaction is true if the compaction compacts the portion [lower,
+	// upper) of the key space of a larger compaction. A nil lower or upper
+	// bound leaves that side unbounded. See DB.runSubcompactions.
+	subcompaction bool
+	lower, upper  []byte
+
 	// The range deletion tombstone fragmenter. Adds range tombstones as they are
 	// returned from `compactionIter` and fragments them for output to files.
 	// Referenced by `compactionIter` which uses it to check whether keys are deleted.
@@ -1019,6 +1094,9 @@ func (c *compaction) newInputIter(newIters tableNewIters) (_ internalIterator, r
 			// any range tombstones completely outside file bounds.
 			rangeDelIter = rangedel.Truncate(
 				c.cmp, rangeDelIter, lowerBound.UserKey, upperBound.UserKey, &f.Smallest, &f.Largest)
+			if c.subcompaction {
+				rangeDelIter = rangedel.Truncate(c.cmp, rangeDelIter, c.lower, c.upper, nil, nil)
+			}
 		}
 		if rangeDelIter == nil {
 			rangeDelIter = emptyIter
@@ -1087,6 +1165,13 @@ func (c *compaction) newInputIter(newIters tableNewIters) (_ internalIterator, r
 			}
 			iters = append(iters, iter)
 			if rangeDelIter != nil {
+				if c.subcompaction {
+					// The truncated range tombstones reference the memory of
+					// rangeDelIter, which must remain open until the compaction
+					// finishes.
+					c.closers = append(c.closers, rangeDelIter)
+					rangeDelIter = rangedel.Truncate(c.cmp, rangeDelIter, c.lower, c.upper, nil, nil)
+				}
 				iters = append(iters, rangeDelIter)
 			}
 		}
@@ -1096,9 +1181,89 @@ func (c *compaction) newInputIter(newIters tableNewIters) (_ internalIterator, r
 	if err != nil {
 		return nil, err
 	}
+	if c.subcompaction {
+		return &subcompactionIter{
+			internalIterator: newMergingIter(c.logger, c.cmp, iters...),
+			cmp:              c.cmp,
+			lower:            c.lower,
+			upper:            c.upper,
+		}, nil
+	}
 	return newMergingIter(c.logger, c.cmp, iters...), nil
 }
 
+// subcompactionBounds returns the user keys at which the key space of the
+// compaction is partitioned into subcompactions, or nil if the compaction
+// should not be split. The compaction is split into at most maxSubcompactions
+// partitions, and into no more partitions than the number of output tables
+// its inputs are expected to produce. The partitions are split at the smallest
+// keys of the output level's tables such that each partition contains a
+// similar number of bytes of the output level.
+func (c *compaction) subcompactionBounds(maxSubcompactions int) [][]byte {
+	if maxSubcompactions <= 1 || c.subcompaction || c.kind != compactionKindDefault ||
+		len(c.flushing) != 0 || c.outputLevel.level == 0 || c.outputLevel.files.Len() < 2 {
+		return nil
+	}
+	n := maxSubcompactions
+	if n > c.outputLevel.files.Len() {
+		n = c.outputLevel.files.Len()
+	}
+	if c.maxOutputFileSize > 0 {
+		inputBytes := c.startLevel.files.SizeSum() + c.outputLevel.files.SizeSum()
+		if expected := inputBytes / c.maxOutputFileSize; expected < uint64(n) {
+			n = int(expected)
+		}
+	}
+	if n <= 1 {
+		return nil
+	}
+
+	target := c.outputLevel.files.SizeSum() / uint64(n)
+	var bounds [][]byte
+	var size uint64
+	iter := c.outputLevel.files.Iter()
+	for f := iter.First(); f != nil && len(bounds) < n-1; f = iter.Next() {
+		// Partitions must be non-empty and increasing. Adjacent tables may
+		// share a user key at their boundary.
+		key := f.Smallest.UserKey
+		if size >= target && c.cmp(key, c.smallest.UserKey) > 0 &&
+			(len(bounds) == 0 || c.cmp(key, bounds[len(bounds)-1]) > 0) {
+			bounds = append(bounds, key)
+			size = 0
+		}
+		size += f.Size
+	}
+	return bounds
+}
+
+// newSubcompaction returns a compaction which compacts the portion [lower,
+// upper) of the key space of c. The subcompaction shares the inputs of c, but
+// has its own iteration and output state.
+func (c *compaction) newSubcompaction(lower, upper []byte) *compaction {
+	return &compaction{
+		kind:                         c.kind,
+		cmp:                          c.cmp,
+		formatKey:                    c.formatKey,
+		logger:                       c.logger,
+		version:                      c.version,
+		score:                        c.score,
+		startLevel:                   c.startLevel,
+		outputLevel:                  c.outputLevel,
+		inputs:                       c.inputs,
+		maxOutputFileSize:            c.maxOutputFileSize,
+		maxOverlapBytes:              c.maxOverlapBytes,
+		disableRangeTombstoneElision: c.disableRangeTombstoneElision,
+		atomicBytesIterated:          c.atomicBytesIterated,
+		smallest:                     c.smallest,
+		largest:                      c.largest,
+		subcompaction:                true,
+		lower:                        lower,
+		upper:                        upper,
+		grandparents:                 c.grandparents,
+		inuseKeyRanges:               c.inuseKeyRanges,
+	}
+}
+
 func (c *compaction) String() string {
 	if len(c.flushing) != 0 {
 		return "flush\n"
@@ -1311,7 +1476,13 @@ func (d *DB) passedFlushThreshold() bool {
 	return true
 }
 
-func (d *DB) maybeScheduleDelayedFlush(tbl *memTable) {
+// maybeScheduleDelayedFlush schedules a flush of the specified memtable after
+// the specified delay, unless a flush of the memtable has already been forced
+// or scheduled to happen sooner. A flush which was scheduled to happen later is
+// rescheduled.
+//
+// d.mu must be held when calling this.
+func (d *DB) maybeScheduleDelayedFlush(tbl *memTable, delay time.Duration) {
 	var mem *flushableEntry
 	for _, m := range d.mu.mem.queue {
 		if m.flushable == tbl {
@@ -1319,12 +1490,25 @@ func (d *DB) maybeScheduleDelayedFlush(tbl *memTable) {
 			break
 		}
 	}
-	if mem == nil || mem.flushForced || mem.delayedFlushForced {
+	if mem == nil || mem.flushForced {
+		return
+	}
+	deadline := time.Now().Add(delay)
+	if mem.delayedFlushTimer != nil {
+		if !deadline.Before(mem.delayedFlushForcedAt) {
+			return
+		}
+		// If the timer has already fired, the flush is being forced.
+		if mem.delayedFlushTimer.Stop() {
+			mem.delayedFlushTimer.Reset(delay)
+			mem.delayedFlushForcedAt = deadline
+		}
 		return
 	}
-	mem.delayedFlushForced = true
+	mem.delayedFlushForcedAt = deadline
+	timer := time.NewTimer(delay)
+	mem.delayedFlushTimer = timer
 	go func() {
-		timer := time.NewTimer(d.opts.Experimental.DeleteRangeFlushDelay)
 		defer timer.Stop()
 
 		select {
@@ -1431,11 +1615,13 @@ func (d *DB) flush1() error {
 	ve, pendingOutputs, err := d.runCompaction(jobID, c, flushPacer)
 
 	info := FlushInfo{
-		JobID:    jobID,
-		Input:    n,
-		Duration: d.timeNow().Sub(startTime),
-		Done:     true,
-		Err:      err,
+		JobID:        jobID,
+		Input:        n,
+		Duration:     d.timeNow().Sub(startTime),
+		BytesRead:    c.bytesIterated,
+		BytesWritten: uint64(c.bytesWritten),
+		Done:         true,
+		Err:          err,
 	}
 	if err == nil {
 		for i := range ve.NewFiles {
@@ -1469,6 +1655,7 @@ func (d *DB) flush1() error {
 	d.removeInProgressCompaction(c)
 	d.mu.versions.incrementCompactionBytes(-c.bytesWritten)
 	d.mu.versions.incrementFlushes()
+	info.TotalDuration = d.timeNow().Sub(startTime)
 	d.opts.EventListener.FlushEnd(info)
 
 	// Refresh bytes flushed count.
@@ -1515,6 +1702,45 @@ func pickElisionOnly(picker compactionPicker, env compactionEnv) *pickedCompacti
 	return picker.pickElisionOnlyCompaction(env)
 }
 
+// periodicCompactionCheckInterval returns the interval at which compactions
+// are scheduled for tables which have reached the specified periodic
+// compaction age. A table is compacted at most a tenth of its age, or a second,
+// after it becomes eligible.
+func periodicCompactionCheckInterval(age time.Duration) time.Duration {
+	interval := age / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return interval
+}
+
+// periodicCompactionLoop schedules compactions at the specified interval until
+// the DB is closed. Otherwise, tables which reach the periodic compaction age
+// while no flushes or compactions occur would not be compacted.
+func (d *DB) periodicCompactionLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.closedCh:
+			return
+		case <-ticker.C:
+			d.mu.Lock()
+			d.maybeScheduleCompaction()
+			d.mu.Unlock()
+		}
+	}
+}
+
+// automaticCompactionsEnabled returns true if automatic compactions may be
+// scheduled.
+//
+// d.mu must be held when calling this.
+func (d *DB) automaticCompactionsEnabled() bool {
+	return !d.opts.private.disableAutomaticCompactions && d.mu.compact.automaticDisabled == 0
+}
+
 // maybeScheduleCompactionPicker schedules a compaction if necessary,
 // calling `pickFunc` to pick automatic compactions.
 //
@@ -1525,7 +1751,7 @@ func (d *DB) maybeScheduleCompactionPicker(
 	if d.closed.Load() != nil || d.opts.ReadOnly {
 		return
 	}
-	if d.mu.compact.compactingCount >= d.opts.MaxConcurrentCompactions {
+	if d.mu.compact.compactingCount >= d.mu.compact.maxConcurrent {
 		if len(d.mu.compact.manual) > 0 {
 			// Inability to run head blocks later manual compactions.
 			d.mu.compact.manual[0].retries++
@@ -1550,13 +1776,14 @@ func (d *DB) maybeScheduleCompactionPicker(
 		bytesCompacted:          &d.atomic.bytesCompacted,
 		earliestSnapshotSeqNum:  d.mu.snapshots.earliest(),
 		earliestUnflushedSeqNum: d.getEarliestUnflushedSeqNumLocked(),
+		invalidPickLogTime:      &d.mu.compact.invalidPickLogTime,
 	}
 
 	// Check for delete-only compactions first, because they're expected to be
 	// cheap and reduce future compaction work.
 	if len(d.mu.compact.deletionHints) > 0 &&
-		d.mu.compact.compactingCount < d.opts.MaxConcurrentCompactions &&
-		!d.opts.private.disableAutomaticCompactions {
+		d.mu.compact.compactingCount < d.mu.compact.maxConcurrent &&
+		d.automaticCompactionsEnabled() {
 		v := d.mu.versions.currentVersion()
 		snapshots := d.mu.snapshots.toSlice()
 		inputs, unresolvedHints := checkDeleteCompactionHints(d.cmp, v, d.mu.compact.deletionHints, snapshots)
@@ -1570,7 +1797,7 @@ func (d *DB) maybeScheduleCompactionPicker(
 		}
 	}
 
-	for len(d.mu.compact.manual) > 0 && d.mu.compact.compactingCount < d.opts.MaxConcurrentCompactions {
+	for len(d.mu.compact.manual) > 0 && d.mu.compact.compactingCount < d.mu.compact.maxConcurrent {
 		manual := d.mu.compact.manual[0]
 		env.inProgressCompactions = d.getInProgressCompactionInfoLocked(nil)
 		pc, retryLater := d.mu.versions.picker.pickManual(env, manual)
@@ -1591,7 +1818,7 @@ func (d *DB) maybeScheduleCompactionPicker(
 		}
 	}
 
-	for !d.opts.private.disableAutomaticCompactions && d.mu.compact.compactingCount < d.opts.MaxConcurrentCompactions {
+	for d.automaticCompactionsEnabled() && d.mu.compact.compactingCount < d.mu.compact.maxConcurrent {
 		env.inProgressCompactions = d.getInProgressCompactionInfoLocked(nil)
 		env.readCompactionEnv = readCompactionEnv{
 			readCompactions: &d.mu.compact.readCompactions,
@@ -1865,6 +2092,8 @@ func (d *DB) compact1(c *compaction, errChannel chan error) (err error) {
 		}
 	}
 
+	info.BytesRead = c.bytesIterated
+	info.BytesWritten = uint64(c.bytesWritten)
 	info.Done = true
 	info.Err = err
 	if err == nil {
@@ -1878,6 +2107,7 @@ func (d *DB) compact1(c *compaction, errChannel chan error) (err error) {
 	d.removeInProgressCompaction(c)
 	d.mu.versions.incrementCompactions()
 	d.mu.versions.incrementCompactionBytes(-c.bytesWritten)
+	info.TotalDuration = d.timeNow().Sub(startTime)
 	d.opts.EventListener.CompactionEnd(info)
 
 	// Update the read state before deleting obsolete files because the
@@ -1954,6 +2184,18 @@ func (d *DB) runCompaction(
 		return ve, nil, nil
 	}
 
+	// Split a large compaction into subcompactions which run concurrently.
+	// Each subcompaction beyond the first occupies a compaction slot, so the
+	// compaction is only split into as many subcompactions as there are free
+	// slots. The compaction itself already occupies one of the slots.
+	maxSubcompactions := d.opts.Experimental.MaxSubcompactions
+	if free := d.mu.compact.maxConcurrent - d.mu.compact.compactingCount; maxSubcompactions > free+1 {
+		maxSubcompactions = free + 1
+	}
+	if bounds := c.subcompactionBounds(maxSubcompactions); bounds != nil {
+		return d.runSubcompactions(jobID, c, bounds, pacer)
+	}
+
 	defer func() {
 		if retErr != nil {
 			pendingOutputs = nil
@@ -1974,6 +2216,22 @@ func (d *DB) runCompaction(
 	c.allowedZeroSeqNum = c.allowZeroSeqNum(iiter)
 	iter := newCompactionIter(c.cmp, c.formatKey, d.merge, iiter, snapshots,
 		&c.rangeDelFrag, c.allowedZeroSeqNum, c.elideTombstone, c.elideRangeTombstone)
+	if d.opts.CompactionFilter != nil && len(c.flushing) == 0 {
+		iter.filter = d.opts.CompactionFilter()
+		iter.filterLevel = c.outputLevel.level
+	}
+
+	// Compactions, but not flushes, are limited by MaxCompactionRate. The bytes
+	// read are charged as they are iterated, and the bytes written as they are
+	// written to the output tables.
+	rateLimiter := d.compactionRateLimiter
+	if len(c.flushing) != 0 {
+		rateLimiter = nil
+	}
+	var rateLimitedBytes uint64
+	// reportedBytes is the portion of c.bytesIterated which a subcompaction has
+	// added to the counter it shares with the other subcompactions.
+	var reportedBytes uint64
 
 	var (
 		filenames []string
@@ -2044,6 +2302,7 @@ func (d *DB) runCompaction(
 			File:     file,
 			versions: d.mu.versions,
 			written:  &c.bytesWritten,
+			limiter:  rateLimiter,
 		}
 		filenames = append(filenames, filename)
 		cacheOpts := private.SSTableCacheOpts(d.cacheID, fileNum).(sstable.WriterOption)
@@ -2312,6 +2571,12 @@ func (d *DB) runCompaction(
 		}
 		outputSplitters = append(outputSplitters, &l0LimitSplitter{c: c, ve: ve})
 	}
+	if d.opts.OutputSplitKey != nil {
+		outputSplitters = append(outputSplitters, &outputSplitKeySplitter{
+			c:        c,
+			splitKey: d.opts.OutputSplitKey,
+		})
+	}
 	splitter = &splitterGroup{
 		cmp:       c.cmp,
 		splitters: outputSplitters,
@@ -2370,12 +2635,24 @@ func (d *DB) runCompaction(
 				limit = nil
 			}
 
-			atomic.StoreUint64(c.atomicBytesIterated, c.bytesIterated)
+			if c.subcompaction {
+				// The subcompactions of a compaction share its counter.
+				atomic.AddUint64(c.atomicBytesIterated, c.bytesIterated-reportedBytes)
+				reportedBytes = c.bytesIterated
+			} else {
+				atomic.StoreUint64(c.atomicBytesIterated, c.bytesIterated)
+			}
 			if pacer != nilPacer {
 				if err := pacer.maybeThrottle(c.bytesIterated); err != nil {
 					return nil, pendingOutputs, err
 				}
 			}
+			if rateLimiter != nil && c.bytesIterated > rateLimitedBytes {
+				if err := waitN(rateLimiter, c.bytesIterated-rateLimitedBytes); err != nil {
+					return nil, pendingOutputs, err
+				}
+				rateLimitedBytes = c.bytesIterated
+			}
 			if key.Kind() == InternalKeyKindRangeDelete {
 				// Range tombstones are handled specially. They are fragmented and
 				// written later during `finishOutput()`. We add them to the
@@ -2460,6 +2737,129 @@ func (d *DB) runCompaction(
 	return ve, pendingOutputs, nil
 }
 
+// runSubcompactions runs a compaction as a set of subcompactions, one for each
+// of the partitions of its key space delimited by bounds, which run
+// concurrently. The output tables of the subcompactions are combined into a
+// single version edit. If any of the subcompactions fails, the output tables of
+// all of the subcompactions are removed.
+//
+// The subcompactions beyond the first are counted in
+// d.mu.compact.compactingCount while they run. They are throttled together by
+// pacer, and report their combined progress through c.atomicBytesIterated.
+//
+// d.mu must be held when calling this, but the mutex may be dropped and
+// re-acquired during the course of this method.
+func (d *DB) runSubcompactions(
+	jobID int, c *compaction, bounds [][]byte, pacer pacer,
+) (*versionEdit, []*fileMetadata, error) {
+	type result struct {
+		ve             *versionEdit
+		pendingOutputs []*fileMetadata
+		err            error
+	}
+	subs := make([]*compaction, len(bounds)+1)
+	results := make([]result, len(subs))
+	d.mu.compact.compactingCount += len(bounds)
+	atomic.StoreUint64(c.atomicBytesIterated, 0)
+	var shared *sharedPacer
+	if pacer != nilPacer {
+		shared = &sharedPacer{pacer: pacer}
+	}
+	var wg sync.WaitGroup
+	for i := range subs {
+		var lower, upper []byte
+		if i > 0 {
+			lower = bounds[i-1]
+		}
+		if i < len(bounds) {
+			upper = bounds[i]
+		}
+		subs[i] = c.newSubcompaction(lower, upper)
+		subPacer := pacer
+		if shared != nil {
+			subPacer = &subcompactionPacer{shared: shared}
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			r := &results[i]
+			r.ve, r.pendingOutputs, r.err = d.runCompaction(jobID, subs[i], subPacer)
+		}(i)
+	}
+
+	// Release the d.mu lock while the subcompactions run.
+	// Note the unusual order: Unlock and then Lock.
+	d.mu.Unlock()
+	wg.Wait()
+	d.mu.Lock()
+	d.mu.compact.compactingCount -= len(bounds)
+	d.maybeScheduleCompaction()
+	d.mu.compact.cond.Broadcast()
+	d.mu.Unlock()
+	defer d.mu.Lock()
+
+	var err error
+	for i, sub := range subs {
+		err = firstError(err, results[i].err)
+		c.bytesIterated += sub.bytesIterated
+		c.bytesWritten += sub.bytesWritten
+		// The deletion hints conflicting with zeroed seqnums are removed using
+		// the parent compaction. See maybeUpdateDeleteCompactionHints.
+		c.allowedZeroSeqNum = c.allowedZeroSeqNum || sub.allowedZeroSeqNum
+	}
+	atomic.StoreUint64(c.atomicBytesIterated, c.bytesIterated)
+	if err != nil {
+		// The subcompactions which failed have already removed their outputs.
+		for _, r := range results {
+			if r.err != nil {
+				continue
+			}
+			for _, nf := range r.ve.NewFiles {
+				d.opts.FS.Remove(base.MakeFilename(d.opts.FS, d.dirname, fileTypeTable, nf.Meta.FileNum))
+			}
+		}
+		return nil, nil, err
+	}
+
+	ve := &versionEdit{
+		DeletedFiles: map[deletedFileEntry]*fileMetadata{},
+	}
+	outputMetrics := &LevelMetrics{
+		BytesIn:   c.startLevel.files.SizeSum(),
+		BytesRead: c.outputLevel.files.SizeSum(),
+	}
+	outputMetrics.BytesRead += outputMetrics.BytesIn
+	c.metrics = map[int]*LevelMetrics{
+		c.outputLevel.level: outputMetrics,
+		c.startLevel.level:  {},
+	}
+	var pendingOutputs []*fileMetadata
+	for _, r := range results {
+		pendingOutputs = append(pendingOutputs, r.pendingOutputs...)
+		for _, nf := range r.ve.NewFiles {
+			ve.NewFiles = append(ve.NewFiles, nf)
+			outputMetrics.TablesCompacted++
+			outputMetrics.BytesCompacted += nf.Meta.Size
+			outputMetrics.Size += int64(nf.Meta.Size)
+			outputMetrics.NumFiles++
+		}
+	}
+	for _, cl := range c.inputs {
+		iter := cl.files.Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			c.metrics[cl.level].NumFiles--
+			c.metrics[cl.level].Size -= int64(f.Size)
+			ve.DeletedFiles[deletedFileEntry{
+				Level:   cl.level,
+				FileNum: f.FileNum,
+			}] = f
+		}
+	}
+	return ve, pendingOutputs, nil
+}
+
 // scanObsoleteFiles scans the filesystem for files that are no longer needed
 // and adds those to the internal lists of obsolete files. Note that the files
 // are not actually deleted by this method. A subsequent call to
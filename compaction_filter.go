@@ -0,0 +1,50 @@
+// Copyright 2021 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+// CompactionFilterDecision is the decision of a CompactionFilter about a key.
+type CompactionFilterDecision int
+
+const (
+	// CompactionFilterKeep keeps the key and its value unchanged.
+	CompactionFilterKeep CompactionFilterDecision = iota
+	// CompactionFilterRemove removes the key. The key is replaced by a point
+	// tombstone so that older values of the key in lower levels do not become
+	// visible. The tombstone is elided when no lower level contains the key.
+	CompactionFilterRemove
+	// CompactionFilterChangeValue replaces the value of the key with the value
+	// returned by the filter.
+	CompactionFilterChangeValue
+)
+
+// String implements fmt.Stringer.
+func (d CompactionFilterDecision) String() string {
+	switch d {
+	case CompactionFilterKeep:
+		return "keep"
+	case CompactionFilterRemove:
+		return "remove"
+	case CompactionFilterChangeValue:
+		return "change-value"
+	default:
+		return "unknown"
+	}
+}
+
+// CompactionFilter allows an application to drop or rewrite values while they
+// are compacted, for example to expire values with a TTL or to lazily migrate
+// the encoding of values.
+//
+// A filter is consulted for each key written by a compaction whose value was
+// written by Set, or is the result of merging with such a value. Keys written
+// by flushes, and keys which are visible to an open snapshot, are not
+// filtered. A key may be filtered again by each compaction which rewrites it.
+type CompactionFilter interface {
+	// Filter returns the decision about the key and value, which are written
+	// to the specified level. The value returned for
+	// CompactionFilterChangeValue need only remain valid until the next call
+	// to Filter. The key and value must not be modified or retained.
+	Filter(level int, key, value []byte) (decision CompactionFilterDecision, newValue []byte)
+}
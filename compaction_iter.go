@@ -178,6 +178,9 @@ type compactionIter struct {
 	allowZeroSeqNum     bool
 	elideTombstone      func(key []byte) bool
 	elideRangeTombstone func(start, end []byte) bool
+	// The compaction filter, if any, and the level the compaction writes to.
+	filter      CompactionFilter
+	filterLevel int
 }
 
 func newCompactionIter(
@@ -307,6 +310,16 @@ func (i *compactionIter) Next() (*InternalKey, []byte) {
 			i.value = i.iterValue
 			i.valid = true
 			i.skip = true
+			if i.filterValue(i.curSnapshotIdx) {
+				// The filter converted the key to a tombstone. Elide it if we're at
+				// the last snapshot stripe, as for any other tombstone.
+				if i.curSnapshotIdx == 0 && i.elideTombstone(i.key.UserKey) {
+					i.valid = false
+					i.skipInStripe()
+					continue
+				}
+				return &i.key, i.value
+			}
 			i.maybeZeroSeqnum(i.curSnapshotIdx)
 			return &i.key, i.value
 
@@ -326,6 +339,11 @@ func (i *compactionIter) Next() (*InternalKey, []byte) {
 				includesBase := i.key.Kind() == InternalKeyKindSet
 				i.value, i.valueCloser, i.err = valueMerger.Finish(includesBase)
 			}
+			if i.err == nil && i.key.Kind() == InternalKeyKindSet && i.filterValue(origSnapshotIdx) {
+				// A merge result which the filter converted to a tombstone is not
+				// elided, as the iterator may already be positioned at the next key.
+				return &i.key, i.value
+			}
 			if i.err == nil {
 				// A non-skippable entry does not necessarily cover later merge
 				// operands, so we must not zero the current merge result's seqnum.
@@ -635,6 +653,27 @@ func (i *compactionIter) emitRangeDelChunk(fragmented []rangedel.Tombstone) {
 	}
 }
 
+// filterValue applies the compaction filter, if any, to the current key, which
+// must be a SET in the snapshot stripe with the specified index. Keys which are
+// visible to a snapshot are not filtered. Returns true if the filter removed
+// the key, in which case the key is converted to a DEL so that it continues to
+// shadow older entries for the key in lower levels.
+func (i *compactionIter) filterValue(snapshotIdx int) bool {
+	if i.filter == nil || snapshotIdx < len(i.snapshots) {
+		return false
+	}
+	decision, value := i.filter.Filter(i.filterLevel, i.key.UserKey, i.value)
+	switch decision {
+	case CompactionFilterRemove:
+		i.key.SetKind(InternalKeyKindDelete)
+		i.value = nil
+		return true
+	case CompactionFilterChangeValue:
+		i.value = value
+	}
+	return false
+}
+
 // maybeZeroSeqnum attempts to set the seqnum for the current key to 0. Doing
 // so improves compression and enables an optimization during forward iteration
 // to skip some key comparisons. The seqnum for an entry can be zeroed if the
@@ -72,15 +72,32 @@ func (m *debugMerger) Finish(includesBase bool) ([]byte, io.Closer, error) {
 	return m.buf, nil, nil
 }
 
+// debugCompactionFilter removes the keys whose value contains "remove" and
+// appends "[changed]" to the values which contain "change".
+type debugCompactionFilter struct{}
+
+func (debugCompactionFilter) Filter(
+	level int, key, value []byte,
+) (CompactionFilterDecision, []byte) {
+	switch {
+	case bytes.Contains(value, []byte("remove")):
+		return CompactionFilterRemove, nil
+	case bytes.Contains(value, []byte("change")):
+		return CompactionFilterChangeValue, append(append([]byte(nil), value...), "[changed]"...)
+	}
+	return CompactionFilterKeep, nil
+}
+
 func TestCompactionIter(t *testing.T) {
 	var keys []InternalKey
 	var vals [][]byte
 	var snapshots []uint64
 	var elideTombstones bool
 	var allowZeroSeqnum bool
+	var filter bool
 
 	newIter := func() *compactionIter {
-		return newCompactionIter(
+		iter := newCompactionIter(
 			DefaultComparer.Compare,
 			DefaultComparer.FormatKey,
 			func(key, value []byte) (base.ValueMerger, error) {
@@ -99,6 +116,10 @@ func TestCompactionIter(t *testing.T) {
 				return elideTombstones
 			},
 		)
+		if filter {
+			iter.filter = debugCompactionFilter{}
+		}
+		return iter
 	}
 
 	datadriven.RunTest(t, "testdata/compaction_iter", func(d *datadriven.TestData) string {
@@ -117,6 +138,7 @@ func TestCompactionIter(t *testing.T) {
 			snapshots = snapshots[:0]
 			elideTombstones = false
 			allowZeroSeqnum = false
+			filter = false
 			for _, arg := range d.CmdArgs {
 				switch arg.Key {
 				case "snapshots":
@@ -139,6 +161,12 @@ func TestCompactionIter(t *testing.T) {
 					if err != nil {
 						return err.Error()
 					}
+				case "filter":
+					var err error
+					filter, err = strconv.ParseBool(arg.Vals[0])
+					if err != nil {
+						return err.Error()
+					}
 				default:
 					return fmt.Sprintf("%s: unknown arg: %s", d.Cmd, arg.Key)
 				}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"math"
 	"sort"
+	"time"
 
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/humanize"
@@ -25,6 +26,9 @@ type compactionEnv struct {
 	earliestSnapshotSeqNum  uint64
 	inProgressCompactions   []compactionInfo
 	readCompactionEnv       readCompactionEnv
+	// invalidPickLogTime, if non-nil, is the time at which an invalid
+	// compaction picked by a CompactionPicker was last logged.
+	invalidPickLogTime *time.Time
 }
 
 type compactionPicker interface {
@@ -423,6 +427,12 @@ func newCompactionPicker(
 		levelSizes: levelSizes,
 	}
 	p.initLevelMaxBytes(inProgressCompactions)
+	if opts.CompactionPicker != nil {
+		return &compactionPickerCustom{compactionPickerByScore: p, picker: opts.CompactionPicker}
+	}
+	if opts.CompactionStyle == CompactionStyleTiered {
+		return &compactionPickerTiered{compactionPickerByScore: p}
+	}
 	return p
 }
 
@@ -873,22 +883,8 @@ func (p *compactionPickerByScore) pickFile(
 // If a score-based compaction cannot be found, pickAuto falls back to looking
 // for an elision-only compaction to remove obsolete keys.
 func (p *compactionPickerByScore) pickAuto(env compactionEnv) (pc *pickedCompaction) {
-	// Compaction concurrency is controlled by L0 read-amp. We allow one
-	// additional compaction per L0CompactionConcurrency sublevels, as well as
-	// one additional compaction per CompactionDebtConcurrency bytes of
-	// compaction debt. Compaction concurrency is tied to L0 sublevels as that
-	// signal is independent of the database size. We tack on the compaction
-	// debt as a second signal to prevent compaction concurrency from dropping
-	// significantly right after a base compaction finishes, and before those
-	// bytes have been compacted further down the LSM.
-	if n := len(env.inProgressCompactions); n > 0 {
-		l0ReadAmp := p.vers.L0Sublevels.MaxDepthAfterOngoingCompactions()
-		compactionDebt := int(p.estimatedCompactionDebt(0))
-		ccSignal1 := n * p.opts.Experimental.L0CompactionConcurrency
-		ccSignal2 := n * p.opts.Experimental.CompactionDebtConcurrency
-		if l0ReadAmp < ccSignal1 && compactionDebt < ccSignal2 {
-			return nil
-		}
+	if !p.allowConcurrentCompaction(env) {
+		return nil
 	}
 
 	scores := p.calculateScores(env.inProgressCompactions)
@@ -988,6 +984,13 @@ func (p *compactionPickerByScore) pickAuto(env compactionEnv) (pc *pickedCompact
 		}
 	}
 
+	// Check for files above L6 which mostly contain tombstones. Compacting
+	// these files reclaims the space of the deleted data sooner than waiting
+	// for their levels to grow.
+	if pc := p.pickTombstoneDenseCompaction(env); pc != nil {
+		return pc
+	}
+
 	// Check for L6 files with tombstones that may be elided. These files may
 	// exist if a snapshot prevented the elision of a tombstone or because of
 	// a move compaction. These are low-priority compactions because they
@@ -996,6 +999,13 @@ func (p *compactionPickerByScore) pickAuto(env compactionEnv) (pc *pickedCompact
 		return pc
 	}
 
+	// Check for tables older than the periodic compaction age. These are the
+	// lowest priority compactions, as they only serve to eventually visit all
+	// of the data.
+	if pc := p.pickPeriodicCompaction(env); pc != nil {
+		return pc
+	}
+
 	if pc := p.pickReadTriggeredCompaction(env); pc != nil {
 		return pc
 	}
@@ -1003,6 +1013,29 @@ func (p *compactionPickerByScore) pickAuto(env compactionEnv) (pc *pickedCompact
 	return nil
 }
 
+// allowConcurrentCompaction returns whether another compaction may be picked
+// given the in-progress compactions.
+func (p *compactionPickerByScore) allowConcurrentCompaction(env compactionEnv) bool {
+	// Compaction concurrency is controlled by L0 read-amp. We allow one
+	// additional compaction per L0CompactionConcurrency sublevels, as well as
+	// one additional compaction per CompactionDebtConcurrency bytes of
+	// compaction debt. Compaction concurrency is tied to L0 sublevels as that
+	// signal is independent of the database size. We tack on the compaction
+	// debt as a second signal to prevent compaction concurrency from dropping
+	// significantly right after a base compaction finishes, and before those
+	// bytes have been compacted further down the LSM.
+	if n := len(env.inProgressCompactions); n > 0 {
+		l0ReadAmp := p.vers.L0Sublevels.MaxDepthAfterOngoingCompactions()
+		compactionDebt := int(p.estimatedCompactionDebt(0))
+		ccSignal1 := n * p.opts.Experimental.L0CompactionConcurrency
+		ccSignal2 := n * p.opts.Experimental.CompactionDebtConcurrency
+		if l0ReadAmp < ccSignal1 && compactionDebt < ccSignal2 {
+			return false
+		}
+	}
+	return true
+}
+
 // elisionOnlyAnnotator implements the manifest.Annotator interface,
 // annotating B-Tree nodes with the *fileMetadata of a file meeting the
 // obsolete keys criteria for an elision-only compaction within the subtree.
@@ -1096,6 +1129,178 @@ func (p *compactionPickerByScore) pickElisionOnlyCompaction(
 	return nil
 }
 
+// tombstoneDense returns true if the table stats meet the criteria for a
+// tombstone-dense compaction. See
+// Options.Experimental.TombstoneDenseCompactionRatio.
+func tombstoneDense(opts *Options, stats *manifest.TableStats) bool {
+	ratio := opts.Experimental.TombstoneDenseCompactionRatio
+	if ratio <= 0 || !stats.Valid {
+		return false
+	}
+	return stats.NumDeletions >= uint64(opts.Experimental.TombstoneDenseCompactionMinDeletions) &&
+		float64(stats.NumDeletions) >= ratio*float64(stats.NumEntries)
+}
+
+// tombstoneDenseAnnotator implements the manifest.Annotator interface,
+// annotating B-Tree nodes with the *fileMetadata of the file meeting the
+// tombstone-dense compaction criteria which has the highest fraction of
+// tombstones within the subtree.
+type tombstoneDenseAnnotator struct {
+	opts *Options
+}
+
+var _ manifest.Annotator = tombstoneDenseAnnotator{}
+
+func (a tombstoneDenseAnnotator) Zero(interface{}) interface{} {
+	return nil
+}
+
+func (a tombstoneDenseAnnotator) Accumulate(
+	f *fileMetadata, dst interface{},
+) (interface{}, bool) {
+	if f.Compacting {
+		return dst, true
+	}
+	if !f.Stats.Valid {
+		return dst, false
+	}
+	if !tombstoneDense(a.opts, &f.Stats) {
+		return dst, true
+	}
+	return a.Merge(f, dst), true
+}
+
+func (a tombstoneDenseAnnotator) Merge(v interface{}, accum interface{}) interface{} {
+	if v == nil {
+		return accum
+	}
+	if accum == nil {
+		return v
+	}
+	f := v.(*fileMetadata)
+	accumV := accum.(*fileMetadata)
+	if accumV == nil || tombstoneDensity(f) > tombstoneDensity(accumV) {
+		return f
+	}
+	return accumV
+}
+
+func tombstoneDensity(f *fileMetadata) float64 {
+	return float64(f.Stats.NumDeletions) / float64(f.Stats.NumEntries)
+}
+
+// pickTombstoneDenseCompaction looks for a compaction of the file with the
+// highest fraction of tombstones in the highest level above the bottommost
+// level which contains a file meeting the tombstone-dense compaction
+// criteria. The file is compacted into the next level.
+func (p *compactionPickerByScore) pickTombstoneDenseCompaction(
+	env compactionEnv,
+) (pc *pickedCompaction) {
+	if p.opts.Experimental.TombstoneDenseCompactionRatio <= 0 {
+		return nil
+	}
+	for level := p.baseLevel; level < numLevels-1; level++ {
+		v := p.vers.Levels[level].Annotation(tombstoneDenseAnnotator{opts: p.opts})
+		if v == nil {
+			continue
+		}
+		candidate := v.(*fileMetadata)
+		if candidate.Compacting {
+			continue
+		}
+		lf := p.vers.Levels[level].Find(p.opts.Comparer.Compare, candidate)
+		if lf == nil {
+			panic(fmt.Sprintf("file %s not found in level %d as expected", candidate.FileNum, level))
+		}
+		pc = newPickedCompaction(p.opts, p.vers, level, p.baseLevel)
+		pc.startLevel.files = lf.Slice()
+		// Fail-safe to protect against compacting the same sstable concurrently.
+		if pc.setupInputs() && !inputRangeAlreadyCompacting(env, pc) {
+			return pc
+		}
+	}
+	return nil
+}
+
+// periodicCompactionAnnotator implements the manifest.Annotator interface,
+// annotating B-Tree nodes with the *fileMetadata of the file with the oldest
+// known creation time within the subtree which is not already being
+// compacted.
+type periodicCompactionAnnotator struct{}
+
+var _ manifest.Annotator = periodicCompactionAnnotator{}
+
+func (a periodicCompactionAnnotator) Zero(interface{}) interface{} {
+	return nil
+}
+
+func (a periodicCompactionAnnotator) Accumulate(
+	f *fileMetadata, dst interface{},
+) (interface{}, bool) {
+	if f.Compacting || f.CreationTime == 0 {
+		return dst, true
+	}
+	return a.Merge(f, dst), true
+}
+
+func (a periodicCompactionAnnotator) Merge(v interface{}, accum interface{}) interface{} {
+	if v == nil {
+		return accum
+	}
+	if accum == nil {
+		return v
+	}
+	f := v.(*fileMetadata)
+	accumV := accum.(*fileMetadata)
+	if accumV == nil || f.CreationTime < accumV.CreationTime {
+		return f
+	}
+	return accumV
+}
+
+// pickPeriodicCompaction looks for a compaction of the oldest table in the
+// highest level containing a table older than
+// Options.Experimental.PeriodicCompactionAge. A table above the bottommost
+// level is compacted into the next level, and a table in the bottommost level
+// is rewritten in place.
+func (p *compactionPickerByScore) pickPeriodicCompaction(
+	env compactionEnv,
+) (pc *pickedCompaction) {
+	age := p.opts.Experimental.PeriodicCompactionAge
+	if age <= 0 {
+		return nil
+	}
+	cutoff := time.Now().Add(-age).Unix()
+	cmp := p.opts.Comparer.Compare
+	for level := 0; level < numLevels; level++ {
+		v := p.vers.Levels[level].Annotation(periodicCompactionAnnotator{})
+		if v == nil {
+			continue
+		}
+		candidate := v.(*fileMetadata)
+		if candidate.Compacting || candidate.CreationTime > cutoff {
+			continue
+		}
+		pc = newPickedCompaction(p.opts, p.vers, level, p.baseLevel)
+		if level == 0 {
+			// Files in level 0 may overlap each other, so pick up all
+			// overlapping ones.
+			pc.startLevel.files = p.vers.Overlaps(0, cmp, candidate.Smallest.UserKey, candidate.Largest.UserKey)
+		} else {
+			lf := p.vers.Levels[level].Find(cmp, candidate)
+			if lf == nil {
+				panic(fmt.Sprintf("file %s not found in level %d as expected", candidate.FileNum, level))
+			}
+			pc.startLevel.files = lf.Slice()
+		}
+		// Fail-safe to protect against compacting the same sstable concurrently.
+		if pc.setupInputs() && !inputRangeAlreadyCompacting(env, pc) {
+			return pc
+		}
+	}
+	return nil
+}
+
 func pickAutoHelper(
 	env compactionEnv, opts *Options, vers *version, cInfo candidateLevelInfo, baseLevel int,
 ) (pc *pickedCompaction) {
@@ -0,0 +1,217 @@
+// Copyright 2021 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/manifest"
+)
+
+// TableStats exports the manifest.TableStats type.
+type TableStats = manifest.TableStats
+
+// CompactionPicker allows an application to implement its own policy for
+// picking automatic compactions.
+//
+// A custom picker replaces the policy of the configured CompactionStyle.
+// Manual, delete-only and elision-only compactions are still picked by Pebble,
+// while read-triggered compactions are not performed.
+type CompactionPicker interface {
+	// PickCompaction returns the compaction to run next, if any. It is called
+	// with the DB mutex held whenever Pebble may start a new compaction, so it
+	// must be fast and must not call into the DB. The info must not be
+	// retained after the call returns.
+	//
+	// A compaction which conflicts with an in-progress compaction is not run.
+	// A compaction which is invalid is not run, and is logged at most once a
+	// minute.
+	PickCompaction(info *CompactionPickerInfo) (c CompactionChoice, ok bool)
+}
+
+// CompactionPickerInfo describes the LSM to a CompactionPicker. It is a
+// read-only view of the current version of the LSM, from which the tables are
+// only described as they are visited.
+type CompactionPickerInfo struct {
+	// LevelSizes holds the total size in bytes of the tables of each level.
+	LevelSizes [numLevels]int64
+	// BaseLevel is the level L0 would be compacted into by the leveled
+	// compaction style.
+	BaseLevel int
+
+	vers *version
+	// table is the description of the table being visited by Tables.
+	table CompactionPickerTable
+}
+
+// NumTables returns the number of tables in the level.
+func (i *CompactionPickerInfo) NumTables(level int) int {
+	return i.vers.Levels[level].Len()
+}
+
+// Tables calls fn with each table of the level until fn returns false. The
+// tables in L0 are visited in sequence number order, and the tables in the
+// other levels in key order. The table passed to fn is reused, and must not be
+// retained after fn returns.
+func (i *CompactionPickerInfo) Tables(level int, fn func(t *CompactionPickerTable) bool) {
+	iter := i.vers.Levels[level].Iter()
+	for f := iter.First(); f != nil; f = iter.Next() {
+		i.table = CompactionPickerTable{
+			TableInfo:  f.TableInfo(),
+			Compacting: f.Compacting,
+			Stats:      f.Stats,
+		}
+		if !fn(&i.table) {
+			return
+		}
+	}
+}
+
+// CompactionPickerTable describes a table to a CompactionPicker.
+type CompactionPickerTable struct {
+	TableInfo
+	// Compacting is true if the table is an input of an in-progress
+	// compaction.
+	Compacting bool
+	// Stats holds the statistics of the table. Stats are loaded in the
+	// background after a table is created, and Stats.Valid is false until
+	// then.
+	Stats TableStats
+}
+
+// CompactionChoice is a compaction picked by a CompactionPicker.
+type CompactionChoice struct {
+	// StartLevel is the level of the tables to compact.
+	StartLevel int
+	// OutputLevel is the level the compaction writes to. It must be below
+	// StartLevel, and the levels in between must be empty.
+	OutputLevel int
+	// Tables holds the file numbers of the tables in StartLevel to compact.
+	// The compaction also includes the tables which overlap them in StartLevel
+	// and OutputLevel, as required to keep the LSM consistent.
+	Tables []FileNum
+}
+
+// compactionPickerCustom picks automatic compactions using an
+// Options.CompactionPicker. Manual and elision-only compactions, and the scores
+// and compaction debt reported in metrics, are those of
+// compactionPickerByScore.
+type compactionPickerCustom struct {
+	*compactionPickerByScore
+	picker CompactionPicker
+	info   CompactionPickerInfo
+}
+
+// invalidPickLogInterval is the minimum interval between the log messages for
+// invalid compactions picked by a CompactionPicker, which would otherwise be
+// logged whenever a compaction may be started.
+const invalidPickLogInterval = time.Minute
+
+var _ compactionPicker = &compactionPickerCustom{}
+
+// pickAuto picks the compaction chosen by the custom picker, if any, falling
+// back to an elision-only compaction.
+func (p *compactionPickerCustom) pickAuto(env compactionEnv) (pc *pickedCompaction) {
+	if !p.allowConcurrentCompaction(env) {
+		return nil
+	}
+
+	if c, ok := p.picker.PickCompaction(p.pickerInfo()); ok {
+		pc, err := p.pickChoice(env, c)
+		if err != nil {
+			if last := env.invalidPickLogTime; last == nil || time.Since(*last) >= invalidPickLogInterval {
+				p.opts.Logger.Infof("error when picking custom compaction: %s", err)
+				if last != nil {
+					*last = time.Now()
+				}
+			}
+		} else if pc != nil {
+			return pc
+		}
+	}
+	return p.pickElisionOnlyCompaction(env)
+}
+
+// pickerInfo returns the view of the current version passed to the custom
+// picker. The view is reused by each call.
+func (p *compactionPickerCustom) pickerInfo() *CompactionPickerInfo {
+	p.info = CompactionPickerInfo{
+		LevelSizes: p.levelSizes,
+		BaseLevel:  p.baseLevel,
+		vers:       p.vers,
+	}
+	return &p.info
+}
+
+// pickChoice returns the compaction for the choice of the custom picker. It
+// returns an error if the choice is invalid, and a nil compaction if the
+// choice conflicts with an in-progress compaction.
+func (p *compactionPickerCustom) pickChoice(
+	env compactionEnv, c CompactionChoice,
+) (*pickedCompaction, error) {
+	if c.StartLevel < 0 || c.OutputLevel <= c.StartLevel || c.OutputLevel >= numLevels {
+		return nil, errors.Errorf("invalid levels L%d->L%d", c.StartLevel, c.OutputLevel)
+	}
+	if len(c.Tables) == 0 {
+		return nil, errors.New("no tables")
+	}
+	for level := c.StartLevel + 1; level < c.OutputLevel; level++ {
+		if !p.vers.Levels[level].Empty() {
+			return nil, errors.Errorf("L%d->L%d: L%d is not empty",
+				c.StartLevel, c.OutputLevel, level)
+		}
+		if outputInProgress(env, level) {
+			return nil, nil
+		}
+	}
+
+	tables := make(map[base.FileNum]bool, len(c.Tables))
+	for _, fileNum := range c.Tables {
+		tables[fileNum] = true
+	}
+	var files []*fileMetadata
+	iter := p.vers.Levels[c.StartLevel].Iter()
+	for f := iter.First(); f != nil; f = iter.Next() {
+		if tables[f.FileNum] {
+			files = append(files, f)
+			delete(tables, f.FileNum)
+		}
+	}
+	for _, fileNum := range c.Tables {
+		if tables[fileNum] {
+			return nil, errors.Errorf("%s not found in L%d", fileNum, c.StartLevel)
+		}
+	}
+
+	// The sizes of the output tables are those of the output level when it is
+	// the base level.
+	baseLevel := p.baseLevel
+	if c.StartLevel == 0 {
+		baseLevel = c.OutputLevel
+	}
+	pc := newPickedCompaction(p.opts, p.vers, c.StartLevel, baseLevel)
+	pc.outputLevel.level = c.OutputLevel
+	inputs := manifest.NewLevelSliceSeqSorted(files)
+	smallest, largest := manifest.KeyRange(pc.cmp, inputs.Iter())
+	pc.startLevel.files = p.vers.Overlaps(c.StartLevel, pc.cmp, smallest.UserKey, largest.UserKey)
+	if !pc.setupInputs() || inputRangeAlreadyCompacting(env, pc) {
+		return nil, nil
+	}
+	return pc, nil
+}
+
+// pickReadTriggeredCompaction discards the pending read-triggered
+// compactions, which would compact tables into levels not chosen by the
+// custom picker.
+func (p *compactionPickerCustom) pickReadTriggeredCompaction(
+	env compactionEnv,
+) (pc *pickedCompaction) {
+	if env.readCompactionEnv.readCompactions != nil {
+		*env.readCompactionEnv.readCompactions = nil
+	}
+	return nil
+}
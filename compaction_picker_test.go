@@ -12,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
@@ -1204,3 +1205,285 @@ func TestPickedCompactionExpandInputs(t *testing.T) {
 			}
 		})
 }
+
+func TestCompactionPickerTiered(t *testing.T) {
+	var vers *version
+	var opts *Options
+	var sizes [numLevels]int64
+
+	datadriven.RunTest(t, "testdata/compaction_picker_tiered",
+		func(d *datadriven.TestData) string {
+			switch d.Cmd {
+			case "init":
+				var errMsg string
+				vers, opts, sizes, errMsg = loadVersion(d)
+				if errMsg != "" {
+					return errMsg
+				}
+				opts.CompactionStyle = CompactionStyleTiered
+				// Allow compactions to be picked concurrently with the ongoing
+				// compactions specified by the pick command.
+				opts.Experimental.L0CompactionConcurrency = 1
+				return ""
+
+			case "pick":
+				var inProgress []compactionInfo
+				for _, arg := range d.CmdArgs {
+					switch arg.Key {
+					case "ongoing":
+						var levels []int
+						for _, v := range arg.Vals {
+							l, err := strconv.Atoi(v)
+							require.NoError(t, err)
+							levels = append(levels, l)
+						}
+						inProgress = append(inProgress, compactionInfo{
+							inputs:      []compactionLevel{{level: levels[0]}, {level: levels[1]}},
+							outputLevel: levels[1],
+							largest:     base.MakeInternalKey([]byte("~"), 0, InternalKeyKindSet),
+						})
+					default:
+						return fmt.Sprintf("unknown arg: %s", arg.Key)
+					}
+				}
+
+				p := newCompactionPicker(vers, opts, inProgress, sizes)
+				_, ok := p.(*compactionPickerTiered)
+				require.True(t, ok)
+				pc := p.pickAuto(compactionEnv{
+					earliestUnflushedSeqNum: InternalKeySeqNumMax,
+					earliestSnapshotSeqNum:  InternalKeySeqNumMax,
+					inProgressCompactions:   inProgress,
+				})
+				if pc == nil {
+					return "no compaction"
+				}
+				return fmt.Sprintf("L%d->L%d: %d+%d files\n", pc.startLevel.level, pc.outputLevel.level,
+					pc.startLevel.files.Len(), pc.outputLevel.files.Len())
+
+			default:
+				return fmt.Sprintf("unknown command: %s", d.Cmd)
+			}
+		})
+}
+
+type funcCompactionPicker func(info *CompactionPickerInfo) (CompactionChoice, bool)
+
+func (f funcCompactionPicker) PickCompaction(
+	info *CompactionPickerInfo,
+) (CompactionChoice, bool) {
+	return f(info)
+}
+
+func TestCompactionPickerCustom(t *testing.T) {
+	newFile := func(fileNum FileNum, smallest, largest string, seqNum uint64) *fileMetadata {
+		return &fileMetadata{
+			FileNum:        fileNum,
+			Size:           1,
+			Smallest:       base.MakeInternalKey([]byte(smallest), seqNum, InternalKeyKindSet),
+			Largest:        base.MakeInternalKey([]byte(largest), seqNum, InternalKeyKindSet),
+			SmallestSeqNum: seqNum,
+			LargestSeqNum:  seqNum,
+		}
+	}
+
+	testCases := []struct {
+		choice     CompactionChoice
+		compacting FileNum
+		ongoing    int
+		expected   string
+	}{
+		// The overlapping L0 tables and L3 tables are included.
+		{choice: CompactionChoice{0, 3, []FileNum{1}}, expected: "L0->L3: 000001,000002 + 000004,000005"},
+		{choice: CompactionChoice{0, 1, []FileNum{3}}, expected: "L0->L1: 000003 + "},
+		// The L3 tables are grown to those overlapping the L6 table.
+		{choice: CompactionChoice{3, 6, []FileNum{4}}, expected: "L3->L6: 000004,000005 + 000006"},
+		{choice: CompactionChoice{0, 6, []FileNum{3}}, expected: "L0->L6: L3 is not empty"},
+		{choice: CompactionChoice{3, 6, []FileNum{7}}, expected: "000007 not found in L3"},
+		{choice: CompactionChoice{3, 3, []FileNum{4}}, expected: "invalid levels L3->L3"},
+		{choice: CompactionChoice{3, 4, nil}, expected: "no tables"},
+		{choice: CompactionChoice{0, 3, []FileNum{1}}, compacting: 2, expected: "no compaction"},
+		{choice: CompactionChoice{0, 3, []FileNum{1}}, ongoing: 2, expected: "no compaction"},
+	}
+	for _, tc := range testCases {
+		t.Run("", func(t *testing.T) {
+			var files [numLevels][]*fileMetadata
+			files[0] = []*fileMetadata{
+				newFile(1, "a", "c", 1), newFile(2, "b", "d", 2), newFile(3, "x", "z", 3),
+			}
+			files[3] = []*fileMetadata{newFile(4, "a", "b", 1), newFile(5, "c", "d", 1)}
+			files[6] = []*fileMetadata{newFile(6, "a", "z", 1)}
+			var sizes [numLevels]int64
+			for level := range files {
+				for _, f := range files[level] {
+					f.Compacting = f.FileNum == tc.compacting
+					sizes[level] += int64(f.Size)
+				}
+			}
+			opts := (&Options{}).EnsureDefaults()
+			vers := newVersion(opts, files)
+
+			var inProgress []compactionInfo
+			if tc.ongoing != 0 {
+				inProgress = append(inProgress, compactionInfo{
+					inputs:      []compactionLevel{{level: 0}, {level: tc.ongoing}},
+					outputLevel: tc.ongoing,
+					largest:     base.MakeInternalKey([]byte("~"), 0, InternalKeyKindSet),
+				})
+			}
+			p := newCompactionPicker(vers, opts, inProgress, sizes).(*compactionPickerByScore)
+			cp := &compactionPickerCustom{compactionPickerByScore: p}
+
+			info := cp.pickerInfo()
+			require.Equal(t, sizes, info.LevelSizes)
+			require.Equal(t, p.baseLevel, info.BaseLevel)
+			require.Equal(t, 3, info.NumTables(0))
+			var fileNums []FileNum
+			info.Tables(6, func(t *CompactionPickerTable) bool {
+				fileNums = append(fileNums, t.FileNum)
+				return true
+			})
+			require.Equal(t, []FileNum{6}, fileNums)
+			// The view of the version is built without allocations.
+			require.Zero(t, testing.AllocsPerRun(10, func() {
+				cp.pickerInfo().Tables(0, func(*CompactionPickerTable) bool { return true })
+			}))
+
+			pc, err := cp.pickChoice(compactionEnv{
+				earliestUnflushedSeqNum: InternalKeySeqNumMax,
+				inProgressCompactions:   inProgress,
+			}, tc.choice)
+			var result string
+			switch {
+			case err != nil:
+				result = err.Error()
+			case pc == nil:
+				result = "no compaction"
+			default:
+				var inputs [2][]string
+				for i, cl := range []compactionLevel{*pc.startLevel, *pc.outputLevel} {
+					iter := cl.files.Iter()
+					for f := iter.First(); f != nil; f = iter.Next() {
+						inputs[i] = append(inputs[i], f.FileNum.String())
+					}
+					sort.Strings(inputs[i])
+				}
+				result = fmt.Sprintf("L%d->L%d: %s + %s", pc.startLevel.level, pc.outputLevel.level,
+					strings.Join(inputs[0], ","), strings.Join(inputs[1], ","))
+			}
+			require.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestCompactionPickerCustomInvalidLog(t *testing.T) {
+	var log syncedBuffer
+	opts := (&Options{Logger: &log}).EnsureDefaults()
+	opts.CompactionPicker = funcCompactionPicker(func(*CompactionPickerInfo) (CompactionChoice, bool) {
+		return CompactionChoice{StartLevel: 3, OutputLevel: 3}, true
+	})
+	var files [numLevels][]*fileMetadata
+	p := newCompactionPicker(newVersion(opts, files), opts, nil, [numLevels]int64{})
+
+	// An invalid choice is logged at most once per invalidPickLogInterval.
+	var lastLog time.Time
+	env := compactionEnv{
+		earliestUnflushedSeqNum: InternalKeySeqNumMax,
+		invalidPickLogTime:      &lastLog,
+	}
+	for i := 0; i < 3; i++ {
+		require.Nil(t, p.pickAuto(env))
+	}
+	require.Equal(t, "error when picking custom compaction: invalid levels L3->L3\n", log.String())
+	lastLog = lastLog.Add(-invalidPickLogInterval)
+	require.Nil(t, p.pickAuto(env))
+	require.Equal(t, 2, strings.Count(log.String(), "\n"))
+}
+
+func TestCompactionPickerPeriodicCompaction(t *testing.T) {
+	older := time.Now().Add(-3 * time.Hour).Unix()
+	old := time.Now().Add(-2 * time.Hour).Unix()
+	recent := time.Now().Unix()
+	newFile := func(fileNum FileNum, smallest, largest string, seqNum uint64, creationTime int64) *fileMetadata {
+		return &fileMetadata{
+			FileNum:        fileNum,
+			Size:           1,
+			Smallest:       base.MakeInternalKey([]byte(smallest), seqNum, InternalKeyKindSet),
+			Largest:        base.MakeInternalKey([]byte(largest), seqNum, InternalKeyKindSet),
+			SmallestSeqNum: seqNum,
+			LargestSeqNum:  seqNum,
+			CreationTime:   creationTime,
+		}
+	}
+
+	testCases := []struct {
+		creationTimes [5]int64
+		compacting    FileNum
+		expected      string
+	}{
+		{creationTimes: [5]int64{recent, recent, recent, recent, recent}, expected: "no compaction"},
+		// Tables with an unknown creation time are not compacted.
+		{creationTimes: [5]int64{0, 0, 0, 0, recent}, expected: "no compaction"},
+		// The overlapping L0 tables are included.
+		{creationTimes: [5]int64{old, recent, recent, old, recent}, expected: "L0->L4: 000001,000002 + 000003"},
+		{creationTimes: [5]int64{recent, recent, old, old, recent}, expected: "L4->L5: 000003 + "},
+		{creationTimes: [5]int64{recent, recent, recent, old, recent}, expected: "L6->L6: 000004 + "},
+		// Compacting tables are skipped.
+		{creationTimes: [5]int64{recent, recent, old, old, recent}, compacting: 3, expected: "L6->L6: 000004 + "},
+		{creationTimes: [5]int64{old, recent, recent, old, recent}, compacting: 1, expected: "L6->L6: 000004 + "},
+		// A compacting table does not hide an older table in the same level.
+		{creationTimes: [5]int64{recent, recent, recent, older, old}, compacting: 4, expected: "L6->L6: 000005 + "},
+	}
+	for _, tc := range testCases {
+		t.Run("", func(t *testing.T) {
+			var files [numLevels][]*fileMetadata
+			files[0] = []*fileMetadata{
+				newFile(1, "a", "c", 3, tc.creationTimes[0]), newFile(2, "b", "d", 4, tc.creationTimes[1]),
+			}
+			files[4] = []*fileMetadata{newFile(3, "a", "d", 2, tc.creationTimes[2])}
+			files[6] = []*fileMetadata{
+				newFile(4, "a", "m", 1, tc.creationTimes[3]), newFile(5, "n", "z", 1, tc.creationTimes[4]),
+			}
+			var sizes [numLevels]int64
+			for level := range files {
+				for _, f := range files[level] {
+					f.Compacting = f.FileNum == tc.compacting
+					sizes[level] += int64(f.Size)
+				}
+			}
+			opts := (&Options{}).EnsureDefaults()
+			opts.Experimental.PeriodicCompactionAge = time.Hour
+			vers := newVersion(opts, files)
+			var inProgress []compactionInfo
+			if tc.compacting != 0 {
+				inProgress = append(inProgress, compactionInfo{
+					inputs:      []compactionLevel{{level: 0}, {level: 4}},
+					outputLevel: 4,
+					smallest:    base.MakeInternalKey([]byte("a"), 0, InternalKeyKindSet),
+					largest:     base.MakeInternalKey([]byte("d"), 0, InternalKeyKindSet),
+				})
+			}
+			p := newCompactionPicker(vers, opts, inProgress, sizes).(*compactionPickerByScore)
+
+			pc := p.pickPeriodicCompaction(compactionEnv{
+				earliestUnflushedSeqNum: InternalKeySeqNumMax,
+				earliestSnapshotSeqNum:  InternalKeySeqNumMax,
+				inProgressCompactions:   inProgress,
+			})
+			result := "no compaction"
+			if pc != nil {
+				var inputs [2][]string
+				for i, cl := range []compactionLevel{*pc.startLevel, *pc.outputLevel} {
+					iter := cl.files.Iter()
+					for f := iter.First(); f != nil; f = iter.Next() {
+						inputs[i] = append(inputs[i], f.FileNum.String())
+					}
+					sort.Strings(inputs[i])
+				}
+				result = fmt.Sprintf("L%d->L%d: %s + %s", pc.startLevel.level, pc.outputLevel.level,
+					strings.Join(inputs[0], ","), strings.Join(inputs[1], ","))
+			}
+			require.Equal(t, tc.expected, result)
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2021 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+// tieredSizeRatio is the maximum ratio of the size of a sorted run to the size
+// of the newer run above it at which a tiered compaction merges the two runs.
+const tieredSizeRatio = 2
+
+// compactionPickerTiered picks automatic compactions for
+// CompactionStyleTiered. Each non-empty level below L0 holds a sorted run, and
+// runs in lower numbered levels are newer. L0 is compacted in its entirety
+// into the empty level directly above the newest run, where it forms a new
+// run, or into L1 if L1 is not empty. Two adjacent runs are merged into the
+// level of the older run once the older run is no more than tieredSizeRatio
+// times the size of the newer run.
+//
+// Manual and elision-only compactions, and the scores and compaction debt
+// reported in metrics, are those of compactionPickerByScore.
+type compactionPickerTiered struct {
+	*compactionPickerByScore
+}
+
+var _ compactionPicker = &compactionPickerTiered{}
+
+// pickAuto picks the best compaction, if any. An L0 compaction is preferred
+// over merging runs, as L0 is where read-amplification grows quickest.
+func (p *compactionPickerTiered) pickAuto(env compactionEnv) (pc *pickedCompaction) {
+	if !p.allowConcurrentCompaction(env) {
+		return nil
+	}
+
+	if info := p.calculateL0Score(env.inProgressCompactions); info.score >= 1 {
+		if pc := p.pickL0(env); pc != nil {
+			pc.score = info.score
+			return pc
+		}
+	}
+	if pc := p.pickRunMerge(env); pc != nil {
+		return pc
+	}
+	if pc := p.pickElisionOnlyCompaction(env); pc != nil {
+		return pc
+	}
+	return p.pickReadTriggeredCompaction(env)
+}
+
+// pickL0 picks a compaction of all of L0 into a new run in the empty level
+// directly above the newest run, or into L1 if L1 is not empty. An empty level
+// which is the output of an in-progress compaction is treated as a run.
+func (p *compactionPickerTiered) pickL0(env compactionEnv) *pickedCompaction {
+	if p.vers.Levels[0].Empty() {
+		return nil
+	}
+	outputLevel := numLevels - 1
+	for level := 1; level < numLevels; level++ {
+		if !p.vers.Levels[level].Empty() || outputInProgress(env, level) {
+			outputLevel = level - 1
+			if outputLevel == 0 {
+				outputLevel = 1
+			}
+			break
+		}
+	}
+
+	pc := newPickedCompaction(p.opts, p.vers, 0, outputLevel)
+	pc.startLevel.files = p.vers.Levels[0].Slice()
+	if !pc.setupInputs() || inputRangeAlreadyCompacting(env, pc) {
+		return nil
+	}
+	return pc
+}
+
+// pickRunMerge picks a compaction merging the newest run whose next older run
+// is within tieredSizeRatio of its size into the level of the older run.
+func (p *compactionPickerTiered) pickRunMerge(env compactionEnv) *pickedCompaction {
+	newer := -1
+	for level := 1; level < numLevels; level++ {
+		if p.vers.Levels[level].Empty() {
+			continue
+		}
+		if newer != -1 && p.levelSizes[level] <= tieredSizeRatio*p.levelSizes[newer] {
+			pc := newPickedCompaction(p.opts, p.vers, newer, p.baseLevel)
+			pc.outputLevel.level = level
+			pc.startLevel.files = p.vers.Levels[newer].Slice()
+			if pc.setupInputs() && !inputRangeAlreadyCompacting(env, pc) {
+				pc.score = float64(p.levelSizes[newer]) / float64(p.levelSizes[level])
+				return pc
+			}
+		}
+		newer = level
+	}
+	return nil
+}
+
+// pickReadTriggeredCompaction discards the pending read-triggered
+// compactions. Read-triggered compactions compact individual tables into the
+// next level, which would split a run across levels.
+func (p *compactionPickerTiered) pickReadTriggeredCompaction(
+	env compactionEnv,
+) (pc *pickedCompaction) {
+	if env.readCompactionEnv.readCompactions != nil {
+		*env.readCompactionEnv.readCompactions = nil
+	}
+	return nil
+}
+
+// outputInProgress returns true if an in-progress compaction outputs to the
+// specified level.
+func outputInProgress(env compactionEnv, level int) bool {
+	for i := range env.inProgressCompactions {
+		if env.inProgressCompactions[i].outputLevel == level {
+			return true
+		}
+	}
+	return false
+}
@@ -1111,7 +1111,11 @@ func TestManualCompaction(t *testing.T) {
 			return ""
 
 		case "set-concurrent-compactions":
-			td.ScanArgs(t, "num", &d.opts.MaxConcurrentCompactions)
+			var num int
+			td.ScanArgs(t, "num", &num)
+			d.mu.Lock()
+			d.mu.compact.maxConcurrent = num
+			d.mu.Unlock()
 			return ""
 
 		case "wait-pending-table-stats":
@@ -2504,3 +2508,335 @@ func TestCompactionInvalidBounds(t *testing.T) {
 	require.Error(t, db.Compact([]byte("a"), []byte("a")))
 	require.Error(t, db.Compact([]byte("b"), []byte("a")))
 }
+
+func TestCompactionSubcompactions(t *testing.T) {
+	key := func(i int) []byte { return []byte(fmt.Sprintf("%04d", i)) }
+	value := func(i, gen int) []byte {
+		return []byte(fmt.Sprintf("%04d-%d-%s", i, gen, strings.Repeat("x", 100)))
+	}
+
+	run := func(t *testing.T, maxSubcompactions, maxConcurrent int) map[string]string {
+		var d *DB
+		// The largest number of compactions observed running, including
+		// subcompactions.
+		var maxCompacting int
+		opts := &Options{
+			DebugCheck: DebugCheckLevels,
+			EventListener: EventListener{
+				TableCreated: func(info TableCreateInfo) {
+					d.mu.Lock()
+					defer d.mu.Unlock()
+					if d.mu.compact.compactingCount > maxCompacting {
+						maxCompacting = d.mu.compact.compactingCount
+					}
+				},
+			},
+			FS:                       vfs.NewMem(),
+			Levels:                   make([]LevelOptions, numLevels),
+			MaxConcurrentCompactions: maxConcurrent,
+		}
+		for i := range opts.Levels {
+			opts.Levels[i].TargetFileSize = 4 << 10
+		}
+		opts.Experimental.MaxSubcompactions = maxSubcompactions
+		opts.private.disableAutomaticCompactions = true
+		var err error
+		d, err = Open("", opts)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, d.Close()) }()
+
+		// Populate the output level, which is split into many tables.
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, d.Set(key(i), value(i, 0), nil))
+		}
+		require.NoError(t, d.Compact(key(0), key(1000)))
+
+		// Write a flushed table which overlaps all of the output level's tables,
+		// including range deletions which straddle subcompaction boundaries.
+		for i := 0; i < 1000; i += 3 {
+			require.NoError(t, d.Set(key(i), value(i, 1), nil))
+		}
+		for i := 1; i < 1000; i += 7 {
+			require.NoError(t, d.Delete(key(i), nil))
+		}
+		for i := 0; i < 1000; i += 200 {
+			require.NoError(t, d.DeleteRange(key(i+90), key(i+120), nil))
+		}
+		require.NoError(t, d.Flush())
+
+		d.mu.Lock()
+		v := d.mu.versions.currentVersion()
+		c := &compaction{
+			kind: compactionKindDefault,
+			cmp:  d.cmp,
+			inputs: []compactionLevel{
+				{level: 0, files: v.Levels[0].Slice()},
+				{level: numLevels - 1, files: v.Levels[numLevels-1].Slice()},
+			},
+			maxOutputFileSize: 4 << 10,
+			smallest:          base.MakeInternalKey(key(0), 0, InternalKeyKindSet),
+		}
+		c.startLevel, c.outputLevel = &c.inputs[0], &c.inputs[1]
+		bounds := c.subcompactionBounds(maxSubcompactions)
+		d.mu.Unlock()
+		if maxSubcompactions > 1 {
+			require.Len(t, bounds, maxSubcompactions-1)
+		} else {
+			require.Empty(t, bounds)
+		}
+
+		require.NoError(t, d.Compact(key(0), key(1000)))
+		d.mu.Lock()
+		require.Equal(t, 0, d.mu.versions.currentVersion().Levels[0].Len())
+		// The subcompactions are limited by the free compaction slots, and
+		// release their slots when they finish.
+		require.Equal(t, 0, d.mu.compact.compactingCount)
+		d.mu.Unlock()
+		expectedCompacting := maxSubcompactions
+		if expectedCompacting > maxConcurrent {
+			expectedCompacting = maxConcurrent
+		}
+		require.Equal(t, expectedCompacting, maxCompacting)
+
+		contents := make(map[string]string)
+		iter := d.NewIter(nil)
+		for iter.First(); iter.Valid(); iter.Next() {
+			contents[string(iter.Key())] = string(iter.Value())
+		}
+		require.NoError(t, iter.Close())
+		return contents
+	}
+
+	expected := run(t, 1, 1)
+	for i := 0; i < 1000; i++ {
+		v, ok := expected[string(key(i))]
+		switch {
+		case i%200 >= 90 && i%200 < 120:
+			require.False(t, ok, "%d", i)
+		case i%7 == 1:
+			require.False(t, ok, "%d", i)
+		case i%3 == 0:
+			require.Equal(t, string(value(i, 1)), v)
+		default:
+			require.Equal(t, string(value(i, 0)), v)
+		}
+	}
+	require.Equal(t, expected, run(t, 4, 4))
+	require.Equal(t, expected, run(t, 4, 2))
+}
+
+type testCompactionFilter struct {
+	levels map[int]bool
+}
+
+func (f *testCompactionFilter) Filter(
+	level int, key, value []byte,
+) (CompactionFilterDecision, []byte) {
+	f.levels[level] = true
+	switch {
+	case bytes.HasPrefix(value, []byte("expired")):
+		return CompactionFilterRemove, nil
+	case bytes.HasPrefix(value, []byte("v1:")):
+		return CompactionFilterChangeValue, append([]byte("v2:"), value[3:]...)
+	}
+	return CompactionFilterKeep, nil
+}
+
+func TestCompactionFilter(t *testing.T) {
+	filter := &testCompactionFilter{levels: make(map[int]bool)}
+	opts := &Options{
+		CompactionFilter: func() CompactionFilter { return filter },
+		DebugCheck:       DebugCheckLevels,
+		FS:               vfs.NewMem(),
+	}
+	opts.private.disableAutomaticCompactions = true
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	get := func(r Reader, key string) string {
+		v, closer, err := r.Get([]byte(key))
+		if err == ErrNotFound {
+			return "<not-found>"
+		}
+		require.NoError(t, err)
+		defer closer.Close()
+		return string(v)
+	}
+
+	// An older value of "a" in a lower level must not become visible when the
+	// newer value is removed by the filter.
+	require.NoError(t, d.Set([]byte("a"), []byte("old"), nil))
+	require.NoError(t, d.Compact([]byte("a"), []byte("b")))
+
+	require.NoError(t, d.Set([]byte("d"), []byte("expired"), nil))
+	snap := d.NewSnapshot()
+	defer snap.Close()
+	require.NoError(t, d.Set([]byte("a"), []byte("expired"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("v1:b"), nil))
+	require.NoError(t, d.Set([]byte("c"), []byte("c"), nil))
+	require.NoError(t, d.Merge([]byte("c"), []byte("d"), nil))
+	require.NoError(t, d.Set([]byte("e"), []byte("expired"), nil))
+
+	// Flushes are not filtered.
+	require.NoError(t, d.Flush())
+	require.Equal(t, "expired", get(d, "a"))
+
+	require.NoError(t, d.Compact([]byte("a"), []byte("f")))
+	require.Equal(t, "<not-found>", get(d, "a"))
+	require.Equal(t, "v2:b", get(d, "b"))
+	require.Equal(t, "cd", get(d, "c"))
+	// Keys visible to the snapshot are not filtered.
+	require.Equal(t, "expired", get(d, "d"))
+	require.Equal(t, "expired", get(snap, "d"))
+	require.Equal(t, "<not-found>", get(d, "e"))
+	require.Equal(t, "old", get(snap, "a"))
+
+	require.False(t, filter.levels[0])
+	require.NotEmpty(t, filter.levels)
+}
+
+func TestCompactionRateLimit(t *testing.T) {
+	opts := &Options{
+		DebugCheck: DebugCheckLevels,
+		FS:         vfs.NewMem(),
+	}
+	opts.Experimental.MaxCompactionRate = 1 << 30
+	opts.private.disableAutomaticCompactions = true
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	require.NotNil(t, d.compactionRateLimiter)
+
+	limiter := &mockCountLimiter{burst: 1 << 10}
+	d.compactionRateLimiter = limiter
+
+	// Write two overlapping tables, so that they are not trivially moved.
+	for j := 0; j < 2; j++ {
+		for i := 0; i < 100; i++ {
+			key := []byte(fmt.Sprintf("%03d", i))
+			require.NoError(t, d.Set(key, bytes.Repeat(key, 100), nil))
+		}
+		// Flushes are not limited.
+		require.NoError(t, d.Flush())
+	}
+	require.Zero(t, limiter.waitCount)
+
+	require.NoError(t, d.Compact([]byte("000"), []byte("100")))
+	m := d.Metrics()
+	written := int(m.Levels[numLevels-1].BytesCompacted)
+	require.Less(t, written, limiter.waitCount)
+}
+
+func TestCompactionPickerOption(t *testing.T) {
+	// The picker compacts L0 into L6 once L0 holds two tables.
+	picker := funcCompactionPicker(func(info *CompactionPickerInfo) (CompactionChoice, bool) {
+		if info.NumTables(0) < 2 {
+			return CompactionChoice{}, false
+		}
+		c := CompactionChoice{StartLevel: 0, OutputLevel: numLevels - 1}
+		compacting := false
+		info.Tables(0, func(t *CompactionPickerTable) bool {
+			compacting = t.Compacting
+			c.Tables = append(c.Tables, t.FileNum)
+			return !compacting
+		})
+		return c, !compacting
+	})
+	d, err := Open("", &Options{
+		CompactionPicker: picker,
+		DebugCheck:       DebugCheckLevels,
+		FS:               vfs.NewMem(),
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("%d", i)), nil, nil))
+		require.NoError(t, d.Flush())
+	}
+	d.mu.Lock()
+	for d.mu.compact.compactingCount > 0 {
+		d.mu.compact.cond.Wait()
+	}
+	d.mu.Unlock()
+
+	m := d.Metrics()
+	require.Zero(t, m.Levels[0].NumFiles)
+	for level := 1; level < numLevels-1; level++ {
+		require.Zero(t, m.Levels[level].NumFiles)
+	}
+	require.NotZero(t, m.Levels[numLevels-1].NumFiles)
+}
+
+func TestCompactionOutputSplitKey(t *testing.T) {
+	// Split tables before each change of the first byte of the user key.
+	d, err := Open("", &Options{
+		DebugCheck: DebugCheckLevels,
+		FS:         vfs.NewMem(),
+		OutputSplitKey: func(key []byte) []byte {
+			return []byte{key[0] + 1}
+		},
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	tableBounds := func() string {
+		tables, err := d.SSTables()
+		require.NoError(t, err)
+		var buf strings.Builder
+		for level := range tables {
+			for _, table := range tables[level] {
+				fmt.Fprintf(&buf, "L%d: %s-%s\n", level, table.Smallest.UserKey, table.Largest.UserKey)
+			}
+		}
+		return buf.String()
+	}
+
+	for _, k := range []string{"a1", "a2", "b1", "c1", "c2"} {
+		require.NoError(t, d.Set([]byte(k), nil, nil))
+	}
+	require.NoError(t, d.Flush())
+	require.Equal(t, "L0: a1-a2\nL0: b1-b1\nL0: c1-c2\n", tableBounds())
+
+	require.NoError(t, d.Compact([]byte("a"), []byte("d")))
+	require.Equal(t, "L6: a1-a2\nL6: b1-b1\nL6: c1-c2\n", tableBounds())
+}
+
+func TestDisableAutomaticCompactions(t *testing.T) {
+	d, err := Open("", &Options{
+		DebugCheck:            DebugCheckLevels,
+		FS:                    vfs.NewMem(),
+		L0CompactionThreshold: 2,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Calls nest.
+	d.DisableAutomaticCompactions()
+	d.DisableAutomaticCompactions()
+	for i := 0; i < 4; i++ {
+		require.NoError(t, d.Set([]byte("a"), nil, nil))
+		require.NoError(t, d.Flush())
+	}
+	d.WaitForBackgroundWork()
+	require.EqualValues(t, 4, d.Metrics().Levels[0].NumFiles)
+
+	// Manual compactions are still performed.
+	require.NoError(t, d.Compact([]byte("a"), []byte("b")))
+	require.EqualValues(t, 0, d.Metrics().Levels[0].NumFiles)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, d.Set([]byte("a"), nil, nil))
+		require.NoError(t, d.Flush())
+	}
+
+	d.EnableAutomaticCompactions()
+	d.WaitForBackgroundWork()
+	require.EqualValues(t, 4, d.Metrics().Levels[0].NumFiles)
+
+	d.EnableAutomaticCompactions()
+	d.WaitForBackgroundWork()
+	require.EqualValues(t, 0, d.Metrics().Levels[0].NumFiles)
+
+	require.Panics(t, d.EnableAutomaticCompactions)
+}
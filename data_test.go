@@ -395,6 +395,18 @@ func runDBDefineCmd(td *datadriven.TestData, opts *Options) (*DB, error) {
 				}
 				levelMaxBytes[level] = size
 			}
+		case "tombstone-dense-compaction-ratio":
+			ratio, err := strconv.ParseFloat(arg.Vals[0], 64)
+			if err != nil {
+				return nil, err
+			}
+			opts.Experimental.TombstoneDenseCompactionRatio = ratio
+		case "tombstone-dense-compaction-min-deletions":
+			n, err := strconv.Atoi(arg.Vals[0])
+			if err != nil {
+				return nil, err
+			}
+			opts.Experimental.TombstoneDenseCompactionMinDeletions = n
 		case "auto-compactions":
 			switch arg.Vals[0] {
 			case "off":
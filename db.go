@@ -6,12 +6,15 @@
 package pebble // import "github.com/cockroachdb/pebble"
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"runtime"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
+	"unsafe"
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/arenaskl"
@@ -223,12 +226,24 @@ type DB struct {
 	// updates.
 	logRecycler logRecycler
 
+	// memTableRecycle holds a pointer to an obsolete memtable whose arena can
+	// be reused by the next memtable allocation. It is accessed atomically and
+	// is nil if there is no memtable available for recycling.
+	memTableRecycle unsafe.Pointer // *memTable
+	// memTableReservedMu serializes the updates of d.atomic.memTableReserved
+	// reported to Options.Experimental.MemTableReservationChanged, so that the
+	// callback observes them in the order in which they are made.
+	memTableReservedMu sync.Mutex
+
 	closed   atomic.Value
 	closedCh chan struct{}
 
 	compactionLimiter limiter
 	flushLimiter      limiter
 	deletionLimiter   limiter
+	// compactionRateLimiter enforces Options.Experimental.MaxCompactionRate. It
+	// is nil if the compaction rate is unlimited.
+	compactionRateLimiter limiter
 
 	// Async deletion jobs spawned by cleaners increment this WaitGroup, and
 	// call Done when completed. Once `d.mu.cleaning` is false, the db.Close()
@@ -309,6 +324,13 @@ type DB struct {
 			flushing bool
 			// The number of ongoing compactions.
 			compactingCount int
+			// The maximum number of concurrent compactions. Initialized from
+			// Options.MaxConcurrentCompactions, and adjustable with
+			// DB.SetMaxConcurrentCompactions.
+			maxConcurrent int
+			// The number of calls to DB.DisableAutomaticCompactions not yet
+			// matched by a call to DB.EnableAutomaticCompactions.
+			automaticDisabled int
 			// The list of deletion hints, suggesting ranges for delete-only
 			// compactions.
 			deletionHints []deleteCompactionHint
@@ -320,6 +342,9 @@ type DB struct {
 			// readCompactions is a list of read triggered compactions. The next
 			// compaction to perform is as the start. New entries are added to the end.
 			readCompactions []readCompaction
+			// invalidPickLogTime is the time at which an invalid compaction
+			// picked by Options.CompactionPicker was last logged.
+			invalidPickLogTime time.Time
 		}
 
 		cleaner struct {
@@ -374,10 +399,19 @@ var _ Writer = (*DB)(nil)
 // slice will remain valid until the returned Closer is closed. On success, the
 // caller MUST call closer.Close() or a memory leak will occur.
 func (d *DB) Get(key []byte) ([]byte, io.Closer, error) {
-	return d.getInternal(key, nil /* batch */, nil /* snapshot */)
+	return d.getInternal(context.Background(), key, nil /* batch */, nil /* snapshot */)
+}
+
+// GetWithContext is like Get, but returns the context's error if the context
+// is canceled or its deadline is exceeded before the read completes. The
+// context is checked before each sstable block is loaded.
+func (d *DB) GetWithContext(ctx context.Context, key []byte) ([]byte, io.Closer, error) {
+	return d.getInternal(ctx, key, nil /* batch */, nil /* snapshot */)
 }
 
-func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer, error) {
+func (d *DB) getInternal(
+	ctx context.Context, key []byte, b *Batch, s *Snapshot,
+) ([]byte, io.Closer, error) {
 	if err := d.closed.Load(); err != nil {
 		panic(err)
 	}
@@ -396,12 +430,13 @@ func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer,
 		seqNum = atomic.LoadUint64(&d.mu.versions.atomic.visibleSeqNum)
 	}
 
-	var buf struct {
-		dbi Iterator
-		get getIter
-	}
+	// Bundle various structures under a single umbrella in order to allocate
+	// them together.
+	buf := getIterAllocPool.Get().(*getIterAlloc)
 
 	get := &buf.get
+	*get = getIter{}
+	get.ctx = ctx
 	get.logger = d.opts.Logger
 	get.cmp = d.cmp
 	get.equal = d.equal
@@ -424,12 +459,16 @@ func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer,
 	}
 
 	i := &buf.dbi
-	i.cmp = d.cmp
-	i.equal = d.equal
-	i.merge = d.merge
-	i.split = d.split
-	i.iter = get
-	i.readState = readState
+	*i = Iterator{
+		getIterAlloc: buf,
+		cmp:          d.cmp,
+		equal:        d.equal,
+		iter:         get,
+		merge:        d.merge,
+		split:        d.split,
+		readState:    readState,
+		keyBuf:       buf.keyBuf,
+	}
 
 	if !i.First() {
 		err := i.Close()
@@ -441,6 +480,81 @@ func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer,
 	return i.Value(), i, nil
 }
 
+// MultiGet looks up the values for the given keys, calling fn with the index
+// in keys and the value of each key found. Keys which are not found are
+// skipped. fn is called in key order, which need not be the order of keys.
+// The value passed to fn is only valid for the duration of the call. If fn
+// returns an error, MultiGet stops and returns the error.
+//
+// All of the keys are read from the same state of the DB. Rather than looking
+// up each key in turn, MultiGet sorts the keys and examines each memtable and
+// level for all of them at once. The keys which may be in an sstable are
+// looked up together: the sstable's filter and index blocks are probed once
+// for the keys, and runs of adjacent data blocks which are not cached are
+// read with a single read.
+func (d *DB) MultiGet(keys [][]byte, fn func(i int, value []byte) error) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	switch len(keys) {
+	case 0:
+		return nil
+	case 1:
+		// A single key is looked up more cheaply by Get.
+		value, closer, err := d.Get(keys[0])
+		if err != nil {
+			if err == ErrNotFound {
+				return nil
+			}
+			return err
+		}
+		err = fn(0, value)
+		return firstError(err, closer.Close())
+	}
+
+	// Grab and reference the current readState, as Get does.
+	readState := d.loadReadState()
+	defer readState.unref()
+
+	m := &multiGet{
+		cmp:        d.cmp,
+		equal:      d.equal,
+		merge:      d.merge,
+		snapshot:   atomic.LoadUint64(&d.mu.versions.atomic.visibleSeqNum),
+		readState:  readState,
+		tableCache: &d.tableCache,
+	}
+	// Allocate the per-key state and the lists of keys together.
+	n := len(keys)
+	state := make([]multiGetKey, n)
+	lists := make([]*multiGetKey, 3*n)
+	sorted := lists[:n:n]
+	m.pending = lists[n : 2*n : 2*n]
+	m.group = lists[2*n : 2*n]
+	m.groupKeys = make([][]byte, 0, n)
+	for i := range state {
+		state[i].index = i
+		state[i].key = keys[i]
+		sorted[i] = &state[i]
+	}
+	sort.Slice(sorted, func(a, b int) bool {
+		return d.cmp(sorted[a].key, sorted[b].key) < 0
+	})
+	copy(m.pending, sorted)
+	if err := m.run(); err != nil {
+		return err
+	}
+	for _, k := range sorted {
+		if !k.found {
+			continue
+		}
+		if err := fn(k.index, m.buf[k.valueOffset:k.valueOffset+k.valueLen]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Set sets the value for the given key. It overwrites any previous value
 // for that key; a DB is not a multi-map.
 //
@@ -544,6 +658,7 @@ func (d *DB) Apply(batch *Batch, opts *WriteOptions) error {
 	if err := d.closed.Load(); err != nil {
 		panic(err)
 	}
+	start := time.Now()
 	if atomic.LoadUint32(&batch.applied) != 0 {
 		panic("pebble: batch already applied")
 	}
@@ -555,7 +670,8 @@ func (d *DB) Apply(batch *Batch, opts *WriteOptions) error {
 	}
 
 	sync := opts.GetSync()
-	if sync && d.opts.DisableWAL {
+	batch.disableWAL = d.opts.DisableWAL || opts.GetDisableWAL()
+	if sync && batch.disableWAL {
 		return errors.New("pebble: WAL disabled")
 	}
 
@@ -565,11 +681,17 @@ func (d *DB) Apply(batch *Batch, opts *WriteOptions) error {
 	if int(batch.memTableSize) >= d.largeBatchThreshold {
 		batch.flushable = newFlushableBatch(batch, d.opts.Comparer)
 	}
+	if d.opts.Experimental.WALCompression && !batch.disableWAL {
+		// Compress the batch before entering the commit pipeline, which
+		// serializes writes to the WAL.
+		batch.compressWAL()
+	}
 	if err := d.commit.Commit(batch, sync); err != nil {
 		// There isn't much we can do on an error here. The commit pipeline will be
 		// horked at this point.
 		d.opts.Logger.Fatalf("%v", err)
 	}
+	batch.commitStats.TotalDuration = time.Since(start)
 	// If this is a large batch, we need to clear the batch contents as the
 	// flushable batch may still be present in the flushables queue.
 	//
@@ -583,6 +705,33 @@ func (d *DB) Apply(batch *Batch, opts *WriteOptions) error {
 	return nil
 }
 
+// ApplyGroup atomically applies the operations contained in the batches to the
+// DB, in order, as if they were a single batch. The operations are assigned a
+// contiguous range of sequence numbers and written to the WAL as a single
+// record, so the group requires a single WAL sync when opts.Sync is true. This
+// is useful for writers which build batches independently, such as one per
+// shard, but want a single durability point for all of them.
+//
+// The batches are not modified, and remain owned by the caller. It is safe to
+// modify the contents of the arguments after ApplyGroup returns.
+func (d *DB) ApplyGroup(batches []*Batch, opts *WriteOptions) error {
+	b := newBatch(d)
+	for _, batch := range batches {
+		if batch.db != nil && batch.db != d {
+			panic(fmt.Sprintf("pebble: batch db mismatch: %p != %p", batch.db, d))
+		}
+		if err := b.Apply(batch, nil); err != nil {
+			return err
+		}
+	}
+	if err := d.Apply(b, opts); err != nil {
+		return err
+	}
+	// Only release the batch on success.
+	b.release()
+	return nil
+}
+
 func (d *DB) commitApply(b *Batch, mem *memTable) error {
 	if b.flushable != nil {
 		// This is a large batch which was already added to the immutable queue.
@@ -598,10 +747,23 @@ func (d *DB) commitApply(b *Batch, mem *memTable) error {
 	// may be reclaimed without additional writes or an explicit flush.
 	if b.countRangeDels > 0 && d.opts.Experimental.DeleteRangeFlushDelay > 0 {
 		d.mu.Lock()
-		d.maybeScheduleDelayedFlush(mem)
+		d.maybeScheduleDelayedFlush(mem, d.opts.Experimental.DeleteRangeFlushDelay)
 		d.mu.Unlock()
 	}
 
+	// If the memtable is dominated by point tombstones, flush it early so that
+	// the space occupied by the deleted data can be reclaimed sooner.
+	ratio := d.opts.Experimental.MemTableTombstoneFlushRatio
+	if ratio > 0 && atomic.LoadUint32(&mem.tombstoneFlushScheduled) == 0 {
+		r, n := mem.pointTombstoneRatio()
+		if r >= ratio && int(n) >= d.opts.Experimental.MemTableTombstoneFlushMinRecords &&
+			atomic.CompareAndSwapUint32(&mem.tombstoneFlushScheduled, 0, 1) {
+			d.mu.Lock()
+			d.maybeScheduleDelayedFlush(mem, 0)
+			d.mu.Unlock()
+		}
+	}
+
 	if mem.writerUnref() {
 		d.mu.Lock()
 		d.maybeScheduleFlush()
@@ -625,12 +787,14 @@ func (d *DB) commitWrite(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*mem
 		// Set the sequence number since it was not set to the correct value earlier
 		// (see comment in newFlushableBatch()).
 		b.flushable.setSeqNum(b.SeqNum())
-		if !d.opts.DisableWAL {
+		if !b.disableWAL {
+			start := time.Now()
 			var err error
-			size, err = d.mu.log.SyncRecord(repr, syncWG, syncErr)
+			size, err = d.writeWAL(b, syncWG, syncErr)
 			if err != nil {
 				panic(err)
 			}
+			b.commitStats.WALWriteDuration += time.Since(start)
 		}
 	}
 
@@ -639,7 +803,7 @@ func (d *DB) commitWrite(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*mem
 	// Switch out the memtable if there was not enough room to store the batch.
 	err := d.makeRoomForWrite(b)
 
-	if err == nil && !d.opts.DisableWAL {
+	if err == nil && !b.disableWAL {
 		d.mu.log.bytesIn += uint64(len(repr))
 	}
 
@@ -654,21 +818,45 @@ func (d *DB) commitWrite(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*mem
 		return nil, err
 	}
 
-	if d.opts.DisableWAL {
+	if b.disableWAL {
 		return mem, nil
 	}
 
 	if b.flushable == nil {
-		size, err = d.mu.log.SyncRecord(repr, syncWG, syncErr)
+		start := time.Now()
+		size, err = d.writeWAL(b, syncWG, syncErr)
 		if err != nil {
 			panic(err)
 		}
+		b.commitStats.WALWriteDuration += time.Since(start)
 	}
 
 	atomic.StoreUint64(&d.atomic.logSize, uint64(size))
 	return mem, err
 }
 
+// writeWAL writes the batch to the WAL, compressed if the batch was compressed
+// by compressWAL.
+func (d *DB) writeWAL(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (int64, error) {
+	p, compressed := b.walRecord()
+	if compressed {
+		return d.mu.log.SyncCompressedRecord(p, syncWG, syncErr)
+	}
+	return d.mu.log.SyncRecord(p, syncWG, syncErr)
+}
+
+type getIterAlloc struct {
+	dbi    Iterator
+	keyBuf []byte
+	get    getIter
+}
+
+var getIterAllocPool = sync.Pool{
+	New: func() interface{} {
+		return &getIterAlloc{}
+	},
+}
+
 type iterAlloc struct {
 	dbi     Iterator
 	keyBuf  []byte
@@ -720,6 +908,7 @@ func (d *DB) newIterInternal(batch *Batch, s *Snapshot, o *IterOptions) *Iterato
 		batch:     batch,
 		newIters:  d.newIters,
 		seqNum:    seqNum,
+		snapshot:  s != nil,
 	}
 	if o != nil {
 		dbi.opts = *o
@@ -736,6 +925,7 @@ func finishInitializingIter(buf *iterAlloc) *Iterator {
 	readState := dbi.readState
 	batch := dbi.batch
 	seqNum := dbi.seqNum
+	dbi.opts.stats = &dbi.stats.InternalStats
 
 	// Merging levels.
 	mlevels := buf.mlevels[:0]
@@ -848,6 +1038,20 @@ func (d *DB) NewIter(o *IterOptions) *Iterator {
 	return d.newIterInternal(nil /* batch */, nil /* snapshot */, o)
 }
 
+// NewIterWithContext is like NewIter, but the returned iterator stops with the
+// context's error, surfaced through Iterator.Error, if the context is canceled
+// or its deadline is exceeded. The context is checked before each sstable
+// block is loaded, so that long scans and scans against slow storage can be
+// interrupted. Clones of the iterator use the same context.
+func (d *DB) NewIterWithContext(ctx context.Context, o *IterOptions) *Iterator {
+	var opts IterOptions
+	if o != nil {
+		opts = *o
+	}
+	opts.ctx = ctx
+	return d.newIterInternal(nil /* batch */, nil /* snapshot */, &opts)
+}
+
 // NewSnapshot returns a point-in-time view of the current DB state. Iterators
 // created with this handle will all observe a stable snapshot of the current
 // DB state. The caller must call Snapshot.Close() when the snapshot is no
@@ -935,6 +1139,9 @@ func (d *DB) Close() error {
 		for _, mem := range d.mu.mem.queue {
 			mem.readerUnref()
 		}
+		if mem := (*memTable)(atomic.SwapPointer(&d.memTableRecycle, nil)); mem != nil {
+			d.freeMemTable(mem)
+		}
 		if reserved := atomic.LoadInt64(&d.atomic.memTableReserved); reserved != 0 {
 			return errors.Errorf("leaked memtable reservation: %d", errors.Safe(reserved))
 		}
@@ -1054,6 +1261,60 @@ func (d *DB) manualCompact(manual *manualCompaction) error {
 	return <-manual.done
 }
 
+// SetMaxConcurrentCompactions sets the maximum number of concurrent
+// compactions, overriding Options.MaxConcurrentCompactions. A value less than
+// 1 is treated as 1. Increasing the limit may immediately schedule additional
+// compactions. Decreasing the limit does not interrupt ongoing compactions,
+// but prevents new compactions from being scheduled until the number of
+// ongoing compactions drops below the new limit.
+func (d *DB) SetMaxConcurrentCompactions(n int) {
+	if n < 1 {
+		n = 1
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.mu.compact.maxConcurrent = n
+	d.maybeScheduleCompaction()
+}
+
+// DisableAutomaticCompactions stops the scheduling of automatic compactions,
+// for example to quiesce background I/O during a backup or a bulk ingestion.
+// Manual compactions requested through Compact, and flushes, are still
+// performed. In-progress compactions are not interrupted; use
+// WaitForBackgroundWork to wait for them to finish.
+//
+// Calls nest: automatic compactions are resumed once EnableAutomaticCompactions
+// has been called as many times as DisableAutomaticCompactions.
+func (d *DB) DisableAutomaticCompactions() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.mu.compact.automaticDisabled++
+}
+
+// EnableAutomaticCompactions resumes the scheduling of automatic compactions
+// stopped by DisableAutomaticCompactions, and may immediately schedule
+// compactions.
+func (d *DB) EnableAutomaticCompactions() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.mu.compact.automaticDisabled == 0 {
+		panic("pebble: EnableAutomaticCompactions called without DisableAutomaticCompactions")
+	}
+	d.mu.compact.automaticDisabled--
+	d.maybeScheduleCompaction()
+}
+
+// WaitForBackgroundWork blocks until there are no in-progress flushes or
+// compactions. Unless automatic compactions are disabled, new compactions may
+// be scheduled as soon as it returns.
+func (d *DB) WaitForBackgroundWork() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for d.mu.compact.compactingCount > 0 || d.mu.compact.flushing {
+		d.mu.compact.cond.Wait()
+	}
+}
+
 // Flush the memtable to stable storage.
 func (d *DB) Flush() error {
 	flushDone, err := d.AsyncFlush()
@@ -1099,10 +1360,19 @@ func (d *DB) Metrics() *Metrics {
 	metrics.Compact.InProgressBytes = atomic.LoadInt64(&d.mu.versions.atomic.atomicInProgressBytes)
 	for _, m := range d.mu.mem.queue {
 		metrics.MemTable.Size += m.totalBytes()
+		if mem, ok := m.flushable.(*memTable); ok {
+			metrics.MemTable.Size += mem.filterBytes()
+		}
 	}
 	metrics.MemTable.Count = int64(len(d.mu.mem.queue))
 	metrics.MemTable.ZombieCount = atomic.LoadInt64(&d.atomic.memTableCount) - metrics.MemTable.Count
 	metrics.MemTable.ZombieSize = uint64(atomic.LoadInt64(&d.atomic.memTableReserved)) - metrics.MemTable.Size
+	if m := (*memTable)(atomic.LoadPointer(&d.memTableRecycle)); m != nil {
+		// A memtable retained for recycling is not referenced by any reader and
+		// is not considered a zombie.
+		metrics.MemTable.ZombieCount--
+		metrics.MemTable.ZombieSize -= m.totalBytes() + m.filterBytes()
+	}
 	metrics.WAL.ObsoleteFiles = int64(recycledLogs)
 	metrics.WAL.Size = atomic.LoadUint64(&d.atomic.logSize)
 	metrics.WAL.BytesIn = d.mu.log.bytesIn // protected by d.mu
@@ -1282,30 +1552,96 @@ func (d *DB) newMemTable(logNum FileNum, logSeqNum uint64) (*memTable, *flushabl
 		}
 	}
 
-	atomic.AddInt64(&d.atomic.memTableCount, 1)
-	atomic.AddInt64(&d.atomic.memTableReserved, int64(size))
-	releaseAccountingReservation := d.opts.Cache.Reserve(size)
+	// Before allocating a new arena, check whether the arena of a previously
+	// flushed memtable is available for reuse. Allocating a fresh arena for
+	// every memtable churns the allocator under high write throughput. At most
+	// one obsolete memtable is retained for recycling (see
+	// DB.memTableRecycle).
+	// The bloom filter, if any, is recycled and accounted for along with the
+	// arena.
+	var arenaBuf []byte
+	var filter *memTableFilter
+	var releaseAccountingReservation func()
+	filterSize := memTableFilterSize(size, d.opts)
+	if recycled := (*memTable)(atomic.SwapPointer(&d.memTableRecycle, nil)); recycled != nil {
+		if len(recycled.arenaBuf) == size && int(recycled.filterBytes()) == filterSize {
+			// Carry through the existing buffer, filter and cache reservation.
+			arenaBuf = recycled.arenaBuf
+			filter = recycled.filter
+			releaseAccountingReservation = recycled.releaseAccountingReservation
+			recycled.arenaBuf = nil
+			recycled.filter = nil
+			recycled.releaseAccountingReservation = nil
+			if filter != nil {
+				filter.reset()
+			}
+		} else {
+			d.freeMemTable(recycled)
+		}
+	}
+	if arenaBuf == nil {
+		atomic.AddInt64(&d.atomic.memTableCount, 1)
+		d.updateMemTableReserved(int64(size + filterSize))
+		releaseAccountingReservation = d.opts.Cache.Reserve(size + filterSize)
+		arenaBuf = manual.New(size)
+		if filterSize > 0 {
+			filter = newMemTableFilter(filterSize)
+		}
+	}
 
 	mem := newMemTable(memTableOptions{
 		Options:   d.opts,
-		arenaBuf:  manual.New(int(size)),
+		arenaBuf:  arenaBuf,
+		filter:    filter,
 		logSeqNum: logSeqNum,
 	})
+	mem.releaseAccountingReservation = releaseAccountingReservation
 	if invariants.Enabled {
 		runtime.SetFinalizer(mem, checkMemTable)
 	}
 
 	entry := d.newFlushableEntry(mem, logNum, logSeqNum)
 	entry.releaseMemAccounting = func() {
-		manual.Free(mem.arenaBuf)
-		mem.arenaBuf = nil
-		atomic.AddInt64(&d.atomic.memTableCount, -1)
-		atomic.AddInt64(&d.atomic.memTableReserved, -int64(size))
-		releaseAccountingReservation()
+		// If the DB has been closed there is nobody left to reuse the arena, so
+		// release it immediately.
+		if err := d.closed.Load(); err != nil {
+			d.freeMemTable(mem)
+			return
+		}
+		// Stash the memtable so that the next memtable allocation can reuse its
+		// arena. If another memtable was already waiting to be recycled we're
+		// now responsible for freeing it.
+		if unused := (*memTable)(atomic.SwapPointer(&d.memTableRecycle, unsafe.Pointer(mem))); unused != nil {
+			d.freeMemTable(unused)
+		}
 	}
 	return mem, entry
 }
 
+// freeMemTable releases the arena, the bloom filter and the cache reservation
+// held by the memtable.
+func (d *DB) freeMemTable(m *memTable) {
+	atomic.AddInt64(&d.atomic.memTableCount, -1)
+	d.updateMemTableReserved(-int64(uint64(len(m.arenaBuf)) + m.filterBytes()))
+	m.releaseAccountingReservation()
+	m.releaseAccountingReservation = nil
+	manual.Free(m.arenaBuf)
+	m.arenaBuf = nil
+}
+
+// updateMemTableReserved adjusts the number of bytes reserved for memtables
+// and notifies Options.Experimental.MemTableReservationChanged.
+func (d *DB) updateMemTableReserved(delta int64) {
+	fn := d.opts.Experimental.MemTableReservationChanged
+	if fn == nil {
+		atomic.AddInt64(&d.atomic.memTableReserved, delta)
+		return
+	}
+	d.memTableReservedMu.Lock()
+	defer d.memTableReservedMu.Unlock()
+	fn(delta, atomic.AddInt64(&d.atomic.memTableReserved, delta))
+}
+
 func (d *DB) newFlushableEntry(f flushable, logNum FileNum, logSeqNum uint64) *flushableEntry {
 	return &flushableEntry{
 		flushable:  f,
@@ -1328,6 +1664,13 @@ func (d *DB) newFlushableEntry(f flushable, logNum FileNum, logSeqNum uint64) *f
 func (d *DB) makeRoomForWrite(b *Batch) error {
 	force := b == nil || b.flushable != nil
 	stalled := false
+	var stallStart time.Time
+	stallEnd := func() {
+		d.opts.EventListener.WriteStallEnd()
+		if b != nil {
+			b.commitStats.WriteStallDuration += time.Since(stallStart)
+		}
+	}
 	for {
 		if d.mu.mem.switching {
 			d.mu.mem.cond.Wait()
@@ -1337,13 +1680,13 @@ func (d *DB) makeRoomForWrite(b *Batch) error {
 			err := d.mu.mem.mutable.prepare(b)
 			if err != arenaskl.ErrArenaFull {
 				if stalled {
-					d.opts.EventListener.WriteStallEnd()
+					stallEnd()
 				}
 				return err
 			}
 		} else if !force {
 			if stalled {
-				d.opts.EventListener.WriteStallEnd()
+				stallEnd()
 			}
 			return nil
 		}
@@ -1358,6 +1701,7 @@ func (d *DB) makeRoomForWrite(b *Batch) error {
 				// are still flushing, so we wait.
 				if !stalled {
 					stalled = true
+					stallStart = time.Now()
 					d.opts.EventListener.WriteStallBegin(WriteStallBeginInfo{
 						Reason: "memtable count limit reached",
 					})
@@ -1371,6 +1715,7 @@ func (d *DB) makeRoomForWrite(b *Batch) error {
 			// There are too many level-0 files, so we wait.
 			if !stalled {
 				stalled = true
+				stallStart = time.Now()
 				d.opts.EventListener.WriteStallBegin(WriteStallBeginInfo{
 					Reason: "L0 file count limit exceeded",
 				})
@@ -17,6 +17,7 @@ import (
 	"time"
 
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/bloom"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
@@ -479,6 +480,40 @@ func TestGetMerge(t *testing.T) {
 	require.NoError(t, d.Close())
 }
 
+func TestGetMemTable(t *testing.T) {
+	d, err := Open("", &Options{
+		FS: vfs.NewMem(),
+	})
+	require.NoError(t, err)
+
+	// Records in a flushed table which are shadowed by the memtable.
+	require.NoError(t, d.Set([]byte("b"), []byte("b1"), nil))
+	require.NoError(t, d.Set([]byte("c"), []byte("c1"), nil))
+	require.NoError(t, d.Set([]byte("d"), []byte("d1"), nil))
+	require.NoError(t, d.Flush())
+
+	require.NoError(t, d.Set([]byte("a"), []byte("a1"), nil))
+	snap := d.NewSnapshot()
+	require.NoError(t, d.Set([]byte("a"), []byte("a2"), nil))
+	require.NoError(t, d.DeleteRange([]byte("b"), []byte("c"), nil))
+	require.NoError(t, d.Delete([]byte("c"), nil))
+	require.NoError(t, d.DeleteRange([]byte("d"), []byte("e"), nil))
+	require.NoError(t, d.Set([]byte("d"), []byte("d2"), nil))
+
+	// The newest record for "a" is not visible to the snapshot.
+	verifyGet(t, d, []byte("a"), []byte("a2"))
+	verifyGet(t, snap, []byte("a"), []byte("a1"))
+	// The memtable has no point record for "b", only a range tombstone.
+	verifyGetNotFound(t, d, []byte("b"))
+	verifyGetNotFound(t, d, []byte("c"))
+	verifyGet(t, d, []byte("d"), []byte("d2"))
+	verifyGet(t, snap, []byte("b"), []byte("b1"))
+	verifyGet(t, snap, []byte("d"), []byte("d1"))
+
+	require.NoError(t, snap.Close())
+	require.NoError(t, d.Close())
+}
+
 func TestMergeOrderSameAfterFlush(t *testing.T) {
 	// Ensure compaction iterator (used by flush) and user iterator process merge
 	// operands in the same order
@@ -585,6 +620,125 @@ func TestLogData(t *testing.T) {
 	// For now, LogData proceeding ahead without a panic is good enough.
 }
 
+func TestWriteOptionsDisableWAL(t *testing.T) {
+	mem := vfs.NewStrictMem()
+	d, err := Open("", &Options{FS: mem})
+	require.NoError(t, err)
+
+	get := func(key string) string {
+		v, closer, err := d.Get([]byte(key))
+		if err == ErrNotFound {
+			return "<not found>"
+		}
+		require.NoError(t, err)
+		defer closer.Close()
+		return string(v)
+	}
+	// crash simulates a crash by discarding unsynced writes to the file
+	// system, and reopens the DB.
+	crash := func() {
+		mem.SetIgnoreSyncs(true)
+		require.NoError(t, d.Close())
+		mem.ResetToSyncedState()
+		mem.SetIgnoreSyncs(false)
+		d, err = Open("", &Options{FS: mem})
+		require.NoError(t, err)
+	}
+
+	require.Regexp(t, `WAL disabled`,
+		d.Set([]byte("a"), []byte("1"), &WriteOptions{Sync: true, DisableWAL: true}))
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), &WriteOptions{DisableWAL: true}))
+	require.NoError(t, d.Set([]byte("b"), []byte("2"), Sync))
+	require.Equal(t, "1", get("a"))
+	require.Equal(t, "2", get("b"))
+
+	// The write which skipped the WAL is lost on a crash, even though a later
+	// write to the WAL was synced.
+	crash()
+	require.Equal(t, "<not found>", get("a"))
+	require.Equal(t, "2", get("b"))
+
+	// Once flushed, a write which skipped the WAL is durable.
+	require.NoError(t, d.Set([]byte("c"), []byte("3"), &WriteOptions{DisableWAL: true}))
+	require.NoError(t, d.Flush())
+	crash()
+	require.Equal(t, "3", get("c"))
+	require.NoError(t, d.Close())
+}
+
+func TestMultiGet(t *testing.T) {
+	splitComparer := *DefaultComparer
+	splitComparer.Split = func(a []byte) int { return len(a) }
+	splitComparer.Name = "split-comparer"
+
+	for _, comparer := range []*Comparer{DefaultComparer, &splitComparer} {
+		t.Run(comparer.Name, func(t *testing.T) {
+			d, err := Open("", &Options{
+				Comparer: comparer,
+				FS:       vfs.NewMem(),
+				Levels:   []LevelOptions{{BlockSize: 64, FilterPolicy: bloom.FilterPolicy(10), TargetFileSize: 2 << 10}},
+			})
+			require.NoError(t, err)
+			defer func() { require.NoError(t, d.Close()) }()
+
+			// Keys are spread across L6, L0 and the memtable, and some keys
+			// are deleted, merged or covered by range tombstones.
+			key := func(i int) []byte { return []byte(fmt.Sprintf("%04d", i)) }
+			for i := 0; i < 1000; i += 2 {
+				require.NoError(t, d.Set(key(i), key(i), nil))
+			}
+			require.NoError(t, d.Compact(key(0), key(1000)))
+			for i := 0; i < 1000; i += 3 {
+				require.NoError(t, d.Merge(key(i), []byte("+"), nil))
+			}
+			require.NoError(t, d.DeleteRange(key(100), key(200), nil))
+			require.NoError(t, d.Flush())
+			for i := 0; i < 1000; i += 5 {
+				require.NoError(t, d.Delete(key(i), nil))
+			}
+			require.NoError(t, d.DeleteRange(key(500), key(600), nil))
+			for i := 510; i < 520; i++ {
+				require.NoError(t, d.Merge(key(i), []byte("*"), nil))
+			}
+
+			rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+			keys := make([][]byte, 200)
+			for i := range keys {
+				keys[i] = key(rng.Intn(1100))
+			}
+			// Include a duplicate key.
+			keys = append(keys, keys[0])
+
+			found := make(map[int]string)
+			require.NoError(t, d.MultiGet(keys, func(i int, value []byte) error {
+				_, ok := found[i]
+				require.False(t, ok)
+				found[i] = string(value)
+				return nil
+			}))
+			for i, k := range keys {
+				value, closer, err := d.Get(k)
+				if err == ErrNotFound {
+					require.NotContains(t, found, i)
+					continue
+				}
+				require.NoError(t, err)
+				require.Equal(t, string(value), found[i])
+				require.NoError(t, closer.Close())
+			}
+
+			// An error returned by fn stops MultiGet.
+			var calls int
+			err = d.MultiGet([][]byte{key(2), key(4)}, func(i int, value []byte) error {
+				calls++
+				return errors.New("boom")
+			})
+			require.Regexp(t, "boom", err)
+			require.Equal(t, 1, calls)
+		})
+	}
+}
+
 func TestSingleDeleteGet(t *testing.T) {
 	d, err := Open("", &Options{
 		FS: vfs.NewMem(),
@@ -750,22 +904,122 @@ func TestMemTableReservation(t *testing.T) {
 		t.Fatalf("expected failure, but found success: %s", h.Get())
 	}
 
-	// Flush the memtable. The memtable reservation should be unchanged because a
-	// new memtable will be allocated.
+	// Flush the memtable. A new memtable is allocated, and the flushed memtable
+	// is retained for recycling, so the memory for 2 memtables is reserved.
 	require.NoError(t, d.Flush())
-	checkReserved(int64(opts.MemTableSize))
+	checkReserved(2 * int64(opts.MemTableSize))
+
+	// Flush again. The new memtable reuses the arena of the recycled memtable
+	// and the flushed memtable takes its place, so the reservation is
+	// unchanged.
+	require.NoError(t, d.Flush())
+	checkReserved(2 * int64(opts.MemTableSize))
 
 	// Flush in the presence of an active iterator. The iterator will hold a
 	// reference to a readState which will in turn hold a reader reference to the
-	// memtable. While the iterator is open, there will be the memory for 2
-	// memtables reserved.
+	// memtable. The new memtable reuses the arena of the recycled memtable, so
+	// while the iterator is open the memory for 2 memtables is reserved: the
+	// mutable memtable and the memtable referenced by the iterator. Closing the
+	// iterator moves the flushed memtable to the recycle slot.
 	iter := d.NewIter(nil)
 	require.NoError(t, d.Flush())
 	checkReserved(2 * int64(opts.MemTableSize))
 	require.NoError(t, iter.Close())
-	checkReserved(int64(opts.MemTableSize))
+	checkReserved(2 * int64(opts.MemTableSize))
+
+	require.NoError(t, d.Close())
+}
+
+func TestMemTableReservationChanged(t *testing.T) {
+	var reserved, calls int64
+	opts := &Options{
+		MemTableSize: initialMemTableSize,
+		FS:           vfs.NewMem(),
+	}
+	opts.Experimental.MemTableReservationChanged = func(delta, total int64) {
+		atomic.AddInt64(&calls, 1)
+		require.Equal(t, total, atomic.AddInt64(&reserved, delta))
+	}
+
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	require.EqualValues(t, opts.MemTableSize, atomic.LoadInt64(&reserved))
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, d.Set([]byte("a"), nil, nil))
+		require.NoError(t, d.Flush())
+		require.Equal(t, atomic.LoadInt64(&d.atomic.memTableReserved), atomic.LoadInt64(&reserved))
+	}
+
+	require.NoError(t, d.Close())
+	require.EqualValues(t, 0, atomic.LoadInt64(&reserved))
+	require.Less(t, int64(0), atomic.LoadInt64(&calls))
+}
+
+func TestMemTableReservationChangedSerialized(t *testing.T) {
+	// The callback updates its state without synchronization, relying on the
+	// calls being serialized.
+	var reserved int64
+	opts := &Options{FS: vfs.NewMem()}
+	opts.Experimental.MemTableReservationChanged = func(delta, total int64) {
+		reserved += delta
+		if reserved != total {
+			panic(fmt.Sprintf("expected total %d, but found %d", reserved, total))
+		}
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				d.updateMemTableReserved(1)
+				d.updateMemTableReserved(-1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, d.Close())
+	require.EqualValues(t, 0, reserved)
+}
+
+func TestMemTableFilterReservation(t *testing.T) {
+	var reserved int64
+	opts := &Options{
+		MemTableSize: initialMemTableSize,
+		FS:           vfs.NewMem(),
+	}
+	opts.Experimental.MemTableBloomSizeRatio = 0.125
+	opts.Experimental.MemTableReservationChanged = func(delta, total int64) {
+		atomic.StoreInt64(&reserved, total)
+	}
+	memSize := int64(opts.MemTableSize + memTableFilterSize(opts.MemTableSize, opts))
+	require.Less(t, int64(opts.MemTableSize), memSize)
+
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	require.Equal(t, memSize, atomic.LoadInt64(&reserved))
+	d.mu.Lock()
+	filter := d.mu.mem.mutable.filter
+	d.mu.Unlock()
+
+	// The first flush retains the flushed memtable for recycling, and the
+	// second reuses its arena and filter for the new mutable memtable.
+	for i := 0; i < 2; i++ {
+		require.NoError(t, d.Set([]byte("a"), nil, nil))
+		require.NoError(t, d.Flush())
+		require.Equal(t, 2*memSize, atomic.LoadInt64(&reserved))
+	}
+	d.mu.Lock()
+	require.True(t, filter == d.mu.mem.mutable.filter)
+	d.mu.Unlock()
+	require.False(t, filter.mayContain([]byte("a")))
 
 	require.NoError(t, d.Close())
+	require.EqualValues(t, 0, atomic.LoadInt64(&reserved))
 }
 
 func TestMemTableReservationLeak(t *testing.T) {
@@ -999,6 +1253,39 @@ func TestDBConcurrentCompactClose(t *testing.T) {
 	}
 }
 
+func TestDBSetMaxConcurrentCompactions(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                    vfs.NewMem(),
+		L0CompactionThreshold: 1,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	maxConcurrent := func() int {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.mu.compact.maxConcurrent
+	}
+	require.Equal(t, 1, maxConcurrent())
+	d.SetMaxConcurrentCompactions(3)
+	require.Equal(t, 3, maxConcurrent())
+	d.SetMaxConcurrentCompactions(0)
+	require.Equal(t, 1, maxConcurrent())
+
+	// Compactions continue to be scheduled with the new limit.
+	d.SetMaxConcurrentCompactions(2)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprint(i)), nil, nil))
+		require.NoError(t, d.Flush())
+	}
+	require.NoError(t, try(100*time.Microsecond, 20*time.Second, func() error {
+		if n := d.Metrics().Levels[0].NumFiles; n > 1 {
+			return errors.Errorf("%d L0 files remain", n)
+		}
+		return nil
+	}))
+}
+
 func TestDBApplyBatchNilDB(t *testing.T) {
 	d, err := Open("", &Options{FS: vfs.NewMem()})
 	require.NoError(t, err)
@@ -1045,6 +1332,36 @@ func TestDBApplyBatchMismatch(t *testing.T) {
 	require.NoError(t, applyDB.Close())
 }
 
+func TestDBApplyGroup(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+
+	b1 := d.NewBatch()
+	require.NoError(t, b1.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, b1.Set([]byte("c"), []byte("1"), nil))
+	b2 := &Batch{}
+	require.NoError(t, b2.DeleteRange([]byte("a"), []byte("b"), nil))
+	require.NoError(t, b2.Set([]byte("d"), []byte("2"), nil))
+
+	seqNum := atomic.LoadUint64(&d.mu.versions.atomic.visibleSeqNum)
+	require.NoError(t, d.ApplyGroup([]*Batch{b1, b2}, Sync))
+	require.Equal(t, seqNum+4, atomic.LoadUint64(&d.mu.versions.atomic.visibleSeqNum))
+
+	// The batches are applied in order, and are not modified.
+	_, _, err = d.Get([]byte("a"))
+	require.Equal(t, ErrNotFound, err)
+	for _, key := range []string{"c", "d"} {
+		_, closer, err := d.Get([]byte(key))
+		require.NoError(t, err)
+		require.NoError(t, closer.Close())
+	}
+	require.Equal(t, uint32(2), b1.Count())
+	require.Equal(t, uint32(2), b2.Count())
+	require.NoError(t, b1.Close())
+
+	require.NoError(t, d.Close())
+}
+
 func TestCloseCleanerRace(t *testing.T) {
 	mem := vfs.NewMem()
 	for i := 0; i < 20; i++ {
@@ -1168,6 +1485,108 @@ func BenchmarkDelete(b *testing.B) {
 	})
 }
 
+func BenchmarkGet(b *testing.B) {
+	const keyCount = 10000
+	keys := make([][]byte, keyCount)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("%08d", i))
+	}
+	val := bytes.Repeat([]byte("x"), 10)
+
+	benchmark := func(b *testing.B, flush bool) {
+		d, err := Open("", &Options{FS: vfs.NewMem()})
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer func() {
+			if err := d.Close(); err != nil {
+				b.Fatal(err)
+			}
+		}()
+		for _, key := range keys {
+			if err := d.Set(key, val, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if flush {
+			if err := d.Flush(); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_, closer, err := d.Get(keys[i%keyCount])
+			if err != nil {
+				b.Fatal(err)
+			}
+			closer.Close()
+		}
+		b.StopTimer()
+	}
+
+	b.Run("memtable", func(b *testing.B) { benchmark(b, false) })
+	b.Run("sstable", func(b *testing.B) { benchmark(b, true) })
+}
+
+func BenchmarkMultiGet(b *testing.B) {
+	const keyCount = 10000
+	keys := make([][]byte, keyCount)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("%08d", i))
+	}
+	val := bytes.Repeat([]byte("x"), 10)
+
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		if err := d.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}()
+	for _, key := range keys {
+		if err := d.Set(key, val, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := d.Flush(); err != nil {
+		b.Fatal(err)
+	}
+
+	rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+	for _, batchSize := range []int{1, 10, 100} {
+		batch := make([][]byte, batchSize)
+		for i := range batch {
+			batch[i] = keys[rng.Intn(keyCount)]
+		}
+
+		b.Run(fmt.Sprintf("multiget/keys=%d", batchSize), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := d.MultiGet(batch, func(int, []byte) error { return nil }); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("get/keys=%d", batchSize), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, key := range batch {
+					_, closer, err := d.Get(key)
+					if err != nil {
+						b.Fatal(err)
+					}
+					closer.Close()
+				}
+			}
+		})
+	}
+}
+
 func verifyGet(t *testing.T, r Reader, key, expected []byte) {
 	val, closer, err := r.Get(key)
 	require.NoError(t, err)
@@ -61,10 +61,21 @@ type CompactionInfo struct {
 	Input []LevelInfo
 	// Output contains the output tables generated by the compaction. The output
 	// tables are empty for the compaction begin event.
-	Output   LevelInfo
+	Output LevelInfo
+	// Duration is the time spent running the compaction, excluding the time
+	// spent installing its version edit.
 	Duration time.Duration
-	Done     bool
-	Err      error
+	// TotalDuration is the time from the compaction begin event to the
+	// compaction end event, including the time spent installing the version
+	// edit.
+	TotalDuration time.Duration
+	// BytesRead is the number of bytes of the input tables read by the
+	// compaction. Move and delete-only compactions read no bytes.
+	BytesRead uint64
+	// BytesWritten is the number of bytes written to the output tables.
+	BytesWritten uint64
+	Done         bool
+	Err          error
 }
 
 func (i CompactionInfo) String() string {
@@ -135,10 +146,20 @@ type FlushInfo struct {
 	Input int
 	// Output contains the ouptut table generated by the flush. The output info
 	// is empty for the flush begin event.
-	Output   []TableInfo
+	Output []TableInfo
+	// Duration is the time spent running the flush, excluding the time spent
+	// installing its version edit.
 	Duration time.Duration
-	Done     bool
-	Err      error
+	// TotalDuration is the time from the flush begin event to the flush end
+	// event, including the time spent installing the version edit.
+	TotalDuration time.Duration
+	// BytesRead is the number of bytes of the input memtables read by the
+	// flush.
+	BytesRead uint64
+	// BytesWritten is the number of bytes written to the output tables.
+	BytesWritten uint64
+	Done         bool
+	Err          error
 }
 
 func (i FlushInfo) String() string {
@@ -375,3 +375,52 @@ func TestEventListenerRedact(t *testing.T) {
 	})
 	require.Equal(t, "[JOB 5] WAL delete error: unredacted error: ‹×›\n", log.String())
 }
+
+func TestEventListenerFlushAndCompactionStats(t *testing.T) {
+	var flushes []FlushInfo
+	var compactions []CompactionInfo
+	d, err := Open("", &Options{
+		EventListener: EventListener{
+			FlushEnd: func(info FlushInfo) {
+				flushes = append(flushes, info)
+			},
+			CompactionEnd: func(info CompactionInfo) {
+				compactions = append(compactions, info)
+			},
+		},
+		FS: vfs.NewMem(),
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, d.Set([]byte("a"), []byte("a"), nil))
+		require.NoError(t, d.Set([]byte("b"), []byte("b"), nil))
+		require.NoError(t, d.Flush())
+	}
+	require.NoError(t, d.Compact([]byte("a"), []byte("c")))
+
+	outputSize := func(tables []TableInfo) uint64 {
+		var size uint64
+		for i := range tables {
+			size += tables[i].Size
+		}
+		return size
+	}
+	require.Len(t, flushes, 2)
+	for _, info := range flushes {
+		require.NotZero(t, info.BytesRead)
+		require.Equal(t, outputSize(info.Output), info.BytesWritten)
+		require.True(t, info.Duration <= info.TotalDuration)
+	}
+	require.Len(t, compactions, 1)
+	info := compactions[0]
+	var inputSize uint64
+	for _, level := range info.Input {
+		inputSize += outputSize(level.Tables)
+	}
+	require.NotZero(t, info.BytesRead)
+	require.LessOrEqual(t, info.BytesRead, inputSize)
+	require.Equal(t, outputSize(info.Output.Tables), info.BytesWritten)
+	require.True(t, info.Duration <= info.TotalDuration)
+}
@@ -7,6 +7,7 @@ package pebble
 import (
 	"fmt"
 	"sync/atomic"
+	"time"
 )
 
 // flushable defines the interface for immutable memtables.
@@ -33,9 +34,10 @@ type flushableEntry struct {
 	// flushForced indicates whether a flush was forced on this memtable (either
 	// manual, or due to ingestion). Protected by DB.mu.
 	flushForced bool
-	// delayedFlushForced indicates whether a timer has been set to force a flush
-	// on this memtable at some point in the future. Protected by DB.mu
-	delayedFlushForced bool
+	// delayedFlushTimer is the timer, if any, which has been set to force a
+	// flush on this memtable at delayedFlushForcedAt. Protected by DB.mu.
+	delayedFlushTimer    *time.Timer
+	delayedFlushForcedAt time.Time
 	// logNum corresponds to the WAL that contains the records present in the
 	// receiver.
 	logNum FileNum
@@ -5,6 +5,7 @@
 package pebble
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/cockroachdb/pebble/internal/base"
@@ -17,6 +18,7 @@ import (
 // internalIterator, but specialized for Get operations so that it loads data
 // lazily.
 type getIter struct {
+	ctx          context.Context
 	logger       Logger
 	cmp          Compare
 	equal        Equal
@@ -34,7 +36,9 @@ type getIter struct {
 	version      *version
 	iterKey      *InternalKey
 	iterValue    []byte
-	err          error
+	// memKey holds the key of a record found in a memtable by getMemTable.
+	memKey InternalKey
+	err    error
 }
 
 // getIter implements the base.InternalIterator interface.
@@ -132,9 +136,23 @@ func (g *getIter) Next() (*InternalKey, []byte) {
 		// Create iterators from memtables from newest to oldest.
 		if n := len(g.mem); n > 0 {
 			m := g.mem[n-1]
+			g.mem = g.mem[:n-1]
+			if mem, ok := m.flushable.(*memTable); ok {
+				if resolved, found := g.getMemTable(m, mem); resolved {
+					if g.err != nil {
+						return nil, nil
+					}
+					if !found {
+						continue
+					}
+					if g.tombstone.Deletes(g.memKey.SeqNum()) {
+						return nil, nil
+					}
+					return g.iterKey, g.iterValue
+				}
+			}
 			g.iter = m.newIter(nil)
 			g.rangeDelIter = m.newRangeDelIter(nil)
-			g.mem = g.mem[:n-1]
 			g.iterKey, g.iterValue = g.iter.SeekGE(g.key)
 			continue
 		}
@@ -144,7 +162,7 @@ func (g *getIter) Next() (*InternalKey, []byte) {
 			if n := len(g.l0); n > 0 {
 				files := g.l0[n-1].Iter()
 				g.l0 = g.l0[:n-1]
-				iterOpts := IterOptions{logger: g.logger}
+				iterOpts := IterOptions{logger: g.logger, ctx: g.ctx}
 				g.levelIter.init(iterOpts, g.cmp, g.newIters, files, manifest.L0Sublevel(n), nil)
 				g.levelIter.initRangeDel(&g.rangeDelIter)
 				g.iter = &g.levelIter
@@ -162,7 +180,7 @@ func (g *getIter) Next() (*InternalKey, []byte) {
 			continue
 		}
 
-		iterOpts := IterOptions{logger: g.logger}
+		iterOpts := IterOptions{logger: g.logger, ctx: g.ctx}
 		g.levelIter.init(iterOpts, g.cmp, g.newIters,
 			g.version.Levels[g.level].Iter(), manifest.Level(g.level), nil)
 		g.levelIter.initRangeDel(&g.rangeDelIter)
@@ -172,6 +190,33 @@ func (g *getIter) Next() (*InternalKey, []byte) {
 	}
 }
 
+// getMemTable looks up the key in a memtable with a single skiplist descent
+// rather than an iterator. It returns resolved=false if the memtable's newest
+// record for the key is not visible at the snapshot or is a merge operand, in
+// which case the older records of the key must be iterated. Otherwise it sets
+// g.tombstone to the memtable's range tombstone covering the key, if any, and
+// positions g.iterKey and g.iterValue at the record for the key, if found.
+func (g *getIter) getMemTable(m *flushableEntry, mem *memTable) (resolved, found bool) {
+	// The bloom filter does not cover range tombstones, which must be checked
+	// even if the memtable does not contain a point record for the key.
+	if mem.mayContain(g.key) {
+		var value []byte
+		g.memKey, value, found = mem.skl.Get(g.key)
+		found = found && g.equal(g.key, g.memKey.UserKey)
+		if found {
+			if !g.memKey.Visible(g.snapshot) || g.memKey.Kind() == InternalKeyKindMerge {
+				return false, false
+			}
+			g.iterKey, g.iterValue = &g.memKey, value
+		}
+	}
+	if rangeDelIter := m.newRangeDelIter(nil); rangeDelIter != nil {
+		g.tombstone = rangedel.Get(g.cmp, rangeDelIter, g.key, g.snapshot)
+		g.err = rangeDelIter.Close()
+	}
+	return true, found
+}
+
 func (g *getIter) Prev() (*InternalKey, []byte) {
 	panic("pebble: Prev unimplemented")
 }
@@ -28,3 +28,6 @@ const (
 type InternalKey = base.InternalKey
 
 type internalIterator = base.InternalIterator
+
+// InternalIteratorStats exports the base.InternalIteratorStats type.
+type InternalIteratorStats = base.InternalIteratorStats
@@ -35,6 +35,11 @@ const (
 	align4 = 3
 )
 
+// MaxArenaSize is the maximum size of an arena. Offsets into the arena are
+// stored as uint32 within the skiplist nodes, so an arena cannot address more
+// than math.MaxUint32 bytes.
+const MaxArenaSize = math.MaxUint32
+
 var (
 	// ErrArenaFull indicates that the arena is full and cannot perform any more
 	// allocations.
@@ -42,8 +47,12 @@ var (
 )
 
 // NewArena allocates a new arena using the specified buffer as the backing
-// store.
+// store. NewArena panics if the buffer is larger than MaxArenaSize.
 func NewArena(buf []byte) *Arena {
+	if uint64(len(buf)) > MaxArenaSize {
+		panic(errors.AssertionFailedf("arena size %d exceeds maximum %d",
+			errors.Safe(len(buf)), errors.Safe(uint64(MaxArenaSize))))
+	}
 	// Don't store data at position 0 in order to reserve offset=0 as a kind
 	// of nil pointer.
 	return &Arena{
@@ -82,35 +82,85 @@ type Skiplist struct {
 	tail   *node
 	height uint32 // Current height. 1 <= height <= maxHeight. CAS.
 
+	// The maximum height of a node's tower, and the precomputed probabilities
+	// of each height. See Options.
+	maxHeight     uint32
+	probabilities *[maxHeight]uint32
+
 	// If set to true by tests, then extra delays are added to make it easier to
 	// detect unusual race conditions.
 	testing bool
 }
 
-// Inserter TODO(peter)
+// Inserter caches the splice (the nodes bracketing the most recently inserted
+// key at each level of the skiplist) computed by a previous insertion. When
+// keys are inserted in ascending order, the cached splice usually brackets the
+// next key as well, allowing the insertion to avoid a full descent from the
+// head of the skiplist. A cached splice is validated before use, so it is
+// always safe to reuse an Inserter for a skiplist, even if other insertions
+// have been performed since it was last used. An Inserter must not be used
+// concurrently, nor used with more than one skiplist.
 type Inserter struct {
 	spl    [maxHeight]splice
 	height uint32
 }
 
-// Add TODO(peter)
+// Add adds a new key to the skiplist if it does not yet exist, using and
+// updating the splice cached by the Inserter as a hint. See Skiplist.Add.
 func (ins *Inserter) Add(list *Skiplist, key base.InternalKey, value []byte) error {
 	return list.addInternal(key, value, ins)
 }
 
+// MaxHeight is the largest permitted value for Options.MaxHeight.
+const MaxHeight = maxHeight
+
+// Options holds the optional parameters controlling the distribution of the
+// heights of the towers of skiplist nodes. Lowering the maximum height or the
+// probability reduces the memory overhead per node (which matters for small
+// arenas or small keys and values) at the expense of longer seeks.
+type Options struct {
+	// MaxHeight is the maximum height of a node's tower. It must be zero,
+	// meaning the default, or in the range [1, MaxHeight].
+	//
+	// The default value (zero) is MaxHeight.
+	MaxHeight int
+
+	// Probability is the probability with which a node's tower is extended by
+	// each additional level. It must be zero, meaning the default, or in the
+	// range (0, 1).
+	//
+	// The default value (zero) is 1/e, which minimizes the expected search
+	// cost.
+	Probability float64
+}
+
+// Validate verifies the options are within their permitted ranges.
+func (o Options) Validate() error {
+	if o.MaxHeight < 0 || o.MaxHeight > MaxHeight {
+		return errors.Errorf("arenaskl: max height %d must be 0 (the default) or in the range [1, %d]",
+			errors.Safe(o.MaxHeight), errors.Safe(MaxHeight))
+	}
+	if o.Probability < 0 || o.Probability >= 1 {
+		return errors.Errorf("arenaskl: probability %f must be 0 (the default) or in the range (0, 1)",
+			errors.Safe(o.Probability))
+	}
+	return nil
+}
+
 var (
-	probabilities [maxHeight]uint32
+	defaultProbabilities = makeProbabilities(pValue)
 )
 
-func init() {
-	// Precompute the skiplist probabilities so that only a single random number
-	// needs to be generated and so that the optimal pvalue can be used (inverse
-	// of Euler's number).
+// makeProbabilities precomputes the skiplist probabilities so that only a
+// single random number needs to be generated when choosing a node height.
+func makeProbabilities(pvalue float64) *[maxHeight]uint32 {
+	var probabilities [maxHeight]uint32
 	p := float64(1.0)
 	for i := 0; i < maxHeight; i++ {
 		probabilities[i] = uint32(float64(math.MaxUint32) * p)
-		p *= pValue
+		p *= pvalue
 	}
+	return &probabilities
 }
 
 // NewSkiplist constructs and initializes a new, empty skiplist. All nodes, keys,
@@ -123,6 +173,25 @@ func NewSkiplist(arena *Arena, cmp base.Compare) *Skiplist {
 
 // Reset the skiplist to empty and re-initialize.
 func (s *Skiplist) Reset(arena *Arena, cmp base.Compare) {
+	s.ResetWithOptions(arena, cmp, Options{})
+}
+
+// ResetWithOptions resets the skiplist to empty and re-initializes it using
+// the specified options. ResetWithOptions panics if the options are invalid.
+func (s *Skiplist) ResetWithOptions(arena *Arena, cmp base.Compare, opts Options) {
+	if err := opts.Validate(); err != nil {
+		panic(err)
+	}
+	height := uint32(maxHeight)
+	if opts.MaxHeight > 0 {
+		height = uint32(opts.MaxHeight)
+	}
+	// The optimal pvalue is the inverse of Euler's number.
+	probabilities := defaultProbabilities
+	if opts.Probability > 0 && opts.Probability != pValue {
+		probabilities = makeProbabilities(opts.Probability)
+	}
+
 	// Allocate head and tail nodes.
 	head, err := newRawNode(arena, maxHeight, 0, 0)
 	if err != nil {
@@ -145,11 +214,13 @@ func (s *Skiplist) Reset(arena *Arena, cmp base.Compare) {
 	}
 
 	*s = Skiplist{
-		arena:  arena,
-		cmp:    cmp,
-		head:   head,
-		tail:   tail,
-		height: 1,
+		arena:         arena,
+		cmp:           cmp,
+		head:          head,
+		tail:          tail,
+		height:        1,
+		maxHeight:     height,
+		probabilities: probabilities,
 	}
 }
 
@@ -293,6 +364,21 @@ func (s *Skiplist) addInternal(key base.InternalKey, value []byte, ins *Inserter
 	return nil
 }
 
+// Get returns the first entry in the skiplist whose key is greater than or
+// equal to the given user key, i.e. the newest entry for the key if the key is
+// present. Unlike positioning an Iterator obtained from NewIter, Get does not
+// perform any heap allocations. The returned key and value point into the
+// arena. Returns ok=false if there is no such entry.
+func (s *Skiplist) Get(key []byte) (ikey base.InternalKey, value []byte, ok bool) {
+	it := Iterator{list: s}
+	_, it.nd, _ = it.seekForBaseSplice(key)
+	if it.nd == s.tail {
+		return base.InternalKey{}, nil, false
+	}
+	it.decodeKey()
+	return it.key, it.value(), true
+}
+
 // NewIter returns a new Iterator object. The lower and upper bound parameters
 // control the range of keys the iterator will return. Specifying for nil for
 // lower or upper bound disables the check for that boundary. Note that lower
@@ -342,7 +428,7 @@ func (s *Skiplist) randomHeight() uint32 {
 	rnd := fastrand.Uint32()
 
 	h := uint32(1)
-	for h < maxHeight && rnd <= probabilities[h] {
+	for h < s.maxHeight && rnd <= s.probabilities[h] {
 		h++
 	}
 
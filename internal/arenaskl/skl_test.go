@@ -181,6 +181,37 @@ func TestFull(t *testing.T) {
 	require.Equal(t, ErrArenaFull, err)
 }
 
+func TestHeightOptions(t *testing.T) {
+	testCases := []struct {
+		opts   Options
+		height uint32
+	}{
+		{Options{}, MaxHeight},
+		{Options{MaxHeight: 1}, 1},
+		{Options{MaxHeight: 4, Probability: 0.5}, 4},
+		{Options{Probability: 0.25}, MaxHeight},
+	}
+	for _, c := range testCases {
+		t.Run(fmt.Sprintf("%+v", c.opts), func(t *testing.T) {
+			var l Skiplist
+			l.ResetWithOptions(newArena(arenaSize), bytes.Compare, c.opts)
+			for i := 0; i < 2000; i++ {
+				require.NoError(t, l.Add(makeIntKey(i), nil))
+			}
+			require.LessOrEqual(t, l.Height(), c.height)
+			require.Equal(t, 2000, length(&l))
+			require.Equal(t, 2000, lengthRev(&l))
+		})
+	}
+
+	require.Error(t, Options{MaxHeight: MaxHeight + 1}.Validate())
+	require.Error(t, Options{Probability: 1}.Validate())
+	require.Panics(t, func() {
+		var l Skiplist
+		l.ResetWithOptions(newArena(arenaSize), bytes.Compare, Options{MaxHeight: -1})
+	})
+}
+
 // TestBasic tests single-threaded seeks and adds.
 func TestBasic(t *testing.T) {
 	for _, inserter := range []bool{false, true} {
@@ -616,6 +647,38 @@ func TestIteratorSeekGEAndSeekPrefixGE(t *testing.T) {
 	require.EqualValues(t, "", it.Key().UserKey)
 }
 
+func TestGet(t *testing.T) {
+	l := NewSkiplist(newArena(arenaSize), bytes.Compare)
+	_, _, ok := l.Get(makeKey("00000"))
+	require.False(t, ok)
+
+	// 1000, 1010, 1020, ..., 1990.
+	var ins Inserter
+	for i := 0; i < 100; i++ {
+		v := i*10 + 1000
+		require.NoError(t, ins.Add(l, makeIntKey(v), makeValue(v)))
+	}
+
+	key, val, ok := l.Get(makeKey("01010"))
+	require.True(t, ok)
+	require.EqualValues(t, "01010", key.UserKey)
+	require.EqualValues(t, "v01010", val)
+
+	key, val, ok = l.Get(makeKey("01005"))
+	require.True(t, ok)
+	require.EqualValues(t, "01010", key.UserKey)
+	require.EqualValues(t, "v01010", val)
+
+	_, _, ok = l.Get(makeKey("99999"))
+	require.False(t, ok)
+
+	getKey := makeKey("01500")
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _, _ = l.Get(getKey)
+	})
+	require.EqualValues(t, 0, allocs)
+}
+
 func TestIteratorSeekLT(t *testing.T) {
 	const n = 100
 	l := NewSkiplist(newArena(arenaSize), bytes.Compare)
@@ -197,3 +197,25 @@ type InternalIterator interface {
 
 	fmt.Stringer
 }
+
+// InternalIteratorStats contains miscellaneous stats produced by
+// InternalIterators that are part of the InternalIterator tree. Not every
+// field is relevant for an InternalIterator implementation.
+type InternalIteratorStats struct {
+	// BlockCount is the number of blocks loaded by sstable iterators while
+	// positioning.
+	BlockCount uint64
+	// BlockBytes is the number of bytes in the loaded blocks. The number of
+	// bytes read from disk is BlockBytes minus BlockBytesInCache.
+	BlockBytes uint64
+	// BlockBytesInCache is the subset of BlockBytes in blocks that were found
+	// in the block cache.
+	BlockBytesInCache uint64
+}
+
+// Merge adds all the stats in from to s.
+func (s *InternalIteratorStats) Merge(from InternalIteratorStats) {
+	s.BlockCount += from.BlockCount
+	s.BlockBytes += from.BlockBytes
+	s.BlockBytesInCache += from.BlockBytesInCache
+}
@@ -5,6 +5,8 @@
 package metamorphic
 
 import (
+	"time"
+
 	"github.com/cockroachdb/pebble"
 	"github.com/cockroachdb/pebble/bloom"
 	"github.com/cockroachdb/pebble/internal/cache"
@@ -165,6 +167,10 @@ func standardOptions() []*testOptions {
 		19: `
 [TestOptions]
   ingest_using_apply=true
+`,
+		20: `
+[Options]
+  compaction_style=tiered
 `,
 	}
 
@@ -197,6 +203,42 @@ func randomOptions(rng *rand.Rand) *testOptions {
 	opts.MaxManifestFileSize = 1 << uint(rng.Intn(30)) // 1B  - 1GB
 	opts.MemTableSize = 1 << (10 + uint(rng.Intn(17))) // 1KB - 256MB
 	opts.MemTableStopWritesThreshold = 2 + rng.Intn(5) // 2 - 5
+	if rng.Intn(2) == 0 {
+		opts.Experimental.MemTableBloomSizeRatio = 0.01 + 0.1*rng.Float64() // 1% - 11%
+	}
+	if rng.Intn(2) == 0 {
+		opts.Experimental.MemTableMaxHeight = 4 + rng.Intn(17)                 // 4 - 20
+		opts.Experimental.MemTableHeightProbability = 0.25 + 0.5*rng.Float64() // 25% - 75%
+	}
+	if rng.Intn(2) == 0 {
+		opts.Experimental.MemTableTombstoneFlushRatio = 0.25 + 0.75*rng.Float64() // 25% - 100%
+		opts.Experimental.MemTableTombstoneFlushMinRecords = 1 + rng.Intn(1000)   // 1 - 1000
+	}
+	if rng.Intn(2) == 0 {
+		opts.TableChecksum = pebble.ChecksumTypeXXHash64
+	}
+	if rng.Intn(2) == 0 {
+		opts.Experimental.TableWriterParallelism = 2 + rng.Intn(7) // 2 - 8
+	}
+	if rng.Intn(2) == 0 {
+		opts.Experimental.WALCompression = true
+	}
+	if rng.Intn(2) == 0 {
+		opts.Experimental.MaxSubcompactions = 2 + rng.Intn(3) // 2 - 4
+	}
+	if rng.Intn(2) == 0 {
+		opts.Experimental.MaxCompactionRate = 1 << (20 + uint(rng.Intn(7))) // 1MB - 64MB
+	}
+	if rng.Intn(2) == 0 {
+		opts.CompactionStyle = pebble.CompactionStyleTiered
+	}
+	if rng.Intn(2) == 0 {
+		opts.Experimental.TombstoneDenseCompactionRatio = 0.1 + 0.9*rng.Float64()  // 10% - 100%
+		opts.Experimental.TombstoneDenseCompactionMinDeletions = 1 + rng.Intn(100) // 1 - 100
+	}
+	if rng.Intn(2) == 0 {
+		opts.Experimental.PeriodicCompactionAge = time.Duration(1+rng.Intn(10)) * time.Second // 1s - 10s
+	}
 	if rng.Intn(2) == 0 {
 		opts.WALDir = "wal"
 	}
@@ -206,6 +248,7 @@ func randomOptions(rng *rand.Rand) *testOptions {
 	lopts.BlockSizeThreshold = 50 + rng.Intn(50)   // 50 - 100
 	lopts.IndexBlockSize = 1 << uint(rng.Intn(24)) // 1 - 16MB
 	lopts.TargetFileSize = 1 << uint(rng.Intn(28)) // 1 - 256MB
+	lopts.DataBlockHashIndex = rng.Intn(2) == 0
 	opts.Levels = []pebble.LevelOptions{lopts}
 
 	testOpts.opts = opts
@@ -7,7 +7,8 @@ package rangedel
 import "github.com/cockroachdb/pebble/internal/base"
 
 // Truncate creates a new iterator where every tombstone in the supplied
-// iterator is truncated to be contained within the range [lower, upper).
+// iterator is truncated to be contained within the range [lower, upper). A
+// nil upper bound leaves the range unbounded above.
 // If start and end are specified, filter out any range tombstones that
 // are completely outside those bounds.
 func Truncate(
@@ -37,7 +38,7 @@ func Truncate(
 		if cmp(t.Start.UserKey, lower) < 0 {
 			t.Start.UserKey = lower
 		}
-		if cmp(t.End, upper) > 0 {
+		if upper != nil && cmp(t.End, upper) > 0 {
 			t.End = upper
 		}
 		if cmp(t.Start.UserKey, t.End) < 0 {
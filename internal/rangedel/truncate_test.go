@@ -50,7 +50,10 @@ func TestTruncate(t *testing.T) {
 				t.Fatalf("malformed arg: %s", d.CmdArgs[0])
 			}
 			lower := []byte(parts[0])
-			upper := []byte(parts[1])
+			var upper []byte
+			if parts[1] != "" {
+				upper = []byte(parts[1])
+			}
 
 			truncated := Truncate(cmp, iter, lower, upper, startKey, endKey)
 			return formatTombstones(truncated.tombstones)
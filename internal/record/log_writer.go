@@ -581,6 +581,24 @@ func (w *LogWriter) WriteRecord(p []byte) (int64, error) {
 // record.
 // External synchronisation provided by commitPipeline.mu.
 func (w *LogWriter) SyncRecord(p []byte, wg *sync.WaitGroup, err *error) (int64, error) {
+	return w.syncRecord(p, false /* compressed */, wg, err)
+}
+
+// SyncCompressedRecord is like SyncRecord, but p is the Snappy encoding of the
+// record, which is written with the compressed chunk types and decompressed
+// by a Reader. Logs containing compressed records cannot be read by versions
+// of Pebble which predate compression. The caller is expected to compress the
+// record before acquiring the external synchronisation.
+// External synchronisation provided by commitPipeline.mu.
+func (w *LogWriter) SyncCompressedRecord(
+	p []byte, wg *sync.WaitGroup, err *error,
+) (int64, error) {
+	return w.syncRecord(p, true /* compressed */, wg, err)
+}
+
+func (w *LogWriter) syncRecord(
+	p []byte, compressed bool, wg *sync.WaitGroup, err *error,
+) (int64, error) {
 	if w.err != nil {
 		return -1, w.err
 	}
@@ -590,7 +608,7 @@ func (w *LogWriter) SyncRecord(p []byte, wg *sync.WaitGroup, err *error) (int64,
 	// MANIFEST is currently written using Writer, it is good to support the same
 	// semantics with LogWriter.
 	for i := 0; i == 0 || len(p) > 0; i++ {
-		p = w.emitFragment(i, p)
+		p = w.emitFragment(i, p, compressed)
 	}
 
 	if wg != nil {
@@ -630,7 +648,7 @@ func (w *LogWriter) emitEOFTrailer() {
 	atomic.StoreInt32(&b.written, i+int32(recyclableHeaderSize))
 }
 
-func (w *LogWriter) emitFragment(n int, p []byte) []byte {
+func (w *LogWriter) emitFragment(n int, p []byte, compressed bool) []byte {
 	b := w.block
 	i := b.written
 	first := n == 0
@@ -649,6 +667,9 @@ func (w *LogWriter) emitFragment(n int, p []byte) []byte {
 			b.buf[i+6] = recyclableMiddleChunkType
 		}
 	}
+	if compressed {
+		b.buf[i+6] += compressedFullChunkType - recyclableFullChunkType
+	}
 
 	binary.LittleEndian.PutUint32(b.buf[i+7:i+11], w.logNum)
 
@@ -93,6 +93,15 @@
 // (i.e. full, first, middle, last). The CRC is computed over the type, log
 // number, and payload.
 //
+// A record written by a LogWriter may additionally be compressed with Snappy.
+// The chunks of a compressed record use 4 further "compressed" chunk types,
+// which map directly to the recyclable chunk types and share the recyclable
+// chunk format. The payloads of the chunks of a compressed record concatenate
+// to the Snappy encoding of the record. A LogWriter only compresses a record
+// if doing so makes it smaller, so a log may contain a mix of compressed and
+// uncompressed records. Logs written without compression remain readable by
+// older readers.
+//
 // The wire format allows for limited recovery in the face of data corruption:
 // on a format error (such as a checksum mismatch), the reader moves to the
 // next block and looks for the next full or first chunk.
@@ -104,12 +113,14 @@ package record // import "github.com/cockroachdb/pebble/internal/record"
 // instead of "chunk", but "chunk" is shorter and less confusing.
 
 import (
+	"bytes"
 	"encoding/binary"
 	"io"
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/crc"
+	"github.com/golang/snappy"
 )
 
 // These constants are part of the wire format and should not be changed.
@@ -123,6 +134,11 @@ const (
 	recyclableFirstChunkType  = 6
 	recyclableMiddleChunkType = 7
 	recyclableLastChunkType   = 8
+
+	compressedFullChunkType   = 9
+	compressedFirstChunkType  = 10
+	compressedMiddleChunkType = 11
+	compressedLastChunkType   = 12
 )
 
 const (
@@ -177,6 +193,11 @@ type Reader struct {
 	recovering bool
 	// last is whether the current chunk is the last chunk of the record.
 	last bool
+	// compressed is whether the current chunk is part of a compressed record.
+	compressed bool
+	// decompressed holds the decompressed contents of the current record, if
+	// the record is compressed.
+	decompressed []byte
 	// err is any accumulated error.
 	err error
 	// buf is the buffer.
@@ -214,15 +235,19 @@ func (r *Reader) nextChunk(wantFirst bool) error {
 					// Skip the rest of the block, if it looks like it is all
 					// zeroes. This is common with WAL preallocation.
 					//
-					// Set r.err to be an error so r.recover actually recovers.
+					// Set r.err to be an error so r.Recover actually recovers.
 					r.err = ErrZeroedChunk
-					r.recover()
+					r.Recover()
 					continue
 				}
 				return ErrZeroedChunk
 			}
 
 			headerSize := legacyHeaderSize
+			compressed := chunkType >= compressedFullChunkType && chunkType <= compressedLastChunkType
+			if compressed {
+				chunkType -= (compressedFullChunkType - recyclableFullChunkType)
+			}
 			if chunkType >= recyclableFullChunkType && chunkType <= recyclableLastChunkType {
 				headerSize = recyclableHeaderSize
 				if r.end+headerSize > r.n {
@@ -248,14 +273,14 @@ func (r *Reader) nextChunk(wantFirst bool) error {
 			r.end = r.begin + int(length)
 			if r.end > r.n {
 				if r.recovering {
-					r.recover()
+					r.Recover()
 					continue
 				}
 				return ErrInvalidChunk
 			}
 			if checksum != crc.New(r.buf[r.begin-headerSize+6:r.end]).Value() {
 				if r.recovering {
-					r.recover()
+					r.Recover()
 					continue
 				}
 				return ErrInvalidChunk
@@ -265,6 +290,7 @@ func (r *Reader) nextChunk(wantFirst bool) error {
 					continue
 				}
 			}
+			r.compressed = compressed
 			r.last = chunkType == fullChunkType || chunkType == lastChunkType
 			r.recovering = false
 			return nil
@@ -303,9 +329,48 @@ func (r *Reader) Next() (io.Reader, error) {
 	if r.err != nil {
 		return nil, r.err
 	}
+	if r.compressed {
+		return r.decompress()
+	}
 	return singleReader{r, r.seq}, nil
 }
 
+// decompress reads the remainder of the current compressed record and returns
+// a reader for its decompressed contents.
+func (r *Reader) decompress() (io.Reader, error) {
+	var compressed []byte
+	for {
+		compressed = append(compressed, r.buf[r.begin:r.end]...)
+		r.begin = r.end
+		if r.last {
+			break
+		}
+		if r.err = r.nextChunk(false); r.err != nil {
+			return nil, r.err
+		}
+		if !r.compressed {
+			// All of the chunks of a record must agree on whether the record is
+			// compressed.
+			r.err = ErrInvalidChunk
+			return nil, r.err
+		}
+	}
+	n, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		r.err = ErrInvalidChunk
+		return nil, r.err
+	}
+	if cap(r.decompressed) < n {
+		r.decompressed = make([]byte, n)
+	}
+	r.decompressed, err = snappy.Decode(r.decompressed[:n], compressed)
+	if err != nil {
+		r.err = ErrInvalidChunk
+		return nil, r.err
+	}
+	return bytes.NewReader(r.decompressed), nil
+}
+
 // Offset returns the current offset within the file. If called immediately
 // before a call to Next(), Offset() will return the record offset.
 func (r *Reader) Offset() int64 {
@@ -315,12 +380,12 @@ func (r *Reader) Offset() int64 {
 	return int64(r.blockNum)*blockSize + int64(r.end)
 }
 
-// recover clears any errors read so far, so that calling Next will start
+// Recover clears any errors read so far, so that calling Next will start
 // reading from the next good 32KiB block. If there are no such blocks, Next
-// will return io.EOF. recover also marks the current reader, the one most
-// recently returned by Next, as stale. If recover is called without any
-// prior error, then recover is a no-op.
-func (r *Reader) recover() {
+// will return io.EOF. Recover also marks the current reader, the one most
+// recently returned by Next, as stale. If Recover is called without any
+// prior error, then Recover is a no-op.
+func (r *Reader) Recover() {
 	if r.err == nil {
 		return
 	}
@@ -401,6 +466,10 @@ func (x singleReader) Read(p []byte) (int, error) {
 		if r.err = r.nextChunk(false); r.err != nil {
 			return 0, r.err
 		}
+		if r.compressed {
+			r.err = ErrInvalidChunk
+			return 0, r.err
+		}
 	}
 	n := copy(p, r.buf[r.begin:r.end])
 	r.begin += n
@@ -18,6 +18,7 @@ import (
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/golang/snappy"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/exp/rand"
 )
@@ -378,7 +379,7 @@ func TestRecoverNoOp(t *testing.T) {
 	seq, begin, end, n := r.seq, r.begin, r.end, r.n
 
 	// Should be a no-op since r.err == nil.
-	r.recover()
+	r.Recover()
 
 	// r.err was nil, nothing should have changed.
 	if seq != r.seq || begin != r.begin || end != r.end || n != r.n {
@@ -425,7 +426,7 @@ func TestBasicRecover(t *testing.T) {
 	}
 
 	// Recover from that checksum mismatch.
-	r.recover()
+	r.Recover()
 	currentOffset, err := underlyingReader.Seek(0, os.SEEK_CUR)
 	if err != nil {
 		t.Fatalf("current offset: %v", err)
@@ -482,7 +483,7 @@ func TestRecoverSingleBlock(t *testing.T) {
 	}
 
 	// Recover from that checksum mismatch.
-	r.recover()
+	r.Recover()
 
 	// All of the data in the second record r1 is lost because the first record
 	// r0 shared a partial block with it. The second record also overlapped
@@ -540,7 +541,7 @@ func TestRecoverMultipleBlocks(t *testing.T) {
 	}
 
 	// Recover from that checksum mismatch.
-	r.recover()
+	r.Recover()
 
 	// All of the data in the second record is lost because the first
 	// record shared a partial block with it. The following two records
@@ -570,7 +571,7 @@ func verifyLastBlockRecover(recs *testRecords) error {
 			if err == nil {
 				return errors.New("Expected a checksum mismatch error, got nil")
 			}
-			r.recover()
+			r.Recover()
 		case len(recs.records):
 			if err != io.EOF {
 				return errors.Errorf("Expected io.EOF, got %v", err)
@@ -701,7 +702,7 @@ func TestSeekRecord(t *testing.T) {
 	if _, err = r.Next(); err == nil {
 		t.Fatalf("Expected an error seeking to an invalid chunk boundary")
 	}
-	r.recover()
+	r.Recover()
 
 	// Seek to the fifth block and verify all records can be read as appropriate.
 	err = r.seekRecord(blockSize * 4)
@@ -739,7 +740,7 @@ func TestSeekRecord(t *testing.T) {
 	if err != io.ErrUnexpectedEOF {
 		t.Fatalf("Seeking past EOF raised unexpected error: %v", err)
 	}
-	r.recover() // Verify recovery works.
+	r.Recover() // Verify recovery works.
 
 	// Validate the current records are returned after seeking to a valid offset.
 	err = r.seekRecord(blockSize * 4)
@@ -1037,6 +1038,63 @@ func TestRecycleLogWithPartialRecord(t *testing.T) {
 	require.Equal(t, err, ErrInvalidChunk)
 }
 
+func TestCompression(t *testing.T) {
+	// Compressible records of various sizes, including ones spanning multiple
+	// blocks, interleaved with incompressible records, which are written
+	// uncompressed as a DB does.
+	rnd := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+	var records [][]byte
+	var randomSize int
+	for _, n := range []int{0, 1, 100, blockSize, 3 * blockSize} {
+		records = append(records, bytes.Repeat([]byte("a"), n))
+		random := make([]byte, n)
+		_, _ = rnd.Read(random)
+		records = append(records, random)
+		randomSize += n
+	}
+
+	var buf bytes.Buffer
+	w := NewLogWriter(&buf, base.FileNum(1))
+	for _, rec := range records {
+		var err error
+		if c := snappy.Encode(nil, rec); len(c) < len(rec) {
+			_, err = w.SyncCompressedRecord(c, nil, nil)
+		} else {
+			_, err = w.WriteRecord(rec)
+		}
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	// The compressible records take up little space in the log.
+	require.Less(t, buf.Len(), randomSize+blockSize/2)
+
+	r := NewReader(bytes.NewReader(buf.Bytes()), base.FileNum(1))
+	for i, rec := range records {
+		rr, err := r.Next()
+		require.NoError(t, err, "%d", i)
+		x, err := ioutil.ReadAll(rr)
+		require.NoError(t, err, "%d", i)
+		require.Equal(t, rec, x, "%d", i)
+	}
+	_, err := r.Next()
+	require.Equal(t, io.EOF, err)
+
+	// A corrupted compressed record is detected by the chunk checksum.
+	b := buf.Bytes()
+	b[len(b)/2] ^= 0xff
+	r = NewReader(bytes.NewReader(b), base.FileNum(1))
+	for {
+		rr, err := r.Next()
+		if err == nil {
+			_, err = ioutil.ReadAll(rr)
+		}
+		if err != nil {
+			require.Equal(t, ErrInvalidChunk, err)
+			break
+		}
+	}
+}
+
 func BenchmarkRecordWrite(b *testing.B) {
 	for _, size := range []int{8, 16, 32, 64, 256, 1028, 4096, 65_536} {
 		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
@@ -45,6 +45,37 @@ type IteratorMetrics struct {
 	ReadAmp int
 }
 
+// IteratorStatsKind describes the two kinds of iterator stats.
+type IteratorStatsKind int8
+
+const (
+	// InterfaceCall represents calls to Iterator.
+	InterfaceCall IteratorStatsKind = iota
+	// InternalIterCall represents calls by Iterator to its internalIterator.
+	InternalIterCall
+	// NumStatsKind is the number of kinds, and is used for array sizing.
+	NumStatsKind
+)
+
+// IteratorStats contains iteration stats.
+type IteratorStats struct {
+	// ForwardSeekCount includes SeekGE, SeekPrefixGE, First.
+	ForwardSeekCount [NumStatsKind]int
+	// ReverseSeekCount includes SeekLT, Last.
+	ReverseSeekCount [NumStatsKind]int
+	// ForwardStepCount includes Next.
+	ForwardStepCount [NumStatsKind]int
+	// ReverseStepCount includes Prev.
+	ReverseStepCount [NumStatsKind]int
+	// SkippedKeyCount is the number of internal keys stepped over without
+	// being returned: deletion tombstones, and the versions of user keys which
+	// are shadowed by newer versions or deletion tombstones.
+	SkippedKeyCount int
+	// InternalStats contains the stats of the sstable iterators, such as the
+	// number of blocks loaded and the bytes read from the block cache.
+	InternalStats InternalIteratorStats
+}
+
 // Iterator iterates over a DB's key/value pairs in key order.
 //
 // An iterator must be closed after use, but it is not necessary to read an
@@ -81,10 +112,12 @@ type Iterator struct {
 	iterKey      *InternalKey
 	iterValue    []byte
 	alloc        *iterAlloc
+	getIterAlloc *getIterAlloc
 	prefix       []byte
 	readSampling readSampling
+	stats        IteratorStats
 
-	// Following fields are only used in Clone.
+	// Following fields are only used in Clone and Refresh.
 	// Non-nil if this Iterator includes a Batch.
 	batch    *Batch
 	newIters tableNewIters
@@ -99,6 +132,9 @@ type Iterator struct {
 	hasPrefix bool
 	// Used for deriving the value of SeekPrefixGE(..., trySeekUsingNext).
 	lastPositioningOpIsSeekPrefixGE bool
+	// True if this Iterator reads at a Snapshot, in which case it cannot be
+	// refreshed.
+	snapshot bool
 }
 
 // readSampling stores variables used to sample a read to trigger a read
@@ -135,6 +171,7 @@ func (i *Iterator) findNextEntry() bool {
 
 		switch key.Kind() {
 		case InternalKeyKindDelete, InternalKeyKindSingleDelete:
+			i.stats.SkippedKeyCount++
 			i.nextUserKey()
 			continue
 
@@ -175,6 +212,7 @@ func (i *Iterator) nextUserKey() {
 		i.key = i.keyBuf
 	}
 	for {
+		i.stats.ForwardStepCount[InternalIterCall]++
 		i.iterKey, i.iterValue = i.iter.Next()
 		if done || i.iterKey == nil {
 			break
@@ -182,6 +220,7 @@ func (i *Iterator) nextUserKey() {
 		if !i.equal(i.key, i.iterKey.UserKey) {
 			break
 		}
+		i.stats.SkippedKeyCount++
 		done = i.iterKey.SeqNum() == 0
 	}
 }
@@ -274,6 +313,10 @@ func (i *Iterator) findPrevEntry() bool {
 	}
 
 	var valueMerger ValueMerger
+	// keyCount is the number of internal keys for the current user key which
+	// contribute to its value. They are skipped if a newer deletion tombstone
+	// or Set is encountered.
+	var keyCount int
 	for i.iterKey != nil {
 		key := *i.iterKey
 
@@ -290,13 +333,18 @@ func (i *Iterator) findPrevEntry() bool {
 
 		switch key.Kind() {
 		case InternalKeyKindDelete, InternalKeyKindSingleDelete:
+			i.stats.SkippedKeyCount += keyCount + 1
+			keyCount = 0
 			i.value = nil
 			i.valid = false
 			valueMerger = nil
+			i.stats.ReverseStepCount[InternalIterCall]++
 			i.iterKey, i.iterValue = i.iter.Prev()
 			continue
 
 		case InternalKeyKindSet:
+			i.stats.SkippedKeyCount += keyCount
+			keyCount = 1
 			i.keyBuf = append(i.keyBuf[:0], key.UserKey...)
 			i.key = i.keyBuf
 			// iterValue is owned by i.iter and could change after the Prev()
@@ -306,11 +354,13 @@ func (i *Iterator) findPrevEntry() bool {
 			i.valueBuf = append(i.valueBuf[:0], i.iterValue...)
 			i.value = i.valueBuf
 			i.valid = true
+			i.stats.ReverseStepCount[InternalIterCall]++
 			i.iterKey, i.iterValue = i.iter.Prev()
 			valueMerger = nil
 			continue
 
 		case InternalKeyKindMerge:
+			keyCount++
 			if !i.valid {
 				i.keyBuf = append(i.keyBuf[:0], key.UserKey...)
 				i.key = i.keyBuf
@@ -333,6 +383,7 @@ func (i *Iterator) findPrevEntry() bool {
 					return false
 				}
 			}
+			i.stats.ReverseStepCount[InternalIterCall]++
 			i.iterKey, i.iterValue = i.iter.Prev()
 			continue
 
@@ -365,6 +416,7 @@ func (i *Iterator) prevUserKey() {
 		i.key = i.keyBuf
 	}
 	for {
+		i.stats.ReverseStepCount[InternalIterCall]++
 		i.iterKey, i.iterValue = i.iter.Prev()
 		if i.iterKey == nil {
 			break
@@ -383,6 +435,7 @@ func (i *Iterator) mergeNext(key InternalKey, valueMerger ValueMerger) {
 
 	// Loop looking for older values for this key and merging them.
 	for {
+		i.stats.ForwardStepCount[InternalIterCall]++
 		i.iterKey, i.iterValue = i.iter.Next()
 		if i.iterKey == nil {
 			i.pos = iterPosNext
@@ -425,6 +478,7 @@ func (i *Iterator) mergeNext(key InternalKey, valueMerger ValueMerger) {
 // than or equal to the given key. Returns true if the iterator is pointing at
 // a valid entry and false otherwise.
 func (i *Iterator) SeekGE(key []byte) bool {
+	i.stats.ForwardSeekCount[InterfaceCall]++
 	i.err = nil // clear cached iteration error
 	i.hasPrefix = false
 	i.lastPositioningOpIsSeekPrefixGE = false
@@ -434,6 +488,7 @@ func (i *Iterator) SeekGE(key []byte) bool {
 		key = upperBound
 	}
 
+	i.stats.ForwardSeekCount[InternalIterCall]++
 	i.iterKey, i.iterValue = i.iter.SeekGE(key)
 	valid := i.findNextEntry()
 	i.maybeSampleRead()
@@ -484,6 +539,7 @@ func (i *Iterator) SeekGE(key []byte) bool {
 //
 // See Example_prefixiteration for a working example.
 func (i *Iterator) SeekPrefixGE(key []byte) bool {
+	i.stats.ForwardSeekCount[InterfaceCall]++
 	lastPositioningOpIsSeekPrefixGE := i.lastPositioningOpIsSeekPrefixGE
 	// Set it to false, since this operation may not succeed, in which case
 	// the SeekPrefixGE following this should not make any assumption about
@@ -550,6 +606,7 @@ func (i *Iterator) SeekPrefixGE(key []byte) bool {
 		key = upperBound
 	}
 
+	i.stats.ForwardSeekCount[InternalIterCall]++
 	i.iterKey, i.iterValue = i.iter.SeekPrefixGE(i.prefix, key, trySeekUsingNext)
 	valid := i.findNextEntry()
 	i.maybeSampleRead()
@@ -572,6 +629,7 @@ func disableSeekOpt(key []byte, ptr uintptr) bool {
 // the given key. Returns true if the iterator is pointing at a valid entry and
 // false otherwise.
 func (i *Iterator) SeekLT(key []byte) bool {
+	i.stats.ReverseSeekCount[InterfaceCall]++
 	i.err = nil // clear cached iteration error
 	i.hasPrefix = false
 	i.lastPositioningOpIsSeekPrefixGE = false
@@ -581,6 +639,7 @@ func (i *Iterator) SeekLT(key []byte) bool {
 		key = lowerBound
 	}
 
+	i.stats.ReverseSeekCount[InternalIterCall]++
 	i.iterKey, i.iterValue = i.iter.SeekLT(key)
 	valid := i.findPrevEntry()
 	i.maybeSampleRead()
@@ -590,12 +649,15 @@ func (i *Iterator) SeekLT(key []byte) bool {
 // First moves the iterator the the first key/value pair. Returns true if the
 // iterator is pointing at a valid entry and false otherwise.
 func (i *Iterator) First() bool {
+	i.stats.ForwardSeekCount[InterfaceCall]++
 	i.err = nil // clear cached iteration error
 	i.hasPrefix = false
 	i.lastPositioningOpIsSeekPrefixGE = false
 	if lowerBound := i.opts.GetLowerBound(); lowerBound != nil {
+		i.stats.ForwardSeekCount[InternalIterCall]++
 		i.iterKey, i.iterValue = i.iter.SeekGE(lowerBound)
 	} else {
+		i.stats.ForwardSeekCount[InternalIterCall]++
 		i.iterKey, i.iterValue = i.iter.First()
 	}
 	valid := i.findNextEntry()
@@ -606,12 +668,15 @@ func (i *Iterator) First() bool {
 // Last moves the iterator the the last key/value pair. Returns true if the
 // iterator is pointing at a valid entry and false otherwise.
 func (i *Iterator) Last() bool {
+	i.stats.ReverseSeekCount[InterfaceCall]++
 	i.err = nil // clear cached iteration error
 	i.hasPrefix = false
 	i.lastPositioningOpIsSeekPrefixGE = false
 	if upperBound := i.opts.GetUpperBound(); upperBound != nil {
+		i.stats.ReverseSeekCount[InternalIterCall]++
 		i.iterKey, i.iterValue = i.iter.SeekLT(upperBound)
 	} else {
+		i.stats.ReverseSeekCount[InternalIterCall]++
 		i.iterKey, i.iterValue = i.iter.Last()
 	}
 	valid := i.findPrevEntry()
@@ -622,6 +687,7 @@ func (i *Iterator) Last() bool {
 // Next moves the iterator to the next key/value pair. Returns true if the
 // iterator is pointing at a valid entry and false otherwise.
 func (i *Iterator) Next() bool {
+	i.stats.ForwardStepCount[InterfaceCall]++
 	if i.err != nil {
 		return false
 	}
@@ -641,8 +707,10 @@ func (i *Iterator) Next() bool {
 		// We're positioned before the first key. Need to reposition to point to
 		// the first key.
 		if lowerBound := i.opts.GetLowerBound(); lowerBound != nil {
+			i.stats.ForwardSeekCount[InternalIterCall]++
 			i.iterKey, i.iterValue = i.iter.SeekGE(lowerBound)
 		} else {
+			i.stats.ForwardSeekCount[InternalIterCall]++
 			i.iterKey, i.iterValue = i.iter.First()
 		}
 	case iterPosPrev:
@@ -655,8 +723,10 @@ func (i *Iterator) Next() bool {
 			// We're positioned before the first key. Need to reposition to point to
 			// the first key.
 			if lowerBound := i.opts.GetLowerBound(); lowerBound != nil {
+				i.stats.ForwardSeekCount[InternalIterCall]++
 				i.iterKey, i.iterValue = i.iter.SeekGE(lowerBound)
 			} else {
+				i.stats.ForwardSeekCount[InternalIterCall]++
 				i.iterKey, i.iterValue = i.iter.First()
 			}
 		} else {
@@ -673,6 +743,7 @@ func (i *Iterator) Next() bool {
 // Prev moves the iterator to the previous key/value pair. Returns true if the
 // iterator is pointing at a valid entry and false otherwise.
 func (i *Iterator) Prev() bool {
+	i.stats.ReverseStepCount[InterfaceCall]++
 	if i.err != nil {
 		return false
 	}
@@ -702,8 +773,10 @@ func (i *Iterator) Prev() bool {
 			// We're positioned after the last key. Need to reposition to point to
 			// the last key.
 			if upperBound := i.opts.GetUpperBound(); upperBound != nil {
+				i.stats.ReverseSeekCount[InternalIterCall]++
 				i.iterKey, i.iterValue = i.iter.SeekLT(upperBound)
 			} else {
+				i.stats.ReverseSeekCount[InternalIterCall]++
 				i.iterKey, i.iterValue = i.iter.Last()
 			}
 		} else {
@@ -779,17 +852,21 @@ func (i *Iterator) Close() error {
 		i.valueCloser = nil
 	}
 
+	// Avoid caching the key buf if it is overly large. The constant is fairly
+	// arbitrary.
+	const maxKeyBufCacheSize = 4 << 10 // 4 KB
+	keyBuf := i.keyBuf
+	if cap(keyBuf) >= maxKeyBufCacheSize {
+		keyBuf = nil
+	}
 	if alloc := i.alloc; alloc != nil {
-		// Avoid caching the key buf if it is overly large. The constant is fairly
-		// arbitrary.
-		const maxKeyBufCacheSize = 4 << 10 // 4 KB
-		if cap(i.keyBuf) >= maxKeyBufCacheSize {
-			alloc.keyBuf = nil
-		} else {
-			alloc.keyBuf = i.keyBuf
-		}
+		alloc.keyBuf = keyBuf
 		*i = Iterator{}
 		iterAllocPool.Put(alloc)
+	} else if alloc := i.getIterAlloc; alloc != nil {
+		alloc.keyBuf = keyBuf
+		*i = Iterator{}
+		getIterAllocPool.Put(alloc)
 	}
 	return err
 }
@@ -841,6 +918,12 @@ func (i *Iterator) Metrics() IteratorMetrics {
 	return m
 }
 
+// Stats returns the current stats of the iterator, accumulated since it was
+// created.
+func (i *Iterator) Stats() IteratorStats {
+	return i.stats
+}
+
 // Clone creates a new Iterator over the same underlying data, i.e., over the
 // same {batch, memtables, sstables}). It starts with the same IterOptions but
 // is not positioned. Note that IterOptions is not deep-copied, so the
@@ -883,6 +966,111 @@ func (i *Iterator) Clone() (*Iterator, error) {
 		batch:     i.batch,
 		newIters:  i.newIters,
 		seqNum:    i.seqNum,
+		snapshot:  i.snapshot,
 	}
 	return finishInitializingIter(buf), nil
 }
+
+// Refresh updates the iterator to observe the writes committed to the DB
+// since the iterator was created or last refreshed. The iterator is
+// invalidated and must be repositioned with a call to SeekGE, SeekPrefixGE,
+// SeekLT, First, or Last. This allows a long-lived iterator, such as one used
+// by a queue or stream consumer, to observe new writes without the cost of
+// creating a new Iterator.
+//
+// If the sstables and memtables of the DB have not changed since the iterator
+// was created or last refreshed, only the memtable iterators are recreated.
+// Otherwise, all of the underlying iterators are recreated. Note that a
+// refreshed iterator holds a reference to the latest state of the DB, so
+// Refresh also releases the resources retained by the previous state.
+//
+// Refresh returns an error if the iterator reads at a Snapshot.
+func (i *Iterator) Refresh() error {
+	readState := i.readState
+	if readState == nil {
+		return errors.Errorf("pebble: cannot Refresh a closed Iterator")
+	}
+	if i.snapshot {
+		return errors.Errorf("pebble: cannot Refresh an Iterator reading at a Snapshot")
+	}
+	d := readState.db
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+
+	// Grab and reference the current readState before determining the seqnum
+	// to read at, as in DB.newIterInternal.
+	newReadState := d.loadReadState()
+	seqNum := atomic.LoadUint64(&d.mu.versions.atomic.visibleSeqNum)
+
+	i.err = nil
+	i.iterKey = nil
+	i.iterValue = nil
+	i.valid = false
+	i.pos = iterPosCurForward
+	i.hasPrefix = false
+	i.lastPositioningOpIsSeekPrefixGE = false
+	if i.valueCloser != nil {
+		i.err = i.valueCloser.Close()
+		i.valueCloser = nil
+	}
+
+	if newReadState == readState && i.refreshMemTables(seqNum) {
+		// The iterator already holds a reference to the readState.
+		newReadState.unref()
+		return i.err
+	}
+
+	i.err = firstError(i.err, i.iter.Close())
+	readState.unref()
+	i.readState = newReadState
+	i.seqNum = seqNum
+	finishInitializingIter(i.alloc)
+	return i.err
+}
+
+// refreshMemTables recreates the batch and memtable iterators to read at the
+// specified seqnum, leaving the sstable iterators in place. It returns false
+// if the iterator did not read from all of the memtables in its readState, in
+// which case the iterator must be recreated.
+func (i *Iterator) refreshMemTables(seqNum uint64) bool {
+	memtables := i.readState.memtables
+	for _, mem := range memtables {
+		// See finishInitializingIter.
+		if mem.logSeqNum >= i.seqNum {
+			return false
+		}
+	}
+	buf := i.alloc
+	mlevels := buf.merging.levels
+	if i.batch != nil {
+		i.err = firstError(i.err, closeMergingIterLevel(&mlevels[0]))
+		mlevels[0] = mergingIterLevel{
+			iter:         i.batch.newInternalIter(&i.opts),
+			rangeDelIter: i.batch.newRangeDelIter(&i.opts),
+		}
+		mlevels = mlevels[1:]
+	}
+	for j := len(memtables) - 1; j >= 0; j-- {
+		mem := memtables[j]
+		i.err = firstError(i.err, closeMergingIterLevel(&mlevels[0]))
+		mlevels[0] = mergingIterLevel{
+			iter:         mem.newIter(&i.opts),
+			rangeDelIter: mem.newRangeDelIter(&i.opts),
+		}
+		mlevels = mlevels[1:]
+	}
+	i.seqNum = seqNum
+	buf.merging.init(&i.opts, i.cmp, buf.merging.levels...)
+	buf.merging.snapshot = seqNum
+	buf.merging.elideRangeTombstones = true
+	return true
+}
+
+func closeMergingIterLevel(l *mergingIterLevel) error {
+	err := l.iter.Close()
+	if l.rangeDelIter != nil {
+		err = firstError(err, l.rangeDelIter.Close())
+	}
+	return err
+}
@@ -6,6 +6,7 @@ package pebble
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -713,6 +714,369 @@ func TestIteratorTableFilter(t *testing.T) {
 	})
 }
 
+// valueSetCollector is a BlockPropertyCollector which collects the set of
+// first bytes of the values in 'a'-'z', encoded as a bitmask.
+type valueSetCollector struct {
+	block, table uint32
+}
+
+func (c *valueSetCollector) Name() string {
+	return "test.value-set"
+}
+
+func (c *valueSetCollector) Add(key InternalKey, value []byte) error {
+	if len(value) > 0 && value[0] >= 'a' && value[0] <= 'z' {
+		c.block |= 1 << (value[0] - 'a')
+	}
+	return nil
+}
+
+func (c *valueSetCollector) FinishDataBlock(buf []byte) ([]byte, error) {
+	buf = strconv.AppendUint(buf, uint64(c.block), 10)
+	c.table |= c.block
+	c.block = 0
+	return buf, nil
+}
+
+func (c *valueSetCollector) FinishTable(buf []byte) ([]byte, error) {
+	return strconv.AppendUint(buf, uint64(c.table), 10), nil
+}
+
+// valueSetFilter is a BlockPropertyFilter for the values starting with b.
+type valueSetFilter byte
+
+func (f valueSetFilter) Name() string {
+	return "test.value-set"
+}
+
+func (f valueSetFilter) Intersects(prop []byte) (bool, error) {
+	set, err := strconv.ParseUint(string(prop), 10, 32)
+	if err != nil {
+		return false, err
+	}
+	return set&(1<<(f-'a')) != 0, nil
+}
+
+func TestIteratorBlockPropertyFilter(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                    vfs.NewMem(),
+		L0CompactionThreshold: 100,
+		L0StopWritesThreshold: 100,
+		Levels:                []LevelOptions{{BlockSize: 64}},
+		BlockPropertyCollectors: []func() BlockPropertyCollector{
+			func() BlockPropertyCollector { return &valueSetCollector{} },
+		},
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	key := func(i int) []byte { return []byte(fmt.Sprintf("%04d", i)) }
+
+	// The first table holds "a" values followed by "b" values.
+	for i := 0; i < 1000; i++ {
+		value := []byte("a")
+		if i >= 500 {
+			value = []byte("b")
+		}
+		require.NoError(t, d.Set(key(i), value, nil))
+	}
+	require.NoError(t, d.Flush())
+	// The second table holds only "c" values, along with a range deletion
+	// which deletes some of the "b" values in the first table.
+	for i := 1000; i < 1100; i++ {
+		require.NoError(t, d.Set(key(i), []byte("c"), nil))
+	}
+	require.NoError(t, d.DeleteRange(key(500), key(600), nil))
+	require.NoError(t, d.Flush())
+
+	iter := d.NewIter(&IterOptions{
+		BlockPropertyFilters: []BlockPropertyFilter{valueSetFilter('b')},
+	})
+	// Blocks are skipped only if they contain no "b" values, so any returned
+	// key other than a "b" value is an "a" value sharing a block with one.
+	var n int
+	for iter.First(); iter.Valid(); iter.Next() {
+		require.NotEqual(t, "c", string(iter.Value()))
+		if string(iter.Value()) == "b" {
+			n++
+		}
+	}
+	require.Equal(t, 400, n)
+	n = 0
+	for iter.Last(); iter.Valid(); iter.Prev() {
+		require.NotEqual(t, "c", string(iter.Value()))
+		if string(iter.Value()) == "b" {
+			n++
+		}
+	}
+	require.Equal(t, 400, n)
+	require.NoError(t, iter.Close())
+}
+
+func TestIteratorStats(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// The table holds a, b and c, and the memtable holds a newer version of a
+	// and a deletion tombstone for b.
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("c"), []byte("1"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("a"), []byte("2"), nil))
+	require.NoError(t, d.Delete([]byte("b"), nil))
+
+	iter := d.NewIter(nil)
+	var keys []string
+	for iter.First(); iter.Valid(); iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	require.Equal(t, []string{"a", "c"}, keys)
+	stats := iter.Stats()
+	require.Equal(t, 1, stats.ForwardSeekCount[InterfaceCall])
+	require.Equal(t, 2, stats.ForwardStepCount[InterfaceCall])
+	require.Equal(t, 0, stats.ReverseSeekCount[InterfaceCall])
+	require.Equal(t, 0, stats.ReverseStepCount[InterfaceCall])
+	require.Equal(t, 1, stats.ForwardSeekCount[InternalIterCall])
+	require.Less(t, stats.ForwardStepCount[InterfaceCall], stats.ForwardStepCount[InternalIterCall])
+	// The older version of a, the tombstone for b and the version of b it
+	// deletes are skipped.
+	require.Equal(t, 3, stats.SkippedKeyCount)
+	require.Equal(t, uint64(1), stats.InternalStats.BlockCount)
+	require.Less(t, uint64(0), stats.InternalStats.BlockBytes)
+	require.Equal(t, uint64(0), stats.InternalStats.BlockBytesInCache)
+
+	keys = keys[:0]
+	for iter.Last(); iter.Valid(); iter.Prev() {
+		keys = append(keys, string(iter.Key()))
+	}
+	require.Equal(t, []string{"c", "a"}, keys)
+	stats = iter.Stats()
+	require.Equal(t, 1, stats.ReverseSeekCount[InterfaceCall])
+	require.Equal(t, 2, stats.ReverseStepCount[InterfaceCall])
+	require.Equal(t, 6, stats.SkippedKeyCount)
+	require.NoError(t, iter.Close())
+
+	// The data block is now read from the block cache.
+	iter = d.NewIter(nil)
+	require.True(t, iter.First())
+	stats = iter.Stats()
+	require.Equal(t, uint64(1), stats.InternalStats.BlockCount)
+	require.Equal(t, stats.InternalStats.BlockBytes, stats.InternalStats.BlockBytesInCache)
+	require.NoError(t, iter.Close())
+}
+
+func TestIteratorRefresh(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	keys := func(iter *Iterator) string {
+		var keys []string
+		for iter.First(); iter.Valid(); iter.Next() {
+			keys = append(keys, string(iter.Key()))
+		}
+		require.NoError(t, iter.Error())
+		return strings.Join(keys, ",")
+	}
+
+	require.NoError(t, d.Set([]byte("a"), nil, nil))
+	require.NoError(t, d.Set([]byte("b"), nil, nil))
+	require.NoError(t, d.Flush())
+	iter := d.NewIter(nil)
+	require.NoError(t, d.Set([]byte("c"), nil, nil))
+	require.Equal(t, "a,b", keys(iter))
+
+	// Refreshing observes writes to the memtable, including range deletions.
+	require.NoError(t, iter.Refresh())
+	require.False(t, iter.Valid())
+	require.Equal(t, "a,b,c", keys(iter))
+	require.NoError(t, d.DeleteRange([]byte("b"), []byte("c"), nil))
+	require.NoError(t, d.Set([]byte("d"), nil, nil))
+	require.Equal(t, "a,b,c", keys(iter))
+	require.NoError(t, iter.Refresh())
+	require.Equal(t, "a,c,d", keys(iter))
+
+	// Refreshing observes flushes and writes to new memtables.
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Delete([]byte("a"), nil))
+	require.NoError(t, iter.Refresh())
+	require.Equal(t, "c,d", keys(iter))
+
+	// A refreshed iterator can be cloned.
+	clone, err := iter.Clone()
+	require.NoError(t, err)
+	require.Equal(t, "c,d", keys(clone))
+	require.NoError(t, clone.Close())
+	require.NoError(t, iter.Close())
+
+	// Iterators over an indexed batch observe both the batch and the DB.
+	b := d.NewIndexedBatch()
+	require.NoError(t, b.Set([]byte("e"), nil, nil))
+	iter = b.NewIter(nil)
+	require.NoError(t, d.Set([]byte("f"), nil, nil))
+	require.Equal(t, "c,d,e", keys(iter))
+	require.NoError(t, iter.Refresh())
+	require.Equal(t, "c,d,e,f", keys(iter))
+	require.NoError(t, iter.Close())
+	require.NoError(t, b.Close())
+
+	// Iterators reading at a snapshot cannot be refreshed.
+	snap := d.NewSnapshot()
+	iter = snap.NewIter(nil)
+	require.Regexp(t, `cannot Refresh an Iterator reading at a Snapshot`, iter.Refresh())
+	require.Equal(t, "c,d,f", keys(iter))
+	require.NoError(t, iter.Close())
+	require.NoError(t, snap.Close())
+}
+
+// TestIteratorRandomizedReverse writes random interleavings of sets, merges,
+// deletions and range deletions to the memtables and sstables of a DB, and
+// checks that forward and reverse iteration, including switching direction,
+// agree with a model of the DB.
+func TestIteratorRandomizedReverse(t *testing.T) {
+	seed := uint64(time.Now().UnixNano())
+	t.Logf("seed: %d", seed)
+	rng := rand.New(rand.NewSource(seed))
+
+	for run := 0; run < 20; run++ {
+		d, err := Open("", &Options{
+			FS:                    vfs.NewMem(),
+			L0CompactionThreshold: 4,
+		})
+		require.NoError(t, err)
+
+		const numKeys = 20
+		key := func(i int) []byte { return []byte(fmt.Sprintf("%02d", i)) }
+		model := make(map[string]string)
+		for op := 0; op < 200; op++ {
+			k := key(rng.Intn(numKeys))
+			v := []byte(fmt.Sprint(op))
+			switch n := rng.Intn(100); {
+			case n < 35:
+				require.NoError(t, d.Set(k, v, nil))
+				model[string(k)] = string(v)
+			case n < 60:
+				require.NoError(t, d.Merge(k, v, nil))
+				model[string(k)] += string(v)
+			case n < 80:
+				require.NoError(t, d.Delete(k, nil))
+				delete(model, string(k))
+			case n < 90:
+				end := key(rng.Intn(numKeys))
+				if bytes.Compare(end, k) < 0 {
+					k, end = end, k
+				}
+				require.NoError(t, d.DeleteRange(k, end, nil))
+				for mk := range model {
+					if bytes.Compare(k, []byte(mk)) <= 0 && bytes.Compare([]byte(mk), end) < 0 {
+						delete(model, mk)
+					}
+				}
+			case n < 97:
+				require.NoError(t, d.Flush())
+			default:
+				require.NoError(t, d.Compact(key(0), key(numKeys)))
+			}
+		}
+
+		var expected []string
+		for i := 0; i < numKeys; i++ {
+			if v, ok := model[string(key(i))]; ok {
+				expected = append(expected, fmt.Sprintf("%s:%s", key(i), v))
+			}
+		}
+		iter := d.NewIter(nil)
+		kv := func() string {
+			return fmt.Sprintf("%s:%s", iter.Key(), iter.Value())
+		}
+		var forward, reverse []string
+		for iter.First(); iter.Valid(); iter.Next() {
+			forward = append(forward, kv())
+		}
+		for iter.Last(); iter.Valid(); iter.Prev() {
+			reverse = append([]string{kv()}, reverse...)
+		}
+		require.Equal(t, expected, forward)
+		require.Equal(t, expected, reverse)
+
+		// Randomly switch directions, checking each position against the
+		// model.
+		pos := -1
+		if iter.SeekGE(key(rng.Intn(numKeys))) {
+			for pos = 0; expected[pos] != kv(); pos++ {
+			}
+		}
+		for step := 0; step < 50 && pos >= 0; step++ {
+			if rng.Intn(2) == 0 {
+				pos++
+				if iter.Next() {
+					require.Equal(t, expected[pos], kv())
+				} else {
+					require.Equal(t, len(expected), pos)
+					pos = -1
+				}
+			} else {
+				pos--
+				if iter.Prev() {
+					require.Equal(t, expected[pos], kv())
+				} else {
+					require.Equal(t, -1, pos)
+				}
+			}
+		}
+		require.NoError(t, iter.Close())
+		require.NoError(t, d.Close())
+	}
+}
+
+func TestIteratorContext(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:     vfs.NewMem(),
+		Levels: []LevelOptions{{BlockSize: 64}},
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	key := func(i int) []byte { return []byte(fmt.Sprintf("%04d", i)) }
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, d.Set(key(i), key(i), nil))
+	}
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("memtable"), nil, nil))
+
+	// Canceling the context stops the iterator before the next block is
+	// loaded.
+	ctx, cancel := context.WithCancel(context.Background())
+	iter := d.NewIterWithContext(ctx, nil)
+	var n int
+	for iter.First(); iter.Valid() && n < 100; iter.Next() {
+		n++
+	}
+	require.Equal(t, 100, n)
+	cancel()
+	for ; iter.Valid(); iter.Next() {
+		n++
+	}
+	require.Less(t, n, 1000)
+	require.Equal(t, context.Canceled, iter.Error())
+	require.False(t, iter.SeekGE(key(500)))
+	require.Equal(t, context.Canceled, iter.Close())
+
+	// Reads from the memtables do not load blocks.
+	_, closer, err := d.GetWithContext(ctx, []byte("memtable"))
+	require.NoError(t, err)
+	require.NoError(t, closer.Close())
+	_, _, err = d.GetWithContext(ctx, key(500))
+	require.Equal(t, context.Canceled, err)
+
+	value, closer, err := d.GetWithContext(context.Background(), key(500))
+	require.NoError(t, err)
+	require.Equal(t, key(500), value)
+	require.NoError(t, closer.Close())
+}
+
 func TestIteratorNextPrev(t *testing.T) {
 	var mem vfs.FS
 	var d *DB
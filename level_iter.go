@@ -180,6 +180,10 @@ func (l *levelIter) init(
 	l.lower = opts.LowerBound
 	l.upper = opts.UpperBound
 	l.tableOpts.TableFilter = opts.TableFilter
+	l.tableOpts.BlockPropertyFilters = opts.BlockPropertyFilters
+	l.tableOpts.Readahead = opts.Readahead
+	l.tableOpts.stats = opts.stats
+	l.tableOpts.ctx = opts.ctx
 	l.cmp = cmp
 	l.iterFile = nil
 	l.newIters = newIters
@@ -621,6 +625,17 @@ func (l *levelIter) skipEmptyFileForward() (*InternalKey, []byte) {
 				l.largestBoundary = &l.iterFile.Largest
 				return l.largestBoundary, nil
 			}
+			// If block property filters are in use, the point keys of the
+			// sstable may have been skipped even though its range tombstones
+			// apply to keys in other levels. Return a synthetic boundary key at
+			// the largest key of the sstable so that mergingIter can use the
+			// range tombstone iterator until the other levels have reached it.
+			if len(l.tableOpts.BlockPropertyFilters) > 0 && *l.rangeDelIterPtr != nil {
+				l.syntheticBoundary = l.iterFile.Largest
+				l.syntheticBoundary.SetKind(InternalKeyKindRangeDelete)
+				l.largestBoundary = &l.syntheticBoundary
+				return l.largestBoundary, nil
+			}
 		}
 
 		// Current file was exhausted. Move to the next file.
@@ -682,6 +697,13 @@ func (l *levelIter) skipEmptyFileBackward() (*InternalKey, []byte) {
 				l.smallestBoundary = &l.iterFile.Smallest
 				return l.smallestBoundary, nil
 			}
+			// See the comment in skipEmptyFileForward.
+			if len(l.tableOpts.BlockPropertyFilters) > 0 && *l.rangeDelIterPtr != nil {
+				l.syntheticBoundary = l.iterFile.Smallest
+				l.syntheticBoundary.SetKind(InternalKeyKindRangeDelete)
+				l.smallestBoundary = &l.syntheticBoundary
+				return l.smallestBoundary, nil
+			}
 		}
 
 		// Current file was exhausted. Move to the previous file.
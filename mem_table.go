@@ -12,6 +12,7 @@ import (
 	"sync/atomic"
 	"unsafe"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/arenaskl"
 	"github.com/cockroachdb/pebble/internal/base"
@@ -77,9 +78,27 @@ type memTable struct {
 	// drops to zero.
 	writerRefs int32
 	tombstones rangeTombstoneCache
+	// inserters is a pool of *arenaskl.Inserter. Reusing an inserter across
+	// batches retains the splice of the previous insertion so that
+	// mostly-ascending inserts (e.g. time-series or log-structured keys)
+	// avoid a full skiplist descent per key.
+	inserters sync.Pool
+	// kindCounts tracks the number of records of each kind applied to the
+	// memtable. The counts are updated atomically once per applied batch.
+	kindCounts [InternalKeyKindMax + 1]uint32
+	// tombstoneFlushScheduled is set atomically once a flush of the memtable
+	// has been scheduled because it is dominated by point tombstones, so that
+	// later commits do not acquire DB.mu to schedule it again.
+	tombstoneFlushScheduled uint32
+	// filter is an optional bloom filter over the user keys of the point
+	// records in the memtable. See Options.Experimental.MemTableBloomSizeRatio.
+	filter *memTableFilter
 	// The current logSeqNum at the time the memtable was created. This is
 	// guaranteed to be less than or equal to any seqnum stored in the memtable.
 	logSeqNum uint64
+	// Closure to invoke to release the cache reservation for arenaBuf. The
+	// reservation travels with the arena when the arena is recycled.
+	releaseAccountingReservation func()
 }
 
 // memTableOptions holds configuration used when creating a memTable. All of
@@ -88,6 +107,7 @@ type memTable struct {
 type memTableOptions struct {
 	*Options
 	arenaBuf  []byte
+	filter    *memTableFilter
 	size      int
 	logSeqNum uint64
 }
@@ -113,6 +133,7 @@ func newMemTable(opts memTableOptions) *memTable {
 		formatKey:  opts.Comparer.FormatKey,
 		equal:      opts.Comparer.Equal,
 		arenaBuf:   opts.arenaBuf,
+		filter:     opts.filter,
 		writerRefs: 1,
 		logSeqNum:  opts.logSeqNum,
 	}
@@ -122,8 +143,17 @@ func newMemTable(opts memTableOptions) *memTable {
 	}
 
 	arena := arenaskl.NewArena(m.arenaBuf)
-	m.skl.Reset(arena, m.cmp)
+	m.skl.ResetWithOptions(arena, m.cmp, opts.memTableSkiplistOptions())
 	m.rangeDelSkl.Reset(arena, m.cmp)
+	m.inserters.New = func() interface{} {
+		return &arenaskl.Inserter{}
+	}
+
+	if m.filter == nil {
+		if size := memTableFilterSize(len(m.arenaBuf), opts.Options); size > 0 {
+			m.filter = newMemTableFilter(size)
+		}
+	}
 	return m
 }
 
@@ -152,9 +182,11 @@ func (m *memTable) readyForFlush() bool {
 // Get gets the value for the given key. It returns ErrNotFound if the DB does
 // not contain the key.
 func (m *memTable) get(key []byte) (value []byte, err error) {
-	it := m.skl.NewIter(nil, nil)
-	ikey, val := it.SeekGE(key)
-	if ikey == nil {
+	if !m.mayContain(key) {
+		return nil, ErrNotFound
+	}
+	ikey, val, ok := m.skl.Get(key)
+	if !ok {
 		return nil, ErrNotFound
 	}
 	if !m.equal(key, ikey.UserKey) {
@@ -189,14 +221,19 @@ func (m *memTable) apply(batch *Batch, seqNum uint64) error {
 			errors.Safe(seqNum), errors.Safe(m.logSeqNum))
 	}
 
-	var ins arenaskl.Inserter
+	ins := m.inserters.Get().(*arenaskl.Inserter)
+	defer m.inserters.Put(ins)
 	var tombstoneCount uint32
+	var kindCounts [InternalKeyKindMax + 1]uint32
 	startSeqNum := seqNum
 	for r := batch.Reader(); ; seqNum++ {
 		kind, ukey, value, ok := r.Next()
 		if !ok {
 			break
 		}
+		if kind <= InternalKeyKindMax {
+			kindCounts[kind]++
+		}
 		var err error
 		ikey := base.MakeInternalKey(ukey, seqNum, kind)
 		switch kind {
@@ -208,6 +245,11 @@ func (m *memTable) apply(batch *Batch, seqNum uint64) error {
 			// to the memtable.
 			seqNum--
 		default:
+			// Add the key to the filter before the skiplist so that a reader
+			// which can see the record is guaranteed to see the filter bits.
+			if m.filter != nil {
+				m.filter.add(ukey)
+			}
 			err = ins.Add(&m.skl, ikey, value)
 		}
 		if err != nil {
@@ -221,9 +263,45 @@ func (m *memTable) apply(batch *Batch, seqNum uint64) error {
 	if tombstoneCount != 0 {
 		m.tombstones.invalidate(tombstoneCount)
 	}
+	for kind, n := range kindCounts {
+		if n != 0 {
+			atomic.AddUint32(&m.kindCounts[kind], n)
+		}
+	}
 	return nil
 }
 
+// kindCount returns the number of records of the specified kind that have
+// been applied to the memtable.
+func (m *memTable) kindCount(kind InternalKeyKind) uint32 {
+	return atomic.LoadUint32(&m.kindCounts[kind])
+}
+
+// pointTombstoneRatio returns the fraction of the point records in the
+// memtable which are point tombstones (DEL and SINGLEDEL), along with the
+// total number of point records.
+func (m *memTable) pointTombstoneRatio() (ratio float64, records uint32) {
+	for kind := InternalKeyKind(0); kind <= InternalKeyKindMax; kind++ {
+		switch kind {
+		case InternalKeyKindRangeDelete, InternalKeyKindLogData:
+		default:
+			records += m.kindCount(kind)
+		}
+	}
+	if records == 0 {
+		return 0, 0
+	}
+	tombstones := m.kindCount(InternalKeyKindDelete) + m.kindCount(InternalKeyKindSingleDelete)
+	return float64(tombstones) / float64(records), records
+}
+
+// mayContain returns false if the memtable is guaranteed to not contain a
+// point record for the specified user key. Note that a memtable which does not
+// contain the key may still contain a range tombstone which deletes it.
+func (m *memTable) mayContain(key []byte) bool {
+	return m.filter == nil || m.filter.mayContain(key)
+}
+
 // newIter returns an iterator that is unpositioned (Iterator.Valid() will
 // return false). The iterator can be positioned via a call to SeekGE,
 // SeekLT, First or Last.
@@ -262,6 +340,15 @@ func (m *memTable) totalBytes() uint64 {
 	return uint64(m.skl.Arena().Capacity())
 }
 
+// filterBytes returns the size of the memtable's bloom filter, which is
+// allocated in addition to the arena.
+func (m *memTable) filterBytes() uint64 {
+	if m.filter == nil {
+		return 0
+	}
+	return uint64(m.filter.size())
+}
+
 func (m *memTable) close() error {
 	return nil
 }
@@ -271,6 +358,89 @@ func (m *memTable) empty() bool {
 	return m.skl.Size() == memTableEmptySize
 }
 
+// memTableFilterProbes is the number of bits set in a memTableFilter for each
+// key.
+const memTableFilterProbes = 6
+
+// A memTableFilter is a bloom filter over the user keys added to a memTable.
+// Unlike the filters written to sstables, the filter is populated
+// incrementally and is safe for concurrent use: bits are set using atomic
+// compare-and-swap operations so that concurrent batch applications can add
+// keys while readers probe the filter.
+type memTableFilter struct {
+	words []uint32
+	nBits uint32
+}
+
+// memTableFilterSize returns the size in bytes of the bloom filter of a
+// memtable with an arena of the specified size, or zero if memtables do not
+// have a filter.
+func memTableFilterSize(arenaSize int, opts *Options) int {
+	r := opts.Experimental.MemTableBloomSizeRatio
+	if r <= 0 {
+		return 0
+	}
+	n := (int(float64(arenaSize)*r) + 3) / 4
+	if n < 1 {
+		n = 1
+	}
+	return n * 4
+}
+
+func newMemTableFilter(size int) *memTableFilter {
+	n := size / 4
+	return &memTableFilter{
+		words: make([]uint32, n),
+		nBits: uint32(n * 32),
+	}
+}
+
+// size returns the size of the filter in bytes.
+func (f *memTableFilter) size() int {
+	return len(f.words) * 4
+}
+
+// reset clears the filter so that it can be reused by a new memtable. The
+// filter must not be in use.
+func (f *memTableFilter) reset() {
+	for i := range f.words {
+		f.words[i] = 0
+	}
+}
+
+func (f *memTableFilter) hash(key []byte) (h, delta uint32) {
+	sum := xxhash.Sum64(key)
+	return uint32(sum), uint32(sum>>32) | 1
+}
+
+func (f *memTableFilter) add(key []byte) {
+	h, delta := f.hash(key)
+	for i := 0; i < memTableFilterProbes; i++ {
+		bitPos := h % f.nBits
+		word := &f.words[bitPos/32]
+		mask := uint32(1) << (bitPos % 32)
+		for {
+			old := atomic.LoadUint32(word)
+			if old&mask != 0 || atomic.CompareAndSwapUint32(word, old, old|mask) {
+				break
+			}
+		}
+		h += delta
+	}
+}
+
+func (f *memTableFilter) mayContain(key []byte) bool {
+	h, delta := f.hash(key)
+	for i := 0; i < memTableFilterProbes; i++ {
+		bitPos := h % f.nBits
+		if atomic.LoadUint32(&f.words[bitPos/32])&(uint32(1)<<(bitPos%32)) == 0 {
+			return false
+		}
+		h += delta
+	}
+	return true
+}
+
 // A rangeTombstoneFrags holds a set of fragmented range tombstones generated
 // at a particular "sequence number" for a memtable. Rather than use actual
 // sequence numbers, this cache uses a count of the number of range tombstones
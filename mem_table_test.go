@@ -7,6 +7,7 @@ package pebble
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
 	"strconv"
 	"strings"
@@ -18,6 +19,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/arenaskl"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/datadriven"
+	"github.com/cockroachdb/pebble/vfs"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/exp/rand"
 	"golang.org/x/sync/errgroup"
@@ -34,6 +36,9 @@ func (m *memTable) set(key InternalKey, value []byte) error {
 		m.tombstones.invalidate(1)
 		return nil
 	}
+	if m.filter != nil {
+		m.filter.add(key.UserKey)
+	}
 	return m.skl.Add(key, value)
 }
 
@@ -121,6 +126,158 @@ func TestMemTableBasic(t *testing.T) {
 	}
 }
 
+func TestMemTableFilter(t *testing.T) {
+	opts := &Options{}
+	opts.Experimental.MemTableBloomSizeRatio = 0.1
+	m := newMemTable(memTableOptions{Options: opts, size: 256 << 10})
+	require.NotNil(t, m.filter)
+
+	b := newBatch(nil)
+	for i := 0; i < 1000; i += 2 {
+		require.NoError(t, b.Set([]byte(strconv.Itoa(i)), nil, nil))
+	}
+	require.NoError(t, m.prepare(b))
+	require.NoError(t, m.apply(b, 1))
+
+	// The filter must never produce a false negative.
+	for i := 0; i < 1000; i += 2 {
+		key := []byte(strconv.Itoa(i))
+		require.True(t, m.mayContain(key), "%s", key)
+		_, err := m.get(key)
+		require.NoError(t, err)
+	}
+
+	// Most absent keys should be rejected by the filter.
+	var falsePositives int
+	for i := 1; i < 1000; i += 2 {
+		key := []byte(strconv.Itoa(i))
+		if m.mayContain(key) {
+			falsePositives++
+		}
+		_, err := m.get(key)
+		require.Equal(t, ErrNotFound, err)
+	}
+	require.Less(t, falsePositives, 50)
+
+	// The filter does not cover range tombstones. A get through the DB must
+	// still observe a range tombstone in a memtable that does not contain the
+	// key.
+	d, err := Open("", func() *Options {
+		o := &Options{FS: vfs.NewMem()}
+		o.Experimental.MemTableBloomSizeRatio = 0.1
+		return o
+	}())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	require.NoError(t, d.Set([]byte("b"), []byte("b"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.DeleteRange([]byte("a"), []byte("c"), nil))
+	_, _, err = d.Get([]byte("b"))
+	require.Equal(t, ErrNotFound, err)
+}
+
+func TestMemTableApplyReusesSplice(t *testing.T) {
+	var compares int
+	cmp := *DefaultComparer
+	cmp.Compare = func(a, b []byte) int {
+		compares++
+		return DefaultComparer.Compare(a, b)
+	}
+	m := newMemTable(memTableOptions{Options: &Options{Comparer: &cmp}, size: 8 << 20})
+	var buf [8]byte
+	apply := func(i uint64) {
+		b := newBatch(nil)
+		binary.BigEndian.PutUint64(buf[:], i)
+		require.NoError(t, b.Set(buf[:], nil, nil))
+		require.NoError(t, m.prepare(b))
+		require.NoError(t, m.apply(b, i+1))
+		m.writerUnref()
+	}
+	for i := uint64(0); i < 10000; i++ {
+		apply(i)
+	}
+
+	// Each batch appends a key after the key of the previous batch. The splice
+	// retained by the pooled inserter positions the insertion with a single
+	// comparison, while a descent from the head of the skiplist requires more
+	// than 20. The pool occasionally discards an inserter, so allow for a few
+	// full descents.
+	compares = 0
+	for i := uint64(10000); i < 11000; i++ {
+		apply(i)
+	}
+	require.Less(t, float64(compares)/1000, 10.0)
+}
+
+func TestMemTableTombstoneFlush(t *testing.T) {
+	m := newMemTable(memTableOptions{})
+	b := newBatch(nil)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, b.Set([]byte(strconv.Itoa(i)), nil, nil))
+	}
+	for i := 0; i < 20; i++ {
+		require.NoError(t, b.Delete([]byte(strconv.Itoa(i)), nil))
+	}
+	require.NoError(t, b.SingleDelete([]byte("a"), nil))
+	require.NoError(t, b.DeleteRange([]byte("a"), []byte("b"), nil))
+	require.NoError(t, m.prepare(b))
+	require.NoError(t, m.apply(b, 1))
+	require.EqualValues(t, 10, m.kindCount(InternalKeyKindSet))
+	require.EqualValues(t, 20, m.kindCount(InternalKeyKindDelete))
+	require.EqualValues(t, 1, m.kindCount(InternalKeyKindSingleDelete))
+	require.EqualValues(t, 1, m.kindCount(InternalKeyKindRangeDelete))
+	ratio, records := m.pointTombstoneRatio()
+	require.EqualValues(t, 31, records)
+	require.InDelta(t, 21.0/31.0, ratio, 1e-9)
+
+	// A DB configured with a tombstone flush ratio flushes the memtable once
+	// it is dominated by point tombstones.
+	d, err := Open("", func() *Options {
+		o := &Options{FS: vfs.NewMem()}
+		o.Experimental.MemTableTombstoneFlushRatio = 0.5
+		o.Experimental.MemTableTombstoneFlushMinRecords = 10
+		return o
+	}())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, d.Set([]byte(strconv.Itoa(i)), nil, nil))
+	}
+	require.EqualValues(t, 0, d.Metrics().Flush.Count)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, d.Delete([]byte(strconv.Itoa(i)), nil))
+	}
+	require.Eventually(t, func() bool {
+		return d.Metrics().Flush.Count == 1
+	}, 10*time.Second, time.Millisecond)
+}
+
+func TestMemTableTombstoneFlushShortensDelay(t *testing.T) {
+	// A flush delayed by a range deletion is brought forward once the
+	// memtable is dominated by point tombstones.
+	opts := &Options{FS: vfs.NewMem()}
+	opts.Experimental.DeleteRangeFlushDelay = time.Hour
+	opts.Experimental.MemTableTombstoneFlushRatio = 0.5
+	opts.Experimental.MemTableTombstoneFlushMinRecords = 10
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	d.mu.Lock()
+	mem := d.mu.mem.queue[len(d.mu.mem.queue)-1]
+	d.mu.Unlock()
+	require.NoError(t, d.DeleteRange([]byte("a"), []byte("z"), nil))
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Delete([]byte(strconv.Itoa(i)), nil))
+	}
+	select {
+	case <-mem.flushed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("memtable was not flushed")
+	}
+	require.EqualValues(t, 1, atomic.LoadUint32(&mem.flushable.(*memTable).tombstoneFlushScheduled))
+}
+
 func TestMemTableCount(t *testing.T) {
 	m := newMemTable(memTableOptions{})
 	for i := 0; i < 200; i++ {
@@ -400,6 +557,21 @@ func BenchmarkMemTableIterSeekGE(b *testing.B) {
 	}
 }
 
+func BenchmarkMemTableGet(b *testing.B) {
+	m, keys := buildMemTable(b)
+	// The last key did not fit in the memtable.
+	keys = keys[:len(keys)-1]
+	rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := m.get(keys[rng.Intn(len(keys))]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkMemTableIterNext(b *testing.B) {
 	m, _ := buildMemTable(b)
 	iter := m.newIter(nil)
@@ -427,3 +599,32 @@ func BenchmarkMemTableIterPrev(b *testing.B) {
 		_ = key
 	}
 }
+
+func BenchmarkMemTableApplySequential(b *testing.B) {
+	const keysPerBatch = 4
+	m := newMemTable(memTableOptions{size: 64 << 20})
+	var buf [8]byte
+	var seqNum uint64 = 1
+	var i uint64
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n += keysPerBatch {
+		batch := newBatch(nil)
+		for j := 0; j < keysPerBatch; j++ {
+			binary.BigEndian.PutUint64(buf[:], i)
+			i++
+			_ = batch.Set(buf[:], nil, nil)
+		}
+		if err := m.prepare(batch); err == arenaskl.ErrArenaFull {
+			b.StopTimer()
+			m = newMemTable(memTableOptions{size: 64 << 20})
+			b.StartTimer()
+			continue
+		}
+		if err := m.apply(batch, seqNum); err != nil {
+			b.Fatal(err)
+		}
+		m.writerUnref()
+		seqNum += keysPerBatch
+	}
+}
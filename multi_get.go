@@ -0,0 +1,298 @@
+// Copyright 2021 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/internal/rangedel"
+	"github.com/cockroachdb/pebble/sstable"
+)
+
+// multiGetKey holds the state of a key looked up by DB.MultiGet.
+type multiGetKey struct {
+	// index is the index of the key in the keys passed to MultiGet.
+	index int
+	key   []byte
+	// tombstoneSeqNum is the sequence number of the newest range tombstone
+	// covering the key which has been found so far. Older records of the key
+	// are deleted.
+	tombstoneSeqNum uint64
+	// merger accumulates the merge operands of the key, newest first.
+	merger ValueMerger
+	// value is the offset and length of the key's value in multiGet.buf.
+	valueOffset, valueLen int
+	found, done           bool
+}
+
+// multiGet looks up a batch of keys in a readState. Each source of records is
+// examined in turn from newest to oldest, as by getIter, but for all of the
+// keys which are not yet resolved at once: the keys are grouped by the
+// sstables of each level which may contain them, and each group is looked up
+// with a single sstable.Reader.MultiGet.
+type multiGet struct {
+	cmp       Compare
+	equal     Equal
+	merge     Merge
+	snapshot  uint64
+	readState *readState
+	// tableCache is used to get the readers of the sstables.
+	tableCache *tableCache
+	// pending holds the keys which are not yet resolved, sorted by key.
+	pending []*multiGetKey
+	// group and groupKeys hold the keys looked up in an sstable.
+	group     []*multiGetKey
+	groupKeys [][]byte
+	// buf holds the values of the keys which have been found.
+	buf []byte
+}
+
+func (m *multiGet) run() error {
+	mem := m.readState.memtables
+	// Strip off memtables which cannot possibly contain the seqNum being read
+	// at.
+	for len(mem) > 0 {
+		n := len(mem)
+		if logSeqNum := mem[n-1].logSeqNum; logSeqNum < m.snapshot {
+			break
+		}
+		mem = mem[:n-1]
+	}
+	for i := len(mem) - 1; i >= 0 && len(m.pending) > 0; i-- {
+		if err := m.getMemTable(mem[i]); err != nil {
+			return err
+		}
+		if err := m.finishSource(); err != nil {
+			return err
+		}
+	}
+
+	current := m.readState.current
+	for i := len(current.L0Sublevels.Levels) - 1; i >= 0 && len(m.pending) > 0; i-- {
+		if err := m.getLevel(current.L0Sublevels.Levels[i]); err != nil {
+			return err
+		}
+		if err := m.finishSource(); err != nil {
+			return err
+		}
+	}
+	for level := 1; level < numLevels && len(m.pending) > 0; level++ {
+		if current.Levels[level].Empty() {
+			continue
+		}
+		if err := m.getLevel(current.Levels[level].Slice()); err != nil {
+			return err
+		}
+		if err := m.finishSource(); err != nil {
+			return err
+		}
+	}
+
+	// Every source has been examined, so resolve the remaining keys.
+	for _, k := range m.pending {
+		if err := m.finish(k); err != nil {
+			return err
+		}
+	}
+	m.pending = m.pending[:0]
+	return nil
+}
+
+// getMemTable looks up the pending keys in a memtable.
+func (m *multiGet) getMemTable(mem *flushableEntry) error {
+	if rangeDelIter := mem.newRangeDelIter(nil); rangeDelIter != nil {
+		for _, k := range m.pending {
+			m.applyTombstone(k, rangeDelIter)
+		}
+		if err := rangeDelIter.Close(); err != nil {
+			return err
+		}
+	}
+	iter := mem.newIter(nil)
+	for _, k := range m.pending {
+		ikey, value := iter.SeekGE(k.key)
+		if err := m.applyRecords(k, iter, ikey, value); err != nil {
+			_ = iter.Close()
+			return err
+		}
+	}
+	return iter.Close()
+}
+
+// getLevel looks up the pending keys in the sstables of a level or L0
+// sublevel, grouping the keys by the sstables which may contain them. A key
+// may be in several consecutive sstables, which are examined in order.
+func (m *multiGet) getLevel(files manifest.LevelSlice) error {
+	iter := files.Iter()
+	j := 0
+	f := iter.SeekGE(m.cmp, m.pending[0].key)
+	for f != nil {
+		// Skip the keys which lie before the sstable.
+		for j < len(m.pending) && m.cmp(m.pending[j].key, f.Smallest.UserKey) < 0 {
+			j++
+		}
+		if j == len(m.pending) {
+			break
+		}
+		if m.cmp(f.Largest.UserKey, m.pending[j].key) < 0 {
+			f = iter.SeekGE(m.cmp, m.pending[j].key)
+			continue
+		}
+
+		// Gather the keys which lie within the sstable. If the largest key of
+		// the sstable is a range deletion sentinel there is nothing equal to
+		// it in the sstable.
+		m.group = m.group[:0]
+		for _, k := range m.pending[j:] {
+			c := m.cmp(k.key, f.Largest.UserKey)
+			if c > 0 || (c == 0 && f.Largest.Trailer == InternalKeyRangeDeleteSentinel) {
+				break
+			}
+			if !k.done {
+				m.group = append(m.group, k)
+			}
+		}
+		if len(m.group) > 0 {
+			if err := m.getTable(f); err != nil {
+				return err
+			}
+		}
+		f = iter.Next()
+	}
+	return nil
+}
+
+// getTable looks up the keys in m.group, which must be sorted, in an sstable.
+func (m *multiGet) getTable(f *fileMetadata) error {
+	return m.tableCache.withReader(f, func(r *sstable.Reader) error {
+		rangeDelIter, err := r.NewRawRangeDelIter()
+		if err != nil {
+			return err
+		}
+		if rangeDelIter != nil {
+			for _, k := range m.group {
+				m.applyTombstone(k, rangeDelIter)
+			}
+			if err := rangeDelIter.Close(); err != nil {
+				return err
+			}
+		}
+
+		m.groupKeys = m.groupKeys[:0]
+		for _, k := range m.group {
+			m.groupKeys = append(m.groupKeys, k.key)
+		}
+		return r.MultiGet(m.groupKeys, func(
+			j int, iter sstable.Iterator, ikey *InternalKey, value []byte,
+		) error {
+			return m.applyRecords(m.group[j], iter, ikey, value)
+		})
+	})
+}
+
+// applyTombstone records the newest range tombstone in rangeDelIter which
+// covers the key and is visible at the snapshot.
+func (m *multiGet) applyTombstone(k *multiGetKey, rangeDelIter internalIterator) {
+	t := rangedel.Get(m.cmp, rangeDelIter, k.key, m.snapshot)
+	if !t.Empty() && t.Start.SeqNum() > k.tombstoneSeqNum {
+		k.tombstoneSeqNum = t.Start.SeqNum()
+	}
+}
+
+// applyRecords applies the records of the key visible at the snapshot, from
+// the record at which iter is positioned onward, until the key is resolved.
+func (m *multiGet) applyRecords(
+	k *multiGetKey, iter internalIterator, ikey *InternalKey, value []byte,
+) error {
+	for ; ikey != nil && !k.done && m.equal(ikey.UserKey, k.key); ikey, value = iter.Next() {
+		if !ikey.Visible(m.snapshot) {
+			continue
+		}
+		if err := m.apply(k, ikey, value); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+// apply applies a record of the key which is older than those applied so far,
+// in the same way as Iterator.findNextEntry and Iterator.mergeNext.
+func (m *multiGet) apply(k *multiGetKey, ikey *InternalKey, value []byte) error {
+	if ikey.SeqNum() < k.tombstoneSeqNum {
+		// The record and all older records are deleted by a range tombstone.
+		return m.finish(k)
+	}
+	var err error
+	switch ikey.Kind() {
+	case InternalKeyKindDelete, InternalKeyKindSingleDelete:
+		return m.finish(k)
+
+	case InternalKeyKindSet:
+		if k.merger == nil {
+			m.setValue(k, value)
+			k.done = true
+			return nil
+		}
+		if err = k.merger.MergeOlder(value); err != nil {
+			return err
+		}
+		return m.finish(k)
+
+	case InternalKeyKindMerge:
+		if k.merger == nil {
+			k.merger, err = m.merge(k.key, value)
+		} else {
+			err = k.merger.MergeOlder(value)
+		}
+		return err
+
+	default:
+		return base.CorruptionErrorf("pebble: invalid internal key kind: %d", errors.Safe(ikey.Kind()))
+	}
+}
+
+// finish resolves a key for which no older records remain.
+func (m *multiGet) finish(k *multiGetKey) error {
+	k.done = true
+	if k.merger == nil {
+		return nil
+	}
+	value, closer, err := k.merger.Finish(true /* includesBase */)
+	if err != nil {
+		return err
+	}
+	m.setValue(k, value)
+	if closer != nil {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (m *multiGet) setValue(k *multiGetKey, value []byte) {
+	k.valueOffset, k.valueLen = len(m.buf), len(value)
+	m.buf = append(m.buf, value...)
+	k.found = true
+}
+
+// finishSource is called after a source of records has been examined. A range
+// tombstone found in a source deletes the records of the keys it covers in the
+// older sources, so those keys are resolved. The resolved keys are then
+// removed from m.pending.
+func (m *multiGet) finishSource() error {
+	pending := m.pending[:0]
+	for _, k := range m.pending {
+		if !k.done && k.tombstoneSeqNum > 0 {
+			if err := m.finish(k); err != nil {
+				return err
+			}
+		}
+		if !k.done {
+			pending = append(pending, k)
+		}
+	}
+	m.pending = pending
+	return nil
+}
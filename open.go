@@ -35,7 +35,7 @@ const (
 
 	// The max memtable size is limited by the uint32 offsets stored in
 	// internal/arenaskl.node, DeferredBatchOp, and flushableBatchEntry.
-	maxMemTableSize = 4 << 30 // 4 GB
+	maxMemTableSize = arenaskl.MaxArenaSize + 1 // 4 GB
 )
 
 // Open opens a DB whose files live in the given directory.
@@ -86,6 +86,10 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 					t.arenaBuf = nil
 				}
 			}
+			if mem := (*memTable)(d.memTableRecycle); mem != nil {
+				manual.Free(mem.arenaBuf)
+				mem.arenaBuf = nil
+			}
 			if r != nil {
 				panic(r)
 			}
@@ -116,6 +120,9 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 	d.deletionLimiter = rate.NewLimiter(
 		rate.Limit(d.opts.Experimental.MinDeletionRate),
 		d.opts.Experimental.MinDeletionRate)
+	if r := d.opts.Experimental.MaxCompactionRate; r > 0 {
+		d.compactionRateLimiter = rate.NewLimiter(rate.Limit(r), r)
+	}
 	d.mu.nextJobID = 1
 	d.mu.mem.nextSize = opts.MemTableSize
 	if d.mu.mem.nextSize > initialMemTableSize {
@@ -125,6 +132,7 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 	d.mu.cleaner.cond.L = &d.mu.Mutex
 	d.mu.compact.cond.L = &d.mu.Mutex
 	d.mu.compact.inProgress = make(map[*compaction]struct{})
+	d.mu.compact.maxConcurrent = opts.MaxConcurrentCompactions
 	d.mu.snapshots.init()
 	// logSeqNum is the next sequence number that will be assigned. Start
 	// assigning sequence numbers from 1 to match rocksdb.
@@ -219,6 +227,10 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 	if err != nil {
 		return nil, err
 	}
+	// Logs may also be found in the data directory if it was used as the WAL
+	// directory when they were written. The files listed from the data
+	// directory follow those listed from the WAL directory.
+	numWALDirFiles := len(ls)
 	if d.dirname != d.walDirname {
 		ls2, err := opts.FS.List(d.dirname)
 		if err != nil {
@@ -228,13 +240,13 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 	}
 
 	// Replay any newer log files than the ones named in the manifest.
-	type fileNumAndName struct {
+	type fileNumAndPath struct {
 		num  FileNum
-		name string
+		path string
 	}
-	var logFiles []fileNumAndName
+	var logFiles []fileNumAndPath
 	var strictWALTail bool
-	for _, filename := range ls {
+	for i, filename := range ls {
 		ft, fn, ok := base.ParseFilename(opts.FS, filename)
 		if !ok {
 			continue
@@ -249,7 +261,11 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 		switch ft {
 		case fileTypeLog:
 			if fn >= d.mu.versions.minUnflushedLogNum {
-				logFiles = append(logFiles, fileNumAndName{fn, filename})
+				dir := d.walDirname
+				if i >= numWALDirFiles {
+					dir = d.dirname
+				}
+				logFiles = append(logFiles, fileNumAndPath{fn, opts.FS.PathJoin(dir, filename)})
 			}
 			if d.logRecycler.minRecycleLogNum <= fn {
 				d.logRecycler.minRecycleLogNum = fn + 1
@@ -277,8 +293,11 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 	var ve versionEdit
 	for i, lf := range logFiles {
 		lastWAL := i == len(logFiles)-1
-		maxSeqNum, err := d.replayWAL(jobID, &ve, opts.FS,
-			opts.FS.PathJoin(d.walDirname, lf.name), lf.num, strictWALTail && !lastWAL)
+		strict := strictWALTail && !lastWAL
+		if opts.WALRecoveryMode == WALRecoveryAbsoluteConsistency {
+			strict = true
+		}
+		maxSeqNum, err := d.replayWAL(jobID, &ve, opts.FS, lf.path, lf.num, strict)
 		if err != nil {
 			return nil, err
 		}
@@ -350,7 +369,18 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 	}
 
 	if !d.opts.ReadOnly {
-		d.scanObsoleteFiles(ls)
+		// Logs found in the data directory have been replayed and are now
+		// obsolete. They are deleted here, as obsolete logs are otherwise
+		// deleted from the WAL directory.
+		scanList := ls[:numWALDirFiles:numWALDirFiles]
+		for _, filename := range ls[numWALDirFiles:] {
+			if ft, fn, ok := base.ParseFilename(opts.FS, filename); ok && ft == fileTypeLog {
+				d.deleteObsoleteFile(fileTypeLog, jobID, opts.FS.PathJoin(d.dirname, filename), fn)
+				continue
+			}
+			scanList = append(scanList, filename)
+		}
+		d.scanObsoleteFiles(scanList)
 		d.deleteObsoleteFiles(jobID)
 	} else {
 		// All the log files are obsolete.
@@ -362,6 +392,9 @@ func Open(dirname string, opts *Options) (db *DB, _ error) {
 	}
 	d.maybeScheduleFlush()
 	d.maybeScheduleCompaction()
+	if age := d.opts.Experimental.PeriodicCompactionAge; age > 0 && !d.opts.ReadOnly {
+		go d.periodicCompactionLoop(periodicCompactionCheckInterval(age))
+	}
 
 	if invariants.Enabled {
 		runtime.SetFinalizer(d, func(obj interface{}) {
@@ -511,13 +544,25 @@ func (d *DB) replayWAL(
 			// to otherwise treat them like EOF.
 			if err == io.EOF {
 				break
-			} else if record.IsInvalidRecord(err) && !strictWALTail {
-				break
+			} else if record.IsInvalidRecord(err) {
+				if d.opts.WALRecoveryMode == WALRecoverySkipCorruptedRecords {
+					// Skip to the next good block of the WAL.
+					rr.Recover()
+					buf.Reset()
+					continue
+				}
+				if !strictWALTail {
+					break
+				}
 			}
 			return 0, errors.Wrap(err, "pebble: error when replaying WAL")
 		}
 
 		if buf.Len() < batchHeaderLen {
+			if d.opts.WALRecoveryMode == WALRecoverySkipCorruptedRecords {
+				buf.Reset()
+				continue
+			}
 			return 0, base.CorruptionErrorf("pebble: corrupt log file %q (num %s)",
 				filename, errors.Safe(logNum))
 		}
@@ -5,6 +5,7 @@
 package pebble
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -15,12 +16,14 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cockroachdb/errors/oserror"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/kr/pretty"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/rand"
 )
 
 func TestErrorIfExists(t *testing.T) {
@@ -228,6 +231,41 @@ func TestOpenCloseOpenClose(t *testing.T) {
 	}
 }
 
+func TestOpenWALDirChanged(t *testing.T) {
+	// Logs written to the data directory before a separate WAL directory was
+	// configured are found and replayed.
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), Sync))
+	require.NoError(t, d.Close())
+
+	// The replayed log is deleted from the data directory.
+	d, err = Open("", &Options{FS: mem, WALDir: "wal"})
+	require.NoError(t, err)
+	ls, err := mem.List("")
+	require.NoError(t, err)
+	for _, filename := range ls {
+		ft, _, ok := base.ParseFilename(mem, filename)
+		require.False(t, ok && ft == fileTypeLog, filename)
+	}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, d.Set([]byte("b"), []byte("2"), Sync))
+		require.NoError(t, d.Flush())
+	}
+	require.NoError(t, d.Close())
+
+	d, err = Open("", &Options{FS: mem, WALDir: "wal"})
+	require.NoError(t, err)
+	for _, kv := range [][2]string{{"a", "1"}, {"b", "2"}} {
+		v, closer, err := d.Get([]byte(kv[0]))
+		require.NoError(t, err)
+		require.Equal(t, kv[1], string(v))
+		require.NoError(t, closer.Close())
+	}
+	require.NoError(t, d.Close())
+}
+
 func TestOpenOptionsCheck(t *testing.T) {
 	mem := vfs.NewMem()
 	opts := &Options{FS: mem}
@@ -447,6 +485,90 @@ func TestOpenWALReplay(t *testing.T) {
 	}
 }
 
+// TestOpenWALReplayCompression tests the replay of WALs written with
+// Experimental.WALCompression, which contain a mix of compressed batches,
+// incompressible batches and large batches.
+func TestOpenWALReplayCompression(t *testing.T) {
+	const dir = ""
+	mem := vfs.NewMem()
+	opts := &Options{
+		FS:           mem,
+		MemTableSize: 1 << 20,
+	}
+	opts.Experimental.WALCompression = true
+	d, err := Open(dir, opts)
+	require.NoError(t, err)
+
+	rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+	randValue := func(n int) []byte {
+		v := make([]byte, n)
+		_, _ = rng.Read(v)
+		return v
+	}
+	expected := map[string][]byte{
+		"a": bytes.Repeat([]byte("a"), 100<<10),
+		"b": randValue(100),
+		"c": bytes.Repeat([]byte("c"), 2<<20),
+		"d": randValue(100 << 10),
+	}
+	var size int
+	for _, k := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, d.Set([]byte(k), expected[k], Sync))
+		size += len(expected[k])
+	}
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("e"), []byte("e"), nil))
+	require.NoError(t, b.Delete([]byte("b"), nil))
+	require.NoError(t, b.Commit(Sync))
+	expected["e"] = []byte("e")
+	delete(expected, "b")
+	seqNum := d.mu.versions.atomic.logSeqNum
+	require.NoError(t, d.Close())
+
+	// The compressible values take up little space in the WALs.
+	ls, err := mem.List(dir)
+	require.NoError(t, err)
+	var logSize int64
+	for _, filename := range ls {
+		if ft, _, ok := base.ParseFilename(mem, filename); ok && ft == fileTypeLog {
+			info, err := mem.Stat(filename)
+			require.NoError(t, err)
+			logSize += info.Size()
+		}
+	}
+	require.Less(t, logSize, int64(size/4))
+
+	// The batches in the WALs have the sequence numbers assigned when they
+	// were committed, which are set after the batches are compressed.
+	tailer := NewWALTailer(mem, dir)
+	var batchSeqNums []uint64
+	for {
+		b, err := tailer.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		batchSeqNums = append(batchSeqNums, b.SeqNum())
+	}
+	require.NoError(t, tailer.Close())
+	require.Equal(t, []uint64{1, 2, 3, 4, 5}, batchSeqNums)
+
+	for _, compression := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compression=%t", compression), func(t *testing.T) {
+			opts := &Options{FS: mem}
+			opts.Experimental.WALCompression = compression
+			d, err := Open(dir, opts)
+			require.NoError(t, err)
+			require.Equal(t, seqNum, d.mu.versions.atomic.logSeqNum)
+			for k, v := range expected {
+				verifyGet(t, d, []byte(k), v)
+			}
+			verifyGetNotFound(t, d, []byte("b"))
+			require.NoError(t, d.Close())
+		})
+	}
+}
+
 // Similar to TestOpenWALReplay, except we test replay behavior after a
 // memtable has been flushed. We test all 3 reasons for flushing: forced, size,
 // and large-batch.
@@ -630,6 +752,78 @@ func TestTwoWALReplayPermissive(t *testing.T) {
 	require.NoError(t, d.Close())
 }
 
+func TestOpenWALRecoveryMode(t *testing.T) {
+	// Writes 100 keys with 1 KB values, spanning several WAL blocks, and
+	// corrupts the first record of the WAL before reopening the database with
+	// the specified recovery mode.
+	var dirs []string
+	defer func() {
+		for _, dir := range dirs {
+			os.RemoveAll(dir)
+		}
+	}()
+	run := func(mode WALRecoveryMode) (*DB, error) {
+		// Use the real filesystem so that we can seek and overwrite WAL data
+		// easily.
+		dir, err := ioutil.TempDir("", "wal-recovery-mode")
+		require.NoError(t, err)
+		dirs = append(dirs, dir)
+
+		d, err := Open(dir, nil)
+		require.NoError(t, err)
+		for i := 0; i < 100; i++ {
+			require.NoError(t, d.Set([]byte(strconv.Itoa(i)), []byte(strings.Repeat("a", 1024)), nil))
+		}
+		require.NoError(t, d.Close())
+
+		ls, err := vfs.Default.List(dir)
+		require.NoError(t, err)
+		var corrupted bool
+		for _, name := range ls {
+			if filepath.Ext(name) != ".log" {
+				continue
+			}
+			f, err := os.OpenFile(filepath.Join(dir, name), os.O_RDWR, os.ModePerm)
+			require.NoError(t, err)
+			_, err = f.WriteAt([]byte{0, 0, 0, 0}, 100)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+			corrupted = true
+		}
+		require.True(t, corrupted)
+
+		return Open(dir, &Options{WALRecoveryMode: mode})
+	}
+	get := func(d *DB, key int) bool {
+		_, closer, err := d.Get([]byte(strconv.Itoa(key)))
+		if err == ErrNotFound {
+			return false
+		}
+		require.NoError(t, err)
+		require.NoError(t, closer.Close())
+		return true
+	}
+
+	// Replay stops at the corrupted record at the tail of the WAL.
+	d, err := run(WALRecoveryTolerateCorruptedTail)
+	require.NoError(t, err)
+	require.False(t, get(d, 0))
+	require.False(t, get(d, 99))
+	require.NoError(t, d.Close())
+
+	// The corrupted record is an error.
+	_, err = run(WALRecoveryAbsoluteConsistency)
+	require.Error(t, err)
+
+	// Replay skips the block containing the corrupted record, and recovers
+	// the records in later blocks.
+	d, err = run(WALRecoverySkipCorruptedRecords)
+	require.NoError(t, err)
+	require.False(t, get(d, 0))
+	require.True(t, get(d, 99))
+	require.NoError(t, d.Close())
+}
+
 // TestOpenWALReplayReadOnlySeqNums tests opening a database:
 // * in read-only mode
 // * with multiple unflushed log files that must replayed
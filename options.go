@@ -6,12 +6,14 @@ package pebble
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/arenaskl"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/cache"
 	"github.com/cockroachdb/pebble/internal/humanize"
@@ -34,6 +36,16 @@ const (
 	ZstdCompression    = sstable.ZstdCompression
 )
 
+// ChecksumType exports the sstable.ChecksumType type.
+type ChecksumType = sstable.ChecksumType
+
+// Exported ChecksumType constants. Only ChecksumTypeCRC32c and
+// ChecksumTypeXXHash64 are supported for writing sstables.
+const (
+	ChecksumTypeCRC32c   = sstable.ChecksumTypeCRC32c
+	ChecksumTypeXXHash64 = sstable.ChecksumTypeXXHash64
+)
+
 // FilterType exports the base.FilterType type.
 type FilterType = base.FilterType
 
@@ -51,6 +63,85 @@ type FilterPolicy = base.FilterPolicy
 // TablePropertyCollector exports the sstable.TablePropertyCollector type.
 type TablePropertyCollector = sstable.TablePropertyCollector
 
+// BlockPropertyCollector exports the sstable.BlockPropertyCollector type.
+type BlockPropertyCollector = sstable.BlockPropertyCollector
+
+// BlockPropertyFilter exports the sstable.BlockPropertyFilter type.
+type BlockPropertyFilter = sstable.BlockPropertyFilter
+
+// ReadaheadConfig exports the sstable.ReadaheadConfig type.
+type ReadaheadConfig = sstable.ReadaheadConfig
+
+// CompactionStyle specifies the policy used to pick automatic compactions.
+type CompactionStyle int
+
+// The available compaction styles.
+const (
+	// CompactionStyleLeveled bounds the size of each level below L0 by a
+	// target size which grows by a constant multiplier from one level to the
+	// next, and compacts tables from a level into the next level once the
+	// level exceeds its target size. Leveled compaction favors low read and
+	// space amplification.
+	CompactionStyleLeveled CompactionStyle = iota
+	// CompactionStyleTiered, also known as size-tiered or universal
+	// compaction, treats each non-empty level below L0 as a sorted run. L0 is
+	// compacted into a new run above the existing runs, and two adjacent runs
+	// are merged only once they are of similar size. Tiered compaction
+	// rewrites data far less often than leveled compaction, at the cost of
+	// higher read and space amplification. It suits write-heavy workloads
+	// which perform few scans.
+	CompactionStyleTiered
+)
+
+// String implements fmt.Stringer.
+func (s CompactionStyle) String() string {
+	switch s {
+	case CompactionStyleLeveled:
+		return "leveled"
+	case CompactionStyleTiered:
+		return "tiered"
+	default:
+		return "unknown"
+	}
+}
+
+// WALRecoveryMode specifies how corruption is handled when replaying the
+// WALs while opening a DB.
+type WALRecoveryMode int
+
+// The available WAL recovery modes.
+const (
+	// WALRecoveryTolerateCorruptedTail tolerates a corrupted or truncated
+	// record at the end of the most recent WAL, which is expected after a crash
+	// in the middle of a write. Replay of the WAL stops at such a record. Any
+	// other corruption is an error.
+	WALRecoveryTolerateCorruptedTail WALRecoveryMode = iota
+	// WALRecoveryAbsoluteConsistency treats any corrupted or truncated record
+	// as an error, including one at the end of the most recent WAL. It is
+	// appropriate for applications which always close the DB cleanly, and
+	// would rather fail to open than lose a write.
+	WALRecoveryAbsoluteConsistency
+	// WALRecoverySkipCorruptedRecords skips corrupted records and continues
+	// replaying the remainder of the WAL. It favors availability over
+	// consistency: the writes in skipped records are lost, even if later
+	// writes are recovered.
+	WALRecoverySkipCorruptedRecords
+)
+
+// String implements fmt.Stringer.
+func (m WALRecoveryMode) String() string {
+	switch m {
+	case WALRecoveryTolerateCorruptedTail:
+		return "tolerate-corrupted-tail"
+	case WALRecoveryAbsoluteConsistency:
+		return "absolute-consistency"
+	case WALRecoverySkipCorruptedRecords:
+		return "skip-corrupted-records"
+	default:
+		return "unknown"
+	}
+}
+
 // IterOptions hold the optional per-query parameters for NewIter.
 //
 // Like Options, a nil *IterOptions is valid and means to use the default
@@ -71,9 +162,25 @@ type IterOptions struct {
 	// false to skip scanning. This function must be thread-safe since the same
 	// function can be used by multiple iterators, if the iterator is cloned.
 	TableFilter func(userProps map[string]string) bool
+	// BlockPropertyFilters can be used to skip the sstables and data blocks
+	// whose properties, collected by the BlockPropertyCollector of the same
+	// name, do not intersect the filters. Filtering is best-effort: the
+	// iterator may still return keys which do not satisfy the filters.
+	BlockPropertyFilters []BlockPropertyFilter
+	// Readahead configures the readahead of sstable data blocks. Large
+	// sequential scans benefit from a larger readahead, while iterators which
+	// access keys randomly can disable readahead to avoid wasted I/O. The zero
+	// value uses the default configuration.
+	Readahead ReadaheadConfig
 
 	// Internal options.
 	logger Logger
+	// stats, if non-nil, accumulates the stats of the sstable iterators
+	// created for the Iterator.
+	stats *InternalIteratorStats
+	// ctx, if non-nil, is checked for cancellation by the sstable iterators
+	// created for the Iterator before loading a block.
+	ctx context.Context
 }
 
 // GetLowerBound returns the LowerBound or nil if the receiver is nil.
@@ -92,6 +199,13 @@ func (o *IterOptions) GetUpperBound() []byte {
 	return o.UpperBound
 }
 
+func (o *IterOptions) getContext() context.Context {
+	if o == nil || o.ctx == nil {
+		return context.Background()
+	}
+	return o.ctx
+}
+
 func (o *IterOptions) getLogger() Logger {
 	if o == nil || o.logger == nil {
 		return DefaultLogger
@@ -117,6 +231,15 @@ type WriteOptions struct {
 	//
 	// The default value is true.
 	Sync bool
+
+	// DisableWAL skips writing to the WAL. The write is applied to the
+	// memtable and is only persisted when the memtable is flushed, so it is
+	// lost if the process or machine crashes before then, even if later writes
+	// which used the WAL are recovered. DisableWAL cannot be combined with
+	// Sync. Options.DisableWAL disables the WAL for all writes.
+	//
+	// The default value is false.
+	DisableWAL bool
 }
 
 // Sync specifies the default write options for writes which synchronize to
@@ -132,6 +255,11 @@ func (o *WriteOptions) GetSync() bool {
 	return o == nil || o.Sync
 }
 
+// GetDisableWAL returns the DisableWAL value or false if the receiver is nil.
+func (o *WriteOptions) GetDisableWAL() bool {
+	return o != nil && o.DisableWAL
+}
+
 // LevelOptions holds the optional per-level parameters.
 type LevelOptions struct {
 	// BlockRestartInterval is the number of keys between restart points
@@ -157,6 +285,24 @@ type LevelOptions struct {
 	// The default value (DefaultCompression) uses snappy compression.
 	Compression Compression
 
+	// DataBlockHashIndex enables a hash index in each data block which lets
+	// point lookups skip the binary search over the restart points of the
+	// block. It should only be enabled with a Comparer for which equal user
+	// keys are byte-wise equal. The sstables of a level with a hash index use
+	// sstable.TableFormatPebblev1, which RocksDB cannot read.
+	//
+	// The default value is false.
+	DataBlockHashIndex bool
+
+	// FilterBlockSize is the target size in bytes of each partition of a
+	// table-level filter. When the filter of an sstable is larger than this
+	// target, the filter is partitioned and partitions are loaded on demand
+	// through the block cache, so the filters of large sstables do not need to
+	// be fully resident. Zero disables partitioning.
+	//
+	// The default value is 0.
+	FilterBlockSize int
+
 	// FilterPolicy defines a filter algorithm (such as a Bloom filter) that can
 	// reduce disk reads for Get calls.
 	//
@@ -246,6 +392,21 @@ type Options struct {
 	// The default value uses the same ordering as bytes.Compare.
 	Comparer *Comparer
 
+	// CompactionFilter creates the CompactionFilter consulted by a compaction,
+	// if non-nil. A new filter is created for each compaction, so a filter need
+	// not be safe for concurrent use.
+	CompactionFilter func() CompactionFilter
+
+	// CompactionPicker, if non-nil, picks automatic compactions in place of the
+	// policy of the CompactionStyle.
+	CompactionPicker CompactionPicker
+
+	// CompactionStyle specifies the policy used to pick automatic compactions.
+	// The compaction style may be changed when the DB is reopened.
+	//
+	// The default value is CompactionStyleLeveled.
+	CompactionStyle CompactionStyle
+
 	// DebugCheck is invoked, if non-nil, whenever a new version is being
 	// installed. Typically, this is set to pebble.DebugCheckLevels in tests
 	// or tools only, to check invariants over all the data in the database.
@@ -299,6 +460,87 @@ type Options struct {
 		// is flushed. No automatic flush occurs if zero.
 		DeleteRangeFlushDelay time.Duration
 
+		// MemTableTombstoneFlushRatio configures flushing a memtable before it
+		// is full when point tombstones (DEL and SINGLEDEL) make up at least
+		// this fraction of the point records in the memtable, and the memtable
+		// contains at least MemTableTombstoneFlushMinRecords point records.
+		// Flushing tombstone-heavy memtables early allows the space occupied by
+		// the deleted data to be reclaimed by compactions sooner. No early flush
+		// occurs if zero, which is the default.
+		MemTableTombstoneFlushRatio float64
+
+		// MemTableTombstoneFlushMinRecords is the minimum number of point
+		// records a memtable must contain before MemTableTombstoneFlushRatio is
+		// considered. This prevents flushing tiny memtables which happen to
+		// contain a handful of deletions.
+		//
+		// The default value is 1000.
+		MemTableTombstoneFlushMinRecords int
+
+		// TombstoneDenseCompactionRatio configures compacting a table into the
+		// next level when deletion tombstones (point and range deletions) make
+		// up at least this fraction of the table's entries, and the table
+		// contains at least TombstoneDenseCompactionMinDeletions tombstones,
+		// as recorded in its table stats. Such
+		// compactions are picked when no level needs a score-based compaction,
+		// so that the space occupied by deleted data is reclaimed without
+		// waiting for the level to grow. Tables in the bottommost level are
+		// instead rewritten by elision-only compactions. No tombstone-dense
+		// compaction occurs if zero, which is the default.
+		TombstoneDenseCompactionRatio float64
+
+		// TombstoneDenseCompactionMinDeletions is the minimum number of
+		// tombstones a table must contain before TombstoneDenseCompactionRatio
+		// is considered.
+		//
+		// The default value is 100.
+		TombstoneDenseCompactionMinDeletions int
+
+		// MemTableBloomSizeRatio is the fraction of the memtable size to
+		// allocate for a bloom filter over the user keys added to each memtable.
+		// The filter allows point lookups to skip memtables which cannot contain
+		// the key without performing a skiplist seek. The filter memory is
+		// allocated in addition to the memtable arena, and is reserved from the
+		// Cache and recycled along with the arena. The filter assumes that
+		// keys which are equal according to Comparer.Equal are byte-wise equal.
+		// No filter is used if zero, which is the default.
+		MemTableBloomSizeRatio float64
+
+		// MemTableReservationChanged, if non-nil, is invoked whenever the
+		// memory reserved for memtables, including their bloom filters,
+		// changes. The memory reserved covers the mutable memtable, the queued
+		// immutable memtables, memtables which have been flushed but are still
+		// referenced by iterators, and a flushed memtable retained for reuse.
+		// delta is the change in bytes and reserved is the total number of
+		// bytes reserved after the change.
+		// Embedders can use this to integrate memtable memory with their own
+		// memory budgets. Memtable memory is additionally bounded by
+		// MemTableSize * MemTableStopWritesThreshold for queued memtables.
+		//
+		// Calls to the callback are serialized, and report the changes in the
+		// order in which they are made. The callback may be invoked while
+		// internal DB locks are held and must not call back into the DB.
+		MemTableReservationChanged func(delta, reserved int64)
+
+		// MemTableMaxHeight and MemTableHeightProbability control the
+		// distribution of the heights of the towers of nodes in the memtable
+		// skiplist. Lower values reduce the memory overhead of each entry, which
+		// is significant for small memtables or small keys and values, at the
+		// expense of longer seeks. MemTableMaxHeight must be zero or in the range
+		// [1, 20], and MemTableHeightProbability must be zero or in the range
+		// (0, 1). The default values (zero) use a maximum height of 20 and a
+		// probability of 1/e.
+		MemTableMaxHeight         int
+		MemTableHeightProbability float64
+
+		// MaxCompactionRate is the maximum number of bytes per second read and
+		// written by compactions. The limit is shared by all of the concurrent
+		// compactions, so that background work does not starve foreground
+		// reads and writes of disk bandwidth. Flushes are not limited, as
+		// slowing them down would stall writes. Setting this to 0 disables the
+		// limit, which is also the default.
+		MaxCompactionRate int
+
 		// MinDeletionRate is the minimum number of bytes per second that would
 		// be deleted. Deletion pacing is used to slow down deletions when
 		// compactions finish up or readers close, and newly-obsolete files need
@@ -310,6 +552,18 @@ type Options struct {
 		// deletion pacing, which is also the default.
 		MinDeletionRate int
 
+		// PeriodicCompactionAge is the age at which a table is compacted even
+		// if its level does not need to be compacted, so that compaction filters
+		// and the elision of tombstones eventually visit all of the data, even in
+		// rarely written regions of the key space. A table above the bottommost
+		// level is compacted into the next level, and a table in the bottommost
+		// level is rewritten in place. Tables whose creation time is unknown,
+		// because they were written by older versions of Pebble, are not
+		// compacted. Periodic compactions are only performed by the leveled
+		// compaction style, when no CompactionPicker is set. No periodic
+		// compactions occur if zero, which is the default.
+		PeriodicCompactionAge time.Duration
+
 		// ReadCompactionRate controls the frequency of read triggered
 		// compactions by adjusting `AllowedSeeks` in manifest.FileMetadata:
 		//
@@ -338,6 +592,37 @@ type Options struct {
 		// to trigger a read triggered compaction. A value of -1 prevents sampling
 		// and disables read triggered compactions.
 		ReadSamplingMultiplier uint64
+
+		// TableWriterParallelism is the maximum number of data blocks of an
+		// sstable being written by a flush or compaction which are compressed
+		// concurrently. Compression is often the bottleneck of flushes and
+		// compactions, which otherwise compress data blocks on a single
+		// goroutine. Values of 0 and 1 disable parallel compression, which is
+		// the default.
+		TableWriterParallelism int
+
+		// WALCompression enables Snappy compression of the records written to
+		// the WAL, which reduces write bandwidth for compressible workloads. A
+		// record is only compressed if doing so makes it smaller. Batches are
+		// compressed before entering the commit pipeline, so compression does
+		// not serialize concurrent commits. WALs containing compressed records
+		// cannot be replayed by versions of Pebble which predate WAL
+		// compression. WALs written without compression are always replayable.
+		WALCompression bool
+
+		// MaxSubcompactions is the maximum number of subcompactions a single
+		// compaction is split into. A compaction whose inputs are large enough
+		// to produce several output tables has its key space partitioned at the
+		// boundaries of the output level's tables, and the partitions are
+		// compacted concurrently, each producing its own output tables. This
+		// reduces the latency of large compactions, such as L0->Lbase
+		// compactions during write bursts, at the cost of additional CPU and
+		// I/O concurrency. Flushes and compactions into L0 are never split.
+		// Each subcompaction occupies one of the MaxConcurrentCompactions
+		// slots, so a compaction is only split into as many subcompactions as
+		// there are free slots. Values of 0 and 1 disable subcompactions, which
+		// is the default.
+		MaxSubcompactions int
 	}
 
 	// Filters is a map from filter policy name to filter policy. It is used for
@@ -426,17 +711,38 @@ type Options struct {
 	// when L0 read-amplification passes the L0CompactionConcurrency threshold.
 	MaxConcurrentCompactions int
 
+	// OutputSplitKey, if non-nil, returns the smallest split key greater than
+	// the specified user key, or nil if there is none. Flushes and compactions
+	// end an output table before a split key, so that tables do not span the
+	// split keys, such as the boundaries of application partitions. The
+	// returned key must not be modified. Split keys are hints: a split is
+	// deferred where it would break an invariant of the LSM, and a range
+	// tombstone may extend a table past a split key.
+	OutputSplitKey func(key []byte) []byte
+
 	// ReadOnly indicates that the DB should be opened in read-only mode. Writes
 	// to the DB will return an error, background compactions are disabled, and
 	// the flush that normally occurs after replaying the WAL at startup is
 	// disabled.
 	ReadOnly bool
 
+	// TableChecksum specifies the checksum algorithm used for the blocks of
+	// newly written sstables. The algorithm is recorded in the table footer and
+	// checksums are verified whenever a block is read, so tables written with
+	// different algorithms can coexist. The default is ChecksumTypeCRC32c.
+	TableChecksum ChecksumType
+
 	// TablePropertyCollectors is a list of TablePropertyCollector creation
 	// functions. A new TablePropertyCollector is created for each sstable built
 	// and lives for the lifetime of the table.
 	TablePropertyCollectors []func() TablePropertyCollector
 
+	// BlockPropertyCollectors is a list of BlockPropertyCollector creation
+	// functions. A new BlockPropertyCollector is created for each sstable built
+	// and lives for the lifetime of writing that table. The collected
+	// properties are used by IterOptions.BlockPropertyFilters.
+	BlockPropertyCollectors []func() BlockPropertyCollector
+
 	// WALBytesPerSync sets the number of bytes to write to a WAL before calling
 	// Sync on it in the background. Just like with BytesPerSync above, this
 	// helps smooth out disk write latencies, and avoids cases where the OS
@@ -465,6 +771,11 @@ type Options struct {
 	// changing options dynamically?
 	WALMinSyncInterval func() time.Duration
 
+	// WALRecoveryMode specifies how corruption is handled when replaying the
+	// WALs while opening the DB. The default value is
+	// WALRecoveryTolerateCorruptedTail.
+	WALRecoveryMode WALRecoveryMode
+
 	// private options are only used by internal tests or are used internally
 	// for facilitating upgrade paths of unconfigurable functionality.
 	private struct {
@@ -595,9 +906,15 @@ func (o *Options) EnsureDefaults() *Options {
 	if o.FlushSplitBytes <= 0 {
 		o.FlushSplitBytes = 2 * o.Levels[0].TargetFileSize
 	}
+	if o.Experimental.MemTableTombstoneFlushMinRecords <= 0 {
+		o.Experimental.MemTableTombstoneFlushMinRecords = 1000
+	}
 	if o.Experimental.ReadCompactionRate == 0 {
 		o.Experimental.ReadCompactionRate = 16000
 	}
+	if o.Experimental.TombstoneDenseCompactionMinDeletions <= 0 {
+		o.Experimental.TombstoneDenseCompactionMinDeletions = 100
+	}
 	if o.Experimental.ReadSamplingMultiplier == 0 {
 		o.Experimental.ReadSamplingMultiplier = 1
 	}
@@ -667,6 +984,7 @@ func (o *Options) String() string {
 	fmt.Fprintf(&buf, "  cache_size=%d\n", cacheSize)
 	fmt.Fprintf(&buf, "  cleaner=%s\n", o.Cleaner)
 	fmt.Fprintf(&buf, "  comparer=%s\n", o.Comparer.Name)
+	fmt.Fprintf(&buf, "  compaction_style=%s\n", o.CompactionStyle)
 	fmt.Fprintf(&buf, "  delete_range_flush_delay=%s\n", o.Experimental.DeleteRangeFlushDelay)
 	fmt.Fprintf(&buf, "  disable_wal=%t\n", o.DisableWAL)
 	fmt.Fprintf(&buf, "  flush_split_bytes=%d\n", o.FlushSplitBytes)
@@ -674,15 +992,28 @@ func (o *Options) String() string {
 	fmt.Fprintf(&buf, "  l0_compaction_threshold=%d\n", o.L0CompactionThreshold)
 	fmt.Fprintf(&buf, "  l0_stop_writes_threshold=%d\n", o.L0StopWritesThreshold)
 	fmt.Fprintf(&buf, "  lbase_max_bytes=%d\n", o.LBaseMaxBytes)
+	fmt.Fprintf(&buf, "  max_compaction_rate=%d\n", o.Experimental.MaxCompactionRate)
 	fmt.Fprintf(&buf, "  max_concurrent_compactions=%d\n", o.MaxConcurrentCompactions)
 	fmt.Fprintf(&buf, "  max_manifest_file_size=%d\n", o.MaxManifestFileSize)
 	fmt.Fprintf(&buf, "  max_open_files=%d\n", o.MaxOpenFiles)
+	fmt.Fprintf(&buf, "  max_subcompactions=%d\n", o.Experimental.MaxSubcompactions)
+	fmt.Fprintf(&buf, "  mem_table_bloom_size_ratio=%s\n",
+		strconv.FormatFloat(o.Experimental.MemTableBloomSizeRatio, 'g', -1, 64))
+	fmt.Fprintf(&buf, "  mem_table_height_probability=%s\n",
+		strconv.FormatFloat(o.Experimental.MemTableHeightProbability, 'g', -1, 64))
+	fmt.Fprintf(&buf, "  mem_table_max_height=%d\n", o.Experimental.MemTableMaxHeight)
 	fmt.Fprintf(&buf, "  mem_table_size=%d\n", o.MemTableSize)
 	fmt.Fprintf(&buf, "  mem_table_stop_writes_threshold=%d\n", o.MemTableStopWritesThreshold)
+	fmt.Fprintf(&buf, "  mem_table_tombstone_flush_min_records=%d\n",
+		o.Experimental.MemTableTombstoneFlushMinRecords)
+	fmt.Fprintf(&buf, "  mem_table_tombstone_flush_ratio=%s\n",
+		strconv.FormatFloat(o.Experimental.MemTableTombstoneFlushRatio, 'g', -1, 64))
 	fmt.Fprintf(&buf, "  min_compaction_rate=%d\n", o.private.minCompactionRate)
 	fmt.Fprintf(&buf, "  min_flush_rate=%d\n", o.private.minFlushRate)
 	fmt.Fprintf(&buf, "  merger=%s\n", o.Merger.Name)
+	fmt.Fprintf(&buf, "  periodic_compaction_age=%s\n", o.Experimental.PeriodicCompactionAge)
 	fmt.Fprintf(&buf, "  strict_wal_tail=%t\n", o.private.strictWALTail)
+	fmt.Fprintf(&buf, "  table_checksum=%s\n", o.TableChecksum)
 	fmt.Fprintf(&buf, "  table_property_collectors=[")
 	for i := range o.TablePropertyCollectors {
 		if i > 0 {
@@ -693,8 +1024,15 @@ func (o *Options) String() string {
 		fmt.Fprintf(&buf, "%s", o.TablePropertyCollectors[i]().Name())
 	}
 	fmt.Fprintf(&buf, "]\n")
+	fmt.Fprintf(&buf, "  table_writer_parallelism=%d\n", o.Experimental.TableWriterParallelism)
+	fmt.Fprintf(&buf, "  tombstone_dense_compaction_min_deletions=%d\n",
+		o.Experimental.TombstoneDenseCompactionMinDeletions)
+	fmt.Fprintf(&buf, "  tombstone_dense_compaction_ratio=%s\n",
+		strconv.FormatFloat(o.Experimental.TombstoneDenseCompactionRatio, 'g', -1, 64))
+	fmt.Fprintf(&buf, "  wal_compression=%t\n", o.Experimental.WALCompression)
 	fmt.Fprintf(&buf, "  wal_dir=%s\n", o.WALDir)
 	fmt.Fprintf(&buf, "  wal_bytes_per_sync=%d\n", o.WALBytesPerSync)
+	fmt.Fprintf(&buf, "  wal_recovery_mode=%s\n", o.WALRecoveryMode)
 
 	for i := range o.Levels {
 		l := &o.Levels[i]
@@ -703,6 +1041,8 @@ func (o *Options) String() string {
 		fmt.Fprintf(&buf, "  block_restart_interval=%d\n", l.BlockRestartInterval)
 		fmt.Fprintf(&buf, "  block_size=%d\n", l.BlockSize)
 		fmt.Fprintf(&buf, "  compression=%s\n", l.Compression)
+		fmt.Fprintf(&buf, "  data_block_hash_index=%t\n", l.DataBlockHashIndex)
+		fmt.Fprintf(&buf, "  filter_block_size=%d\n", l.FilterBlockSize)
 		fmt.Fprintf(&buf, "  filter_policy=%s\n", filterPolicyName(l.FilterPolicy))
 		fmt.Fprintf(&buf, "  filter_type=%s\n", l.FilterType)
 		fmt.Fprintf(&buf, "  index_block_size=%d\n", l.IndexBlockSize)
@@ -750,6 +1090,13 @@ func parseOptions(s string, fn func(section, key, value string) error) error {
 				key = "comparer"
 			case "merge_operator":
 				key = "merger"
+			case "compaction_style":
+				switch value {
+				case "kCompactionStyleLevel":
+					value = "leveled"
+				case "kCompactionStyleUniversal":
+					value = "tiered"
+				}
 			}
 		}
 
@@ -825,6 +1172,18 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 						o.Comparer, err = hooks.NewComparer(value)
 					}
 				}
+			case "compaction_style":
+				switch value {
+				case "leveled":
+					o.CompactionStyle = CompactionStyleLeveled
+				case "tiered":
+					o.CompactionStyle = CompactionStyleTiered
+				default:
+					if hooks != nil && hooks.SkipUnknown != nil && hooks.SkipUnknown(section+"."+key) {
+						return nil
+					}
+					return errors.Errorf("pebble: unknown compaction style: %q", errors.Safe(value))
+				}
 			case "delete_range_flush_delay":
 				o.Experimental.DeleteRangeFlushDelay, err = time.ParseDuration(value)
 			case "disable_wal":
@@ -841,20 +1200,36 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				// Do nothing; option existed in older versions of pebble.
 			case "lbase_max_bytes":
 				o.LBaseMaxBytes, err = strconv.ParseInt(value, 10, 64)
+			case "max_compaction_rate":
+				o.Experimental.MaxCompactionRate, err = strconv.Atoi(value)
 			case "max_concurrent_compactions":
 				o.MaxConcurrentCompactions, err = strconv.Atoi(value)
 			case "max_manifest_file_size":
 				o.MaxManifestFileSize, err = strconv.ParseInt(value, 10, 64)
 			case "max_open_files":
 				o.MaxOpenFiles, err = strconv.Atoi(value)
+			case "max_subcompactions":
+				o.Experimental.MaxSubcompactions, err = strconv.Atoi(value)
+			case "mem_table_bloom_size_ratio":
+				o.Experimental.MemTableBloomSizeRatio, err = strconv.ParseFloat(value, 64)
+			case "mem_table_height_probability":
+				o.Experimental.MemTableHeightProbability, err = strconv.ParseFloat(value, 64)
+			case "mem_table_max_height":
+				o.Experimental.MemTableMaxHeight, err = strconv.Atoi(value)
 			case "mem_table_size":
 				o.MemTableSize, err = strconv.Atoi(value)
 			case "mem_table_stop_writes_threshold":
 				o.MemTableStopWritesThreshold, err = strconv.Atoi(value)
+			case "mem_table_tombstone_flush_min_records":
+				o.Experimental.MemTableTombstoneFlushMinRecords, err = strconv.Atoi(value)
+			case "mem_table_tombstone_flush_ratio":
+				o.Experimental.MemTableTombstoneFlushRatio, err = strconv.ParseFloat(value, 64)
 			case "min_compaction_rate":
 				o.private.minCompactionRate, err = strconv.Atoi(value)
 			case "min_flush_rate":
 				o.private.minFlushRate, err = strconv.Atoi(value)
+			case "periodic_compaction_age":
+				o.Experimental.PeriodicCompactionAge, err = time.ParseDuration(value)
 			case "strict_wal_tail":
 				o.private.strictWALTail, err = strconv.ParseBool(value)
 			case "merger":
@@ -875,12 +1250,40 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				default:
 					return errors.Errorf("pebble: unknown table format: %q", errors.Safe(value))
 				}
+			case "table_checksum":
+				switch value {
+				case "CRC32c":
+					o.TableChecksum = ChecksumTypeCRC32c
+				case "XXHash64":
+					o.TableChecksum = ChecksumTypeXXHash64
+				default:
+					return errors.Errorf("pebble: unknown table checksum: %q", errors.Safe(value))
+				}
 			case "table_property_collectors":
 				// TODO(peter): set o.TablePropertyCollectors
+			case "table_writer_parallelism":
+				o.Experimental.TableWriterParallelism, err = strconv.Atoi(value)
+			case "tombstone_dense_compaction_min_deletions":
+				o.Experimental.TombstoneDenseCompactionMinDeletions, err = strconv.Atoi(value)
+			case "tombstone_dense_compaction_ratio":
+				o.Experimental.TombstoneDenseCompactionRatio, err = strconv.ParseFloat(value, 64)
+			case "wal_compression":
+				o.Experimental.WALCompression, err = strconv.ParseBool(value)
 			case "wal_dir":
 				o.WALDir = value
 			case "wal_bytes_per_sync":
 				o.WALBytesPerSync, err = strconv.Atoi(value)
+			case "wal_recovery_mode":
+				switch value {
+				case "tolerate-corrupted-tail":
+					o.WALRecoveryMode = WALRecoveryTolerateCorruptedTail
+				case "absolute-consistency":
+					o.WALRecoveryMode = WALRecoveryAbsoluteConsistency
+				case "skip-corrupted-records":
+					o.WALRecoveryMode = WALRecoverySkipCorruptedRecords
+				default:
+					return errors.Errorf("pebble: unknown WAL recovery mode: %q", errors.Safe(value))
+				}
 			default:
 				if hooks != nil && hooks.SkipUnknown != nil && hooks.SkipUnknown(section+"."+key) {
 					return nil
@@ -927,6 +1330,10 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				default:
 					return errors.Errorf("pebble: unknown compression: %q", errors.Safe(value))
 				}
+			case "data_block_hash_index":
+				l.DataBlockHashIndex, err = strconv.ParseBool(value)
+			case "filter_block_size":
+				l.FilterBlockSize, err = strconv.Atoi(value)
 			case "filter_policy":
 				if hooks != nil && hooks.NewFilterPolicy != nil {
 					l.FilterPolicy, err = hooks.NewFilterPolicy(value)
@@ -1007,10 +1414,36 @@ func (o *Options) Validate() error {
 		fmt.Fprintf(&buf, "L0StopWritesThreshold (%d) must be >= L0CompactionThreshold (%d)\n",
 			o.L0StopWritesThreshold, o.L0CompactionThreshold)
 	}
+	switch o.TableChecksum {
+	case ChecksumTypeCRC32c, ChecksumTypeXXHash64:
+	default:
+		fmt.Fprintf(&buf, "TableChecksum (%s) must be %s or %s\n",
+			o.TableChecksum, ChecksumTypeCRC32c, ChecksumTypeXXHash64)
+	}
+	if o.Experimental.MaxCompactionRate < 0 {
+		fmt.Fprintf(&buf, "MaxCompactionRate (%d) must be >= 0\n",
+			o.Experimental.MaxCompactionRate)
+	}
+	if o.MemTableSize <= int(memTableEmptySize) {
+		fmt.Fprintf(&buf, "MemTableSize (%d) must be > %d\n",
+			o.MemTableSize, memTableEmptySize)
+	}
 	if uint64(o.MemTableSize) >= maxMemTableSize {
 		fmt.Fprintf(&buf, "MemTableSize (%s) must be < %s\n",
 			humanize.Uint64(uint64(o.MemTableSize)), humanize.Uint64(maxMemTableSize))
 	}
+	if r := o.Experimental.MemTableBloomSizeRatio; r < 0 || r >= 1 {
+		fmt.Fprintf(&buf, "MemTableBloomSizeRatio (%g) must be >= 0 and < 1\n", r)
+	}
+	if r := o.Experimental.MemTableTombstoneFlushRatio; r < 0 || r > 1 {
+		fmt.Fprintf(&buf, "MemTableTombstoneFlushRatio (%g) must be >= 0 and <= 1\n", r)
+	}
+	if r := o.Experimental.TombstoneDenseCompactionRatio; r < 0 || r > 1 {
+		fmt.Fprintf(&buf, "TombstoneDenseCompactionRatio (%g) must be >= 0 and <= 1\n", r)
+	}
+	if err := o.memTableSkiplistOptions().Validate(); err != nil {
+		fmt.Fprintf(&buf, "%s\n", err)
+	}
 	if o.MemTableStopWritesThreshold < 2 {
 		fmt.Fprintf(&buf, "MemTableStopWritesThreshold (%d) must be >= 2\n",
 			o.MemTableStopWritesThreshold)
@@ -1021,6 +1454,15 @@ func (o *Options) Validate() error {
 	return errors.New(buf.String())
 }
 
+// memTableSkiplistOptions constructs arenaskl.Options for the memtable
+// skiplist from the corresponding options in the receiver.
+func (o *Options) memTableSkiplistOptions() arenaskl.Options {
+	return arenaskl.Options{
+		MaxHeight:   o.Experimental.MemTableMaxHeight,
+		Probability: o.Experimental.MemTableHeightProbability,
+	}
+}
+
 // MakeReaderOptions constructs sstable.ReaderOptions from the corresponding
 // options in the receiver.
 func (o *Options) MakeReaderOptions() sstable.ReaderOptions {
@@ -1047,15 +1489,30 @@ func (o *Options) MakeWriterOptions(level int) sstable.WriterOptions {
 			writerOpts.MergerName = o.Merger.Name
 		}
 		writerOpts.TableFormat = sstable.TableFormatRocksDBv2
+		if len(o.BlockPropertyCollectors) > 0 {
+			// Block properties cannot be read by RocksDB, so sstables which
+			// contain them use a format which RocksDB rejects.
+			writerOpts.TableFormat = sstable.TableFormatPebblev1
+		}
 		writerOpts.TablePropertyCollectors = o.TablePropertyCollectors
+		writerOpts.BlockPropertyCollectors = o.BlockPropertyCollectors
+		writerOpts.Checksum = o.TableChecksum
+		writerOpts.Parallelism = o.Experimental.TableWriterParallelism
 	}
 	levelOpts := o.Level(level)
 	writerOpts.BlockRestartInterval = levelOpts.BlockRestartInterval
 	writerOpts.BlockSize = levelOpts.BlockSize
 	writerOpts.BlockSizeThreshold = levelOpts.BlockSizeThreshold
 	writerOpts.Compression = levelOpts.Compression
+	writerOpts.DataBlockHashIndex = levelOpts.DataBlockHashIndex
+	writerOpts.FilterBlockSize = levelOpts.FilterBlockSize
 	writerOpts.FilterPolicy = levelOpts.FilterPolicy
 	writerOpts.FilterType = levelOpts.FilterType
 	writerOpts.IndexBlockSize = levelOpts.IndexBlockSize
+	if levelOpts.DataBlockHashIndex {
+		// The hash index changes the encoding of the restart points of data
+		// blocks, which RocksDB and older versions of Pebble would misread.
+		writerOpts.TableFormat = sstable.TableFormatPebblev1
+	}
 	return writerOpts
 }
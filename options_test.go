@@ -5,11 +5,13 @@
 package pebble
 
 import (
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/stretchr/testify/require"
 )
@@ -48,6 +50,7 @@ func TestOptionsString(t *testing.T) {
   cache_size=8388608
   cleaner=delete
   comparer=leveldb.BytewiseComparator
+  compaction_style=leveled
   delete_range_flush_delay=0s
   disable_wal=false
   flush_split_bytes=4194304
@@ -55,23 +58,39 @@ func TestOptionsString(t *testing.T) {
   l0_compaction_threshold=4
   l0_stop_writes_threshold=12
   lbase_max_bytes=67108864
+  max_compaction_rate=0
   max_concurrent_compactions=1
   max_manifest_file_size=134217728
   max_open_files=1000
+  max_subcompactions=0
+  mem_table_bloom_size_ratio=0
+  mem_table_height_probability=0
+  mem_table_max_height=0
   mem_table_size=4194304
   mem_table_stop_writes_threshold=2
+  mem_table_tombstone_flush_min_records=1000
+  mem_table_tombstone_flush_ratio=0
   min_compaction_rate=4194304
   min_flush_rate=1048576
   merger=pebble.concatenate
+  periodic_compaction_age=0s
   strict_wal_tail=true
+  table_checksum=CRC32c
   table_property_collectors=[]
+  table_writer_parallelism=0
+  tombstone_dense_compaction_min_deletions=100
+  tombstone_dense_compaction_ratio=0
+  wal_compression=false
   wal_dir=
   wal_bytes_per_sync=0
+  wal_recovery_mode=tolerate-corrupted-tail
 
 [Level "0"]
   block_restart_interval=16
   block_size=4096
   compression=Snappy
+  data_block_hash_index=false
+  filter_block_size=0
   filter_policy=none
   filter_type=table
   index_block_size=4096
@@ -128,6 +147,45 @@ func TestOptionsCheck(t *testing.T) {
 	require.NoError(t, tmp.Check(s))
 }
 
+func TestOptionsDataBlockHashIndexTableFormat(t *testing.T) {
+	opts := &Options{Levels: make([]LevelOptions, 2)}
+	opts.Levels[1].DataBlockHashIndex = true
+	opts.EnsureDefaults()
+	require.Equal(t, sstable.TableFormatRocksDBv2, opts.MakeWriterOptions(0).TableFormat)
+	require.Equal(t, sstable.TableFormatPebblev1, opts.MakeWriterOptions(1).TableFormat)
+}
+
+func TestOptionsTableChecksum(t *testing.T) {
+	opts := (&Options{}).EnsureDefaults()
+	require.Equal(t, ChecksumTypeCRC32c, opts.MakeWriterOptions(0).Checksum)
+	opts.TableChecksum = ChecksumTypeXXHash64
+	require.Equal(t, ChecksumTypeXXHash64, opts.MakeWriterOptions(0).Checksum)
+	require.NoError(t, opts.Validate())
+	opts.TableChecksum = sstable.ChecksumTypeNone
+	require.Regexp(t, `TableChecksum \(None\) must be CRC32c or XXHash64`, opts.Validate())
+
+	// Tables written with either checksum can be read regardless of the
+	// checksum configured when the DB is reopened.
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{FS: mem, TableChecksum: ChecksumTypeXXHash64})
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("a"), []byte("xxhash64"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Close())
+
+	d, err = Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("b"), []byte("crc32c"), nil))
+	require.NoError(t, d.Flush())
+	for k, v := range map[string]string{"a": "xxhash64", "b": "crc32c"} {
+		val, closer, err := d.Get([]byte(k))
+		require.NoError(t, err)
+		require.Equal(t, v, string(val))
+		require.NoError(t, closer.Close())
+	}
+	require.NoError(t, d.Close())
+}
+
 type testCleaner struct{}
 
 func (testCleaner) Clean(fs vfs.FS, fileType base.FileType, path string) error {
@@ -190,6 +248,11 @@ func TestOptionsParse(t *testing.T) {
 			opts.Levels[1].BlockSize = 2048
 			opts.Levels[2].BlockSize = 4096
 			opts.Experimental.DeleteRangeFlushDelay = 10 * time.Second
+			opts.Experimental.MaxCompactionRate = 64 << 20
+			opts.Experimental.MemTableBloomSizeRatio = 0.125
+			opts.Experimental.MemTableMaxHeight = 12
+			opts.Experimental.MemTableHeightProbability = 0.25
+			opts.TableChecksum = ChecksumTypeXXHash64
 			opts.EnsureDefaults()
 			str := opts.String()
 
@@ -226,12 +289,36 @@ func TestOptionsValidate(t *testing.T) {
 			`L0StopWritesThreshold .* must be >= L0CompactionThreshold .*`,
 		},
 		{`
+[Options]
+  max_compaction_rate=-1
+`,
+			`MaxCompactionRate \(-1\) must be >= 0`,
+		},
+		{`
+[Options]
+  mem_table_size=512
+`,
+			`MemTableSize \(512\) must be > [0-9]+`,
+		},
+		{`
 [Options]
   mem_table_size=4294967296
 `,
 			`MemTableSize \(4\.0 G\) must be < 4\.0 G`,
 		},
 		{`
+[Options]
+  mem_table_bloom_size_ratio=1.5
+`,
+			`MemTableBloomSizeRatio \(1\.5\) must be >= 0 and < 1`,
+		},
+		{`
+[Options]
+  mem_table_height_probability=1
+`,
+			`probability 1\.0+ must be 0 \(the default\) or in the range \(0, 1\)`,
+		},
+		{`
 [Options]
   mem_table_stop_writes_threshold=1
 `,
@@ -253,4 +340,20 @@ func TestOptionsValidate(t *testing.T) {
 			}
 		})
 	}
+
+	t.Run("memtable-skiplist", func(t *testing.T) {
+		var opts Options
+		opts.EnsureDefaults()
+		opts.Experimental.MemTableMaxHeight = 21
+		require.Regexp(t, `max height 21 must be 0 \(the default\) or in the range \[1, 20\]`, opts.Validate())
+		opts.Experimental.MemTableMaxHeight = 4
+		opts.Experimental.MemTableHeightProbability = 0.5
+		require.NoError(t, opts.Validate())
+
+		m := newMemTable(memTableOptions{Options: &opts})
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, m.set(ikey(strconv.Itoa(i)), nil))
+		}
+		require.LessOrEqual(t, m.skl.Height(), uint32(4))
+	})
 }
@@ -5,6 +5,7 @@
 package pebble
 
 import (
+	"sync"
 	"time"
 
 	"github.com/cockroachdb/errors"
@@ -160,6 +161,31 @@ func (p *compactionPacer) maybeThrottle(bytesIterated uint64) error {
 	return p.limit(compactAmount, curCompactionDebt)
 }
 
+// sharedPacer serializes the use of a compaction's pacer by its concurrently
+// running subcompactions. The pacer is throttled in terms of the bytes iterated
+// by all of the subcompactions.
+type sharedPacer struct {
+	mu            sync.Mutex
+	pacer         pacer
+	bytesIterated uint64
+}
+
+// subcompactionPacer is the pacer of a single subcompaction. It adds the bytes
+// iterated by the subcompaction to the total of its sharedPacer.
+type subcompactionPacer struct {
+	shared        *sharedPacer
+	bytesIterated uint64
+}
+
+func (p *subcompactionPacer) maybeThrottle(bytesIterated uint64) error {
+	s := p.shared
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bytesIterated += bytesIterated - p.bytesIterated
+	p.bytesIterated = bytesIterated
+	return s.pacer.maybeThrottle(s.bytesIterated)
+}
+
 // flushPacerInfo contains information necessary for compaction pacing.
 type flushPacerInfo struct {
 	inuseBytes uint64
@@ -326,6 +352,25 @@ func (p *deletionPacer) maybeThrottle(bytesToDelete uint64) error {
 	return p.limit(bytesToDelete, p.getInfo())
 }
 
+// waitN blocks until the limiter permits amount bytes. The bytes are requested
+// from the limiter in chunks of at most its burst size.
+func waitN(l limiter, amount uint64) error {
+	burst := uint64(l.Burst())
+	for amount > 0 {
+		n := amount
+		if n > burst {
+			n = burst
+		}
+		d := l.DelayN(time.Now(), int(n))
+		if d == rate.InfDuration {
+			return errors.Errorf("pacing failed")
+		}
+		time.Sleep(d)
+		amount -= n
+	}
+	return nil
+}
+
 type noopPacer struct{}
 
 func (p *noopPacer) maybeThrottle(_ uint64) error {
@@ -170,3 +170,44 @@ func TestCompactionPacerMaybeThrottle(t *testing.T) {
 			}
 		})
 }
+
+func TestWaitN(t *testing.T) {
+	mockLimiter := mockPrintLimiter{burst: 100}
+	if err := waitN(&mockLimiter, 250); err != nil {
+		t.Fatal(err)
+	}
+	expected := "wait: 100\nwait: 100\nwait: 50\n"
+	if s := mockLimiter.buf.String(); s != expected {
+		t.Fatalf("expected\n%s\nbut found\n%s", expected, s)
+	}
+}
+
+type recordingPacer struct {
+	bytesIterated []uint64
+}
+
+func (p *recordingPacer) maybeThrottle(bytesIterated uint64) error {
+	p.bytesIterated = append(p.bytesIterated, bytesIterated)
+	return nil
+}
+
+func TestSubcompactionPacer(t *testing.T) {
+	var rp recordingPacer
+	shared := &sharedPacer{pacer: &rp}
+	a := &subcompactionPacer{shared: shared}
+	b := &subcompactionPacer{shared: shared}
+	for _, step := range []struct {
+		p             *subcompactionPacer
+		bytesIterated uint64
+	}{
+		{a, 10}, {b, 5}, {a, 30}, {b, 25},
+	} {
+		if err := step.p.maybeThrottle(step.bytesIterated); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := "[10 15 35 55]"
+	if s := fmt.Sprint(rp.bytesIterated); s != expected {
+		t.Fatalf("expected %s, but found %s", expected, s)
+	}
+}
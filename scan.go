@@ -0,0 +1,63 @@
+// Copyright 2021 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+// ScanOptions hold the optional parameters for Scan.
+type ScanOptions struct {
+	// MaxKeys is the maximum number of key/value pairs returned by a Scan. Zero
+	// means no limit.
+	MaxKeys int
+	// MaxBytes is the maximum number of key and value bytes returned by a
+	// Scan. The limit is checked before each key/value pair is added, so the
+	// limit may be exceeded by the final key/value pair. At least one key/value
+	// pair is returned if the range is not empty, even if it exceeds the limit.
+	// Zero means no limit.
+	MaxBytes int64
+}
+
+// ScanResult holds the key/value pairs returned by Scan.
+type ScanResult struct {
+	// Keys and Values hold the key/value pairs in the scanned range, in key
+	// order. They are copies, and are owned by the caller.
+	Keys   [][]byte
+	Values [][]byte
+	// Bytes is the total size of Keys and Values.
+	Bytes int64
+	// ResumeKey is the first key which was not returned due to the limits, or
+	// nil if the range was exhausted. Passing it as the start key to a
+	// subsequent Scan continues the scan.
+	ResumeKey []byte
+}
+
+// Scan returns the key/value pairs in the range [start, end) of the Reader,
+// up to the limits specified by the options. A nil start or end key leaves the
+// range unbounded. Scan is intended for paginated range reads: if the limits
+// are reached, the returned ResumeKey is the start key of the next page.
+//
+// Scan reads from a single Iterator, so each page is a consistent view of the
+// Reader. Use a Snapshot as the Reader to make successive pages consistent.
+func Scan(r Reader, start, end []byte, opts ScanOptions) (ScanResult, error) {
+	var res ScanResult
+	iter := r.NewIter(&IterOptions{
+		LowerBound: start,
+		UpperBound: end,
+	})
+	for valid := iter.First(); valid; valid = iter.Next() {
+		key, value := iter.Key(), iter.Value()
+		if len(res.Keys) > 0 &&
+			((opts.MaxKeys > 0 && len(res.Keys) >= opts.MaxKeys) ||
+				(opts.MaxBytes > 0 && res.Bytes >= opts.MaxBytes)) {
+			res.ResumeKey = append([]byte(nil), key...)
+			break
+		}
+		res.Keys = append(res.Keys, append([]byte(nil), key...))
+		res.Values = append(res.Values, append([]byte(nil), value...))
+		res.Bytes += int64(len(key) + len(value))
+	}
+	if err := iter.Close(); err != nil {
+		return ScanResult{}, err
+	}
+	return res, nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2021 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"sync/atomic"
+
+	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/internal/rangedel"
+)
+
+// ScanInternal scans the internal keys in the range [lower, upper) of the DB,
+// for use by replication and backup layers and by debugging tools. A nil lower
+// or upper key leaves the range unbounded. Unlike an Iterator, ScanInternal
+// does not elide any keys: every point key visible to the scan, including
+// deletion tombstones, merge operands and keys shadowed by newer keys or by
+// range deletions, is passed to visitPointKey in internal key order. Every
+// range deletion fragment overlapping the range is passed to visitRangeDel,
+// truncated to the range and to the bounds of the sstable in which it is in
+// effect, after all of the point keys have been visited. The same range
+// deletion may be visited more than once, as it may be fragmented differently
+// in the memtables and sstables. Either visit function may be nil.
+//
+// The scan reads from a consistent view of the DB, and only visits keys with
+// sequence numbers less than the DB's visible sequence number at the start of
+// the scan. The keys and values passed to the visit functions are only valid
+// for the duration of the call. If a visit function returns an error,
+// ScanInternal stops and returns the error.
+func (d *DB) ScanInternal(
+	lower, upper []byte,
+	visitPointKey func(key *InternalKey, value []byte) error,
+	visitRangeDel func(start, end []byte, seqNum uint64) error,
+) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+
+	readState := d.loadReadState()
+	defer readState.unref()
+	seqNum := atomic.LoadUint64(&d.mu.versions.atomic.visibleSeqNum)
+
+	// Only read from memtables which contain sequence numbers older than
+	// seqNum. See finishInitializingIter.
+	var memtables flushableList
+	for _, mem := range readState.memtables {
+		if mem.logSeqNum < seqNum {
+			memtables = append(memtables, mem)
+		}
+	}
+
+	if visitPointKey != nil {
+		if err := d.scanInternalPointKeys(readState, memtables, seqNum, lower, upper, visitPointKey); err != nil {
+			return err
+		}
+	}
+	if visitRangeDel != nil {
+		return d.scanInternalRangeDels(readState, memtables, seqNum, lower, upper, visitRangeDel)
+	}
+	return nil
+}
+
+func (d *DB) scanInternalPointKeys(
+	readState *readState,
+	memtables flushableList,
+	seqNum uint64,
+	lower, upper []byte,
+	visit func(key *InternalKey, value []byte) error,
+) error {
+	opts := &IterOptions{
+		LowerBound: lower,
+		UpperBound: upper,
+		logger:     d.opts.Logger,
+	}
+	// The merging iterator is created without range deletion iterators, so
+	// that it does not elide the point keys deleted by range deletions.
+	var iters []internalIterator
+	for i := len(memtables) - 1; i >= 0; i-- {
+		iters = append(iters, memtables[i].newIter(opts))
+	}
+	current := readState.current
+	addLevelIter := func(files manifest.LevelIterator, level manifest.Level) {
+		li := &levelIter{}
+		li.init(*opts, d.cmp, d.newIters, files, level, nil)
+		iters = append(iters, li)
+	}
+	for i := len(current.L0Sublevels.Levels) - 1; i >= 0; i-- {
+		addLevelIter(current.L0Sublevels.Levels[i].Iter(), manifest.L0Sublevel(i))
+	}
+	for level := 1; level < len(current.Levels); level++ {
+		if !current.Levels[level].Empty() {
+			addLevelIter(current.Levels[level].Iter(), manifest.Level(level))
+		}
+	}
+	iter := newMergingIter(d.opts.Logger, d.cmp, iters...)
+	iter.snapshot = seqNum
+
+	var key *InternalKey
+	var value []byte
+	if lower != nil {
+		key, value = iter.SeekGE(lower)
+	} else {
+		key, value = iter.First()
+	}
+	for ; key != nil; key, value = iter.Next() {
+		if upper != nil && d.cmp(key.UserKey, upper) >= 0 {
+			break
+		}
+		if err := visit(key, value); err != nil {
+			_ = iter.Close()
+			return err
+		}
+	}
+	return iter.Close()
+}
+
+func (d *DB) scanInternalRangeDels(
+	readState *readState,
+	memtables flushableList,
+	seqNum uint64,
+	lower, upper []byte,
+	visit func(start, end []byte, seqNum uint64) error,
+) error {
+	visitIter := func(iter internalIterator) error {
+		if iter == nil {
+			return nil
+		}
+		for key, end := iter.First(); key != nil; key, end = iter.Next() {
+			if !key.Visible(seqNum) {
+				continue
+			}
+			start := key.UserKey
+			if lower != nil && d.cmp(start, lower) < 0 {
+				start = lower
+			}
+			if upper != nil && d.cmp(end, upper) > 0 {
+				end = upper
+			}
+			if d.cmp(start, end) >= 0 {
+				continue
+			}
+			if err := visit(start, end, key.SeqNum()); err != nil {
+				_ = iter.Close()
+				return err
+			}
+		}
+		return iter.Close()
+	}
+
+	for i := len(memtables) - 1; i >= 0; i-- {
+		if err := visitIter(memtables[i].newRangeDelIter(nil)); err != nil {
+			return err
+		}
+	}
+	current := readState.current
+	for level := range current.Levels {
+		files := current.Levels[level].Iter()
+		for f := files.First(); f != nil; f = files.Next() {
+			if (lower != nil && d.cmp(f.Largest.UserKey, lower) < 0) ||
+				(upper != nil && d.cmp(f.Smallest.UserKey, upper) >= 0) {
+				continue
+			}
+			iter, rangeDelIter, err := d.newIters(f, nil /* opts */, nil /* bytesIterated */)
+			if err != nil {
+				return err
+			}
+			if err := iter.Close(); err != nil {
+				if rangeDelIter != nil {
+					_ = rangeDelIter.Close()
+				}
+				return err
+			}
+			if rangeDelIter == nil {
+				continue
+			}
+			if level == 0 {
+				// Like compactions, do not truncate the range tombstones of L0
+				// tables.
+				if err := visitIter(rangeDelIter); err != nil {
+					return err
+				}
+				continue
+			}
+			// The range tombstones of a table may extend past its bounds, but
+			// are only in effect within them. Truncate them to the bounds of
+			// the table's atomic compaction unit, as compactions do. See
+			// compaction.newInputIter.
+			atomicUnit, _ := expandToAtomicUnit(d.cmp, files.Take().Slice(), true /* disableIsCompacting */)
+			lowerBound, upperBound := manifest.KeyRange(d.cmp, atomicUnit.Iter())
+			truncated := rangedel.Truncate(
+				d.cmp, rangeDelIter, lowerBound.UserKey, upperBound.UserKey, &f.Smallest, &f.Largest)
+			// The truncated range tombstones reference the memory of
+			// rangeDelIter, which is closed once they have been visited.
+			err = visitIter(truncated)
+			err = firstError(err, rangeDelIter.Close())
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
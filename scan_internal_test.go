@@ -0,0 +1,149 @@
+// Copyright 2021 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanInternal(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Merge([]byte("b"), []byte("2"), nil))
+	require.NoError(t, d.Set([]byte("c"), []byte("3"), nil))
+	require.NoError(t, d.DeleteRange([]byte("c"), []byte("e"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("a"), []byte("5"), nil))
+	require.NoError(t, d.Delete([]byte("b"), nil))
+	require.NoError(t, d.Merge([]byte("d"), []byte("7"), nil))
+	require.NoError(t, d.DeleteRange([]byte("a"), []byte("b"), nil))
+
+	scan := func(lower, upper []byte) string {
+		var buf strings.Builder
+		require.NoError(t, d.ScanInternal(lower, upper,
+			func(key *InternalKey, value []byte) error {
+				fmt.Fprintf(&buf, "%s:%s\n", key.Pretty(DefaultComparer.FormatKey), value)
+				return nil
+			},
+			func(start, end []byte, seqNum uint64) error {
+				fmt.Fprintf(&buf, "%s-%s#%d\n", start, end, seqNum)
+				return nil
+			}))
+		return buf.String()
+	}
+
+	// No keys are elided, including the keys deleted by range deletions. Note
+	// that c#3 was elided by the flush, as it was deleted by c-e#4.
+	require.Equal(t, `a#5,SET:5
+a#1,SET:1
+b#6,DEL:
+b#2,MERGE:2
+d#7,MERGE:7
+a-b#8
+c-e#4
+`, scan(nil, nil))
+
+	require.Equal(t, `b#6,DEL:
+b#2,MERGE:2
+c-d#4
+`, scan([]byte("b"), []byte("d")))
+
+	// Keys written after the scan starts are not visited.
+	var keys []string
+	require.NoError(t, d.ScanInternal(nil, nil, func(key *InternalKey, value []byte) error {
+		if len(keys) == 0 {
+			require.NoError(t, d.Set([]byte("z"), nil, nil))
+		}
+		keys = append(keys, string(key.UserKey))
+		return nil
+	}, nil /* visitRangeDel */))
+	require.Equal(t, []string{"a", "a", "b", "b", "d"}, keys)
+
+	// An error returned by a visit function stops the scan.
+	err = d.ScanInternal(nil, nil, nil, func(start, end []byte, seqNum uint64) error {
+		return errors.New("boom")
+	})
+	require.Regexp(t, "boom", err)
+}
+
+func TestScanInternalTruncatedRangeDels(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := &Options{FS: mem}
+	opts.private.disableAutomaticCompactions = true
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// Install two L6 tables split at f, both of which contain the untruncated
+	// range tombstone c-k, as RocksDB writes them. The tombstone is only in
+	// effect within the bounds of each table.
+	d.mu.Lock()
+	ve := &versionEdit{}
+	for _, tbl := range []struct {
+		key               string
+		smallest, largest InternalKey
+	}{
+		{"a", base.MakeInternalKey([]byte("a"), 1, InternalKeyKindSet), base.MakeRangeDeleteSentinelKey([]byte("f"))},
+		{"m", base.MakeInternalKey([]byte("f"), 2, InternalKeyKindRangeDelete), base.MakeInternalKey([]byte("m"), 1, InternalKeyKindSet)},
+	} {
+		fileNum := d.mu.versions.getNextFileNum()
+		f, err := mem.Create(base.MakeFilename(mem, "", fileTypeTable, fileNum))
+		require.NoError(t, err)
+		w := sstable.NewWriter(f, sstable.WriterOptions{})
+		if tbl.key == "a" {
+			require.NoError(t, w.Add(base.MakeInternalKey([]byte("a"), 1, InternalKeyKindSet), nil))
+		}
+		require.NoError(t, w.Add(base.MakeInternalKey([]byte("c"), 2, InternalKeyKindRangeDelete), []byte("k")))
+		if tbl.key == "m" {
+			require.NoError(t, w.Add(base.MakeInternalKey([]byte("m"), 1, InternalKeyKindSet), nil))
+		}
+		require.NoError(t, w.Close())
+		meta, err := w.Metadata()
+		require.NoError(t, err)
+		ve.NewFiles = append(ve.NewFiles, newFileEntry{
+			Level: numLevels - 1,
+			Meta: &fileMetadata{
+				FileNum:        fileNum,
+				Size:           meta.Size,
+				Smallest:       tbl.smallest,
+				Largest:        tbl.largest,
+				SmallestSeqNum: 1,
+				LargestSeqNum:  2,
+			},
+		})
+	}
+	d.mu.versions.logLock()
+	require.NoError(t, d.mu.versions.logAndApply(0, ve, newFileMetrics(ve.NewFiles), d.dataDir,
+		func() []compactionInfo { return nil }))
+	d.updateReadStateLocked(nil)
+	// Make the keys of the tables visible.
+	atomic.StoreUint64(&d.mu.versions.atomic.logSeqNum, 3)
+	atomic.StoreUint64(&d.mu.versions.atomic.visibleSeqNum, 3)
+	d.mu.Unlock()
+
+	scan := func(lower, upper []byte) string {
+		var buf strings.Builder
+		require.NoError(t, d.ScanInternal(lower, upper, nil,
+			func(start, end []byte, seqNum uint64) error {
+				fmt.Fprintf(&buf, "%s-%s#%d\n", start, end, seqNum)
+				return nil
+			}))
+		return buf.String()
+	}
+	require.Equal(t, "c-f#2\nf-k#2\n", scan(nil, nil))
+	require.Equal(t, "g-k#2\n", scan([]byte("g"), nil))
+}
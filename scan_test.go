@@ -0,0 +1,70 @@
+// Copyright 2021 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScan(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	key := func(i int) []byte { return []byte(fmt.Sprintf("%03d", i)) }
+	for i := 0; i < 100; i++ {
+		require.NoError(t, d.Set(key(i), []byte(fmt.Sprint(i)), nil))
+	}
+
+	testCases := []struct {
+		start, end []byte
+		opts       ScanOptions
+		pages      int
+	}{
+		{nil, nil, ScanOptions{}, 1},
+		{nil, nil, ScanOptions{MaxKeys: 10}, 10},
+		{nil, nil, ScanOptions{MaxKeys: 30}, 4},
+		{key(10), key(20), ScanOptions{MaxKeys: 3}, 4},
+		{key(10), key(20), ScanOptions{MaxBytes: 20}, 3},
+		{key(10), key(20), ScanOptions{MaxKeys: 2, MaxBytes: 20}, 5},
+		{key(10), key(20), ScanOptions{MaxBytes: 1}, 10},
+		{key(20), key(10), ScanOptions{MaxKeys: 1}, 1},
+	}
+	for _, c := range testCases {
+		t.Run(fmt.Sprintf("%s-%s-%+v", c.start, c.end, c.opts), func(t *testing.T) {
+			var keys, values [][]byte
+			var pages int
+			for start := c.start; ; pages++ {
+				res, err := Scan(d, start, c.end, c.opts)
+				require.NoError(t, err)
+				if c.opts.MaxKeys > 0 {
+					require.LessOrEqual(t, len(res.Keys), c.opts.MaxKeys)
+				}
+				keys = append(keys, res.Keys...)
+				values = append(values, res.Values...)
+				if res.ResumeKey == nil {
+					pages++
+					break
+				}
+				start = res.ResumeKey
+			}
+			require.Equal(t, c.pages, pages)
+
+			var expectedKeys, expectedValues [][]byte
+			iter := d.NewIter(&IterOptions{LowerBound: c.start, UpperBound: c.end})
+			for iter.First(); iter.Valid(); iter.Next() {
+				expectedKeys = append(expectedKeys, append([]byte(nil), iter.Key()...))
+				expectedValues = append(expectedValues, append([]byte(nil), iter.Value()...))
+			}
+			require.NoError(t, iter.Close())
+			require.Equal(t, expectedKeys, keys)
+			require.Equal(t, expectedValues, values)
+		})
+	}
+}
@@ -5,6 +5,7 @@
 package pebble
 
 import (
+	"context"
 	"io"
 	"math"
 )
@@ -35,7 +36,7 @@ func (s *Snapshot) Get(key []byte) ([]byte, io.Closer, error) {
 	if s.db == nil {
 		panic(ErrClosed)
 	}
-	return s.db.getInternal(key, nil /* batch */, s)
+	return s.db.getInternal(context.Background(), key, nil /* batch */, s)
 }
 
 // NewIter returns an iterator that is unpositioned (Iterator.Valid() will
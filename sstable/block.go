@@ -31,6 +31,9 @@ type blockWriter struct {
 	curValue        []byte
 	prevKey         []byte
 	tmp             [4]byte
+	// hashIndex, if non-nil, builds a hash index for the block. Only used for
+	// data blocks.
+	hashIndex *hashIndexBuilder
 }
 
 func (w *blockWriter) store(keySize int, value []byte) {
@@ -121,6 +124,9 @@ func (w *blockWriter) add(key InternalKey, value []byte) {
 	key.Encode(w.curKey)
 
 	w.store(size, value)
+	if w.hashIndex != nil {
+		w.hashIndex.add(key.UserKey, len(w.restarts)-1)
+	}
 }
 
 func (w *blockWriter) finish() []byte {
@@ -139,7 +145,15 @@ func (w *blockWriter) finish() []byte {
 		binary.LittleEndian.PutUint32(tmp4, x)
 		w.buf = append(w.buf, tmp4...)
 	}
-	binary.LittleEndian.PutUint32(tmp4, uint32(len(w.restarts)))
+	footer := uint32(len(w.restarts))
+	if w.hashIndex != nil {
+		var ok bool
+		if w.buf, ok = w.hashIndex.finish(w.buf); ok {
+			footer |= blockFooterHashIndexFlag
+		}
+		w.hashIndex.reset()
+	}
+	binary.LittleEndian.PutUint32(tmp4, footer)
 	w.buf = append(w.buf, tmp4...)
 	result := w.buf
 
@@ -152,7 +166,11 @@ func (w *blockWriter) finish() []byte {
 }
 
 func (w *blockWriter) estimatedSize() int {
-	return len(w.buf) + 4*(len(w.restarts)+1)
+	size := len(w.buf) + 4*(len(w.restarts)+1)
+	if w.hashIndex != nil {
+		size += w.hashIndex.estimatedSize()
+	}
+	return size
 }
 
 type blockEntry struct {
@@ -197,11 +215,15 @@ type blockIter struct {
 	// i.ptr[i.restarts:len(block)-4], while numRestarts is encoded in the last
 	// 4 bytes of the block as a uint32 (i.ptr[len(block)-4:]). i.restarts can
 	// therefore be seen as the point where data in the block ends, and a list
-	// of offsets of all restart points begins.
+	// of offsets of all restart points begins. If the block contains a hash
+	// index, it lies between the restart offsets and the last 4 bytes.
 	restarts int32
 	// Number of restart points in this block. Encoded at the end of the block
 	// as a uint32.
-	numRestarts  int32
+	numRestarts int32
+	// hashIndex contains the buckets of the block's hash index, or nil if the
+	// block has no hash index. See block_hash_index.go.
+	hashIndex    []byte
 	globalSeqNum uint64
 	ptr          unsafe.Pointer
 	data         []byte
@@ -256,12 +278,26 @@ func (i *blockIter) String() string {
 }
 
 func (i *blockIter) init(cmp Compare, block block, globalSeqNum uint64) error {
-	numRestarts := int32(binary.LittleEndian.Uint32(block[len(block)-4:]))
+	footer := binary.LittleEndian.Uint32(block[len(block)-4:])
+	numRestarts := int32(footer &^ blockFooterHashIndexFlag)
 	if numRestarts == 0 {
 		return base.CorruptionErrorf("pebble/table: invalid table (block has no restart points)")
 	}
+	end := int32(len(block)) - 4
+	i.hashIndex = nil
+	if footer&blockFooterHashIndexFlag != 0 {
+		if end < 2 {
+			return base.CorruptionErrorf("pebble/table: invalid table (bad block hash index)")
+		}
+		numBuckets := int32(binary.LittleEndian.Uint16(block[end-2:]))
+		if numBuckets == 0 || end-2-numBuckets < 4*numRestarts {
+			return base.CorruptionErrorf("pebble/table: invalid table (bad block hash index)")
+		}
+		end -= 2 + numBuckets
+		i.hashIndex = block[end : end+numBuckets]
+	}
 	i.cmp = cmp
-	i.restarts = int32(len(block)) - 4*(1+numRestarts)
+	i.restarts = end - 4*numRestarts
 	i.numRestarts = numRestarts
 	i.globalSeqNum = globalSeqNum
 	i.ptr = unsafe.Pointer(&block[0])
@@ -292,6 +328,7 @@ func (i *blockIter) invalidate() {
 	i.nextOffset = 0
 	i.restarts = 0
 	i.numRestarts = 0
+	i.hashIndex = nil
 	i.data = nil
 }
 
@@ -499,6 +536,35 @@ func (i *blockIter) cacheEntry() {
 	i.cachedBuf = append(i.cachedBuf, i.key...)
 }
 
+// seekGEUsingHashIndex positions the iterator at the first entry for the user
+// key using the block's hash index. It returns false if the hash index cannot
+// be used for the key, which is the case if the user key is not present in the
+// block or if it shares its bucket with a user key in another restart
+// interval.
+func (i *blockIter) seekGEUsingHashIndex(key []byte, ikey InternalKey) bool {
+	index := int32(hashIndexLookup(i.hashIndex, key))
+	if index >= i.numRestarts {
+		// Either hashIndexNoEntry or hashIndexCollision.
+		return false
+	}
+	// All the keys with the user key lie within the restart interval, so the
+	// first entry >= the key sought within that interval is the entry sought,
+	// provided it has the same user key.
+	i.offset = int32(binary.LittleEndian.Uint32(i.data[i.restarts+4*index:]))
+	limit := i.restarts
+	if index+1 < i.numRestarts {
+		limit = int32(binary.LittleEndian.Uint32(i.data[i.restarts+4*(index+1):]))
+	}
+	for ; i.offset < limit; i.offset = i.nextOffset {
+		i.readEntry()
+		i.decodeInternalKey(i.key)
+		if base.InternalCompare(i.cmp, i.ikey, ikey) >= 0 {
+			return i.cmp(i.ikey.UserKey, key) == 0
+		}
+	}
+	return false
+}
+
 // SeekGE implements internalIterator.SeekGE, as documented in the pebble
 // package.
 func (i *blockIter) SeekGE(key []byte) (*InternalKey, []byte) {
@@ -506,6 +572,10 @@ func (i *blockIter) SeekGE(key []byte) (*InternalKey, []byte) {
 
 	ikey := base.MakeSearchKey(key)
 
+	if i.hashIndex != nil && i.seekGEUsingHashIndex(key, ikey) {
+		return &i.ikey, i.val
+	}
+
 	// Find the index of the smallest restart point whose key is > the key
 	// sought; index will be numRestarts if there is no such restart point.
 	i.offset = 0
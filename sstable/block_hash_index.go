@@ -0,0 +1,150 @@
+// Copyright 2021 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import "encoding/binary"
+
+// A data block may contain a hash index which maps the hash of each user key
+// in the block to the index of the restart interval containing the key, so
+// that a point lookup can avoid the binary search over the restart points. The
+// format is compatible with RocksDB's data block hash index:
+//
+//	+-----------------+------------------+-----------------+-------------+
+//	| restarts        | buckets          | numBuckets      | footer      |
+//	| (4 bytes * n)   | (1 byte * m)     | (2 bytes)       | (4 bytes)   |
+//	+-----------------+------------------+-----------------+-------------+
+//
+// The high bit of the footer is set if the block contains a hash index, and
+// the remaining bits contain the number of restart points. Each bucket holds
+// the restart index of the user keys hashed to it, hashIndexNoEntry if no user
+// key was hashed to it, or hashIndexCollision if user keys in different
+// restart intervals were hashed to it.
+const (
+	hashIndexNoEntry   = 255
+	hashIndexCollision = 254
+	// hashIndexMaxRestarts is the maximum number of restart points supported
+	// by the hash index, as each bucket stores a restart index in a byte.
+	hashIndexMaxRestarts = 253
+	// hashIndexMaxBlockSize is the maximum size of a block which can contain a
+	// hash index.
+	hashIndexMaxBlockSize = 1 << 16
+	// hashIndexUtilRatio is the ratio of the number of user keys in a block to
+	// the number of buckets in its hash index.
+	hashIndexUtilRatio = 0.75
+	// hashIndexSeed is the seed for hashing user keys.
+	hashIndexSeed = 397
+
+	blockFooterHashIndexFlag = 1 << 31
+)
+
+// hashIndexHash returns the hash of a user key in a data block hash index.
+// This is the same hash function used by LevelDB and RocksDB.
+func hashIndexHash(b []byte) uint32 {
+	const m = 0xc6a4a793
+	h := uint32(hashIndexSeed) ^ uint32(uint64(uint32(len(b))*m))
+	for ; len(b) >= 4; b = b[4:] {
+		h += uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+		h *= m
+		h ^= h >> 16
+	}
+	// NB: Each remaining byte is sign-extended to match RocksDB. See
+	// bloom.hash for details.
+	switch len(b) {
+	case 3:
+		h += uint32(int8(b[2])) << 16
+		fallthrough
+	case 2:
+		h += uint32(int8(b[1])) << 8
+		fallthrough
+	case 1:
+		h += uint32(int8(b[0]))
+		h *= m
+		h ^= h >> 24
+	}
+	return h
+}
+
+type hashIndexEntry struct {
+	hash         uint32
+	restartIndex uint8
+}
+
+// hashIndexBuilder builds the hash index for a data block.
+type hashIndexBuilder struct {
+	entries []hashIndexEntry
+	buckets []byte
+	// valid is false if the block has too many restart points for a hash
+	// index.
+	valid bool
+}
+
+func (b *hashIndexBuilder) add(userKey []byte, restartIndex int) {
+	if restartIndex > hashIndexMaxRestarts {
+		b.valid = false
+		return
+	}
+	b.entries = append(b.entries, hashIndexEntry{
+		hash:         hashIndexHash(userKey),
+		restartIndex: uint8(restartIndex),
+	})
+}
+
+func (b *hashIndexBuilder) numBuckets() int {
+	n := int(float64(len(b.entries)) / hashIndexUtilRatio)
+	if n > 1<<16-1 {
+		n = 1<<16 - 1
+	}
+	// An odd number of buckets distributes the hashes better.
+	return n | 1
+}
+
+// estimatedSize returns the size of the hash index, excluding the footer.
+func (b *hashIndexBuilder) estimatedSize() int {
+	if !b.valid {
+		return 0
+	}
+	return b.numBuckets() + 2
+}
+
+// finish appends the hash index to buf, and returns false if no hash index
+// could be built.
+func (b *hashIndexBuilder) finish(buf []byte) ([]byte, bool) {
+	if !b.valid || len(b.entries) == 0 ||
+		len(buf)+b.estimatedSize()+4 > hashIndexMaxBlockSize {
+		return buf, false
+	}
+	n := b.numBuckets()
+	if cap(b.buckets) < n {
+		b.buckets = make([]byte, n)
+	}
+	b.buckets = b.buckets[:n]
+	for i := range b.buckets {
+		b.buckets[i] = hashIndexNoEntry
+	}
+	for _, e := range b.entries {
+		j := e.hash % uint32(n)
+		switch b.buckets[j] {
+		case hashIndexNoEntry:
+			b.buckets[j] = e.restartIndex
+		case e.restartIndex, hashIndexCollision:
+		default:
+			b.buckets[j] = hashIndexCollision
+		}
+	}
+	buf = append(buf, b.buckets...)
+	var tmp [2]byte
+	binary.LittleEndian.PutUint16(tmp[:], uint16(n))
+	return append(buf, tmp[:]...), true
+}
+
+func (b *hashIndexBuilder) reset() {
+	b.entries = b.entries[:0]
+	b.valid = true
+}
+
+// hashIndexLookup returns the bucket of the hash index for the user key.
+func hashIndexLookup(buckets []byte, userKey []byte) uint8 {
+	return buckets[hashIndexHash(userKey)%uint32(len(buckets))]
+}
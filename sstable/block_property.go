@@ -0,0 +1,211 @@
+// Copyright 2021 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// BlockPropertyCollector provides a hook for collecting a property for each
+// data block and for the sstable as a whole, based on the point keys and
+// values stored in the sstable. The block properties are stored alongside the
+// data block handles in the index, and the table property is stored in the
+// user properties of the sstable under the collector's name. They are used by
+// BlockPropertyFilters to skip data blocks and sstables at read time.
+//
+// A new BlockPropertyCollector is created for an sstable when the sstable is
+// being written. Range tombstones are not passed to the collector.
+type BlockPropertyCollector interface {
+	// Name returns the name of the block property collector. The name must be
+	// unique amongst the block property collectors and the table property
+	// collectors of a Writer.
+	Name() string
+
+	// Add is called with each point key added to the current data block.
+	Add(key InternalKey, value []byte) error
+
+	// FinishDataBlock is called when the current data block is finished. The
+	// property for the block should be appended to buf and returned. The
+	// collector should then reset its per-block state.
+	FinishDataBlock(buf []byte) ([]byte, error)
+
+	// FinishTable is called when all keys have been added to the sstable. The
+	// property for the sstable as a whole should be appended to buf and
+	// returned.
+	FinishTable(buf []byte) ([]byte, error)
+}
+
+// BlockPropertyFilter is used at read time to skip data blocks and sstables
+// which cannot contain keys of interest. A filter applies to the properties
+// collected by the BlockPropertyCollector with the same name. Data blocks and
+// sstables that were written without such a collector are never skipped.
+//
+// Filtering is a performance optimization, not a guarantee: a filtered
+// iterator may return keys that do not satisfy the filter from blocks that
+// intersect it, and the caller must tolerate that.
+type BlockPropertyFilter interface {
+	// Name returns the name of the block property collector whose properties
+	// the filter applies to.
+	Name() string
+
+	// Intersects returns true if the set of keys described by the property
+	// intersects the set of keys of interest to the filter.
+	Intersects(prop []byte) (bool, error)
+}
+
+// maxBlockPropertyCollectors is the maximum number of block property
+// collectors. A collector is identified in the encoded block properties by
+// its index in the Writer's list of collectors, which is stored in a single
+// byte.
+const maxBlockPropertyCollectors = math.MaxUint8 + 1
+
+// encodeBlockProperty appends the encoding of the property for the collector
+// with the specified index to buf. The encoded block properties of a data
+// block are the concatenation of the encodings for each collector.
+func encodeBlockProperty(buf []byte, index int, prop []byte) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], uint64(len(prop)))
+	buf = append(buf, byte(index))
+	buf = append(buf, tmp[:n]...)
+	return append(buf, prop...)
+}
+
+// decodeBlockHandleWithProperties returns the block handle encoded at the
+// start of an index entry value, along with the encoded block properties which
+// follow it. Only tables with block properties may have index entries with
+// trailing bytes, which are otherwise treated as corruption.
+func decodeBlockHandleWithProperties(src []byte, blockProps bool) (BlockHandle, []byte, error) {
+	bh, n := decodeBlockHandle(src)
+	if n == 0 || (!blockProps && n != len(src)) {
+		return BlockHandle{}, nil, errCorruptIndexEntry
+	}
+	return bh, src[n:], nil
+}
+
+// blockPropertiesFilterer applies a set of BlockPropertyFilters to the
+// encoded block properties of the data blocks of an sstable.
+type blockPropertiesFilterer struct {
+	filters []BlockPropertyFilter
+	// filterIndex maps the index of a collector in the sstable to the index of
+	// the filter which applies to it, or -1 if no filter applies.
+	filterIndex [maxBlockPropertyCollectors]int16
+}
+
+// newBlockPropertiesFilterer returns a filterer for the sstable with the
+// specified user properties. It returns intersects=false if the sstable as a
+// whole does not intersect the filters. The returned filterer is nil if none
+// of the filters apply to the sstable.
+func newBlockPropertiesFilterer(
+	userProps map[string]string, filters []BlockPropertyFilter,
+) (_ *blockPropertiesFilterer, intersects bool, _ error) {
+	var f *blockPropertiesFilterer
+	for i, filter := range filters {
+		prop, ok := userProps[filter.Name()]
+		if !ok {
+			// The sstable was written without the collector.
+			continue
+		}
+		if len(prop) == 0 {
+			return nil, false, base.CorruptionErrorf(
+				"pebble/table: invalid block property %q", errors.Safe(filter.Name()))
+		}
+		ok, err := filter.Intersects([]byte(prop[1:]))
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		if f == nil {
+			f = &blockPropertiesFilterer{filters: filters}
+			for j := range f.filterIndex {
+				f.filterIndex[j] = -1
+			}
+		}
+		f.filterIndex[prop[0]] = int16(i)
+	}
+	return f, true, nil
+}
+
+// intersects returns true if the data block with the specified encoded block
+// properties intersects all of the filters.
+func (f *blockPropertiesFilterer) intersects(props []byte) (bool, error) {
+	for len(props) > 0 {
+		index := props[0]
+		length, n := binary.Uvarint(props[1:])
+		if n <= 0 || uint64(len(props)-1-n) < length {
+			return false, errCorruptIndexEntry
+		}
+		prop := props[1+n : 1+n+int(length)]
+		props = props[1+n+int(length):]
+		if j := f.filterIndex[index]; j >= 0 {
+			if ok, err := f.filters[j].Intersects(prop); err != nil || !ok {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// emptyIterator is an Iterator over no keys. It is returned for an sstable
+// which as a whole does not intersect the block property filters of an
+// iterator.
+type emptyIterator struct {
+	closeHook func(i Iterator) error
+}
+
+var _ Iterator = (*emptyIterator)(nil)
+
+func (i *emptyIterator) SeekGE(key []byte) (*InternalKey, []byte) {
+	return nil, nil
+}
+
+func (i *emptyIterator) SeekPrefixGE(
+	prefix, key []byte, trySeekUsingNext bool,
+) (*InternalKey, []byte) {
+	return nil, nil
+}
+
+func (i *emptyIterator) SeekLT(key []byte) (*InternalKey, []byte) {
+	return nil, nil
+}
+
+func (i *emptyIterator) First() (*InternalKey, []byte) {
+	return nil, nil
+}
+
+func (i *emptyIterator) Last() (*InternalKey, []byte) {
+	return nil, nil
+}
+
+func (i *emptyIterator) Next() (*InternalKey, []byte) {
+	return nil, nil
+}
+
+func (i *emptyIterator) Prev() (*InternalKey, []byte) {
+	return nil, nil
+}
+
+func (i *emptyIterator) Error() error {
+	return nil
+}
+
+func (i *emptyIterator) Close() error {
+	if i.closeHook != nil {
+		return i.closeHook(i)
+	}
+	return nil
+}
+
+func (i *emptyIterator) String() string {
+	return "empty"
+}
+
+func (i *emptyIterator) SetBounds(lower, upper []byte) {}
+
+func (i *emptyIterator) SetCloseHook(fn func(i Iterator) error) {
+	i.closeHook = fn
+}
@@ -0,0 +1,323 @@
+// Copyright 2021 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+// intervalCollector is a BlockPropertyCollector which collects the interval
+// [min, max+1) of the integer values in each data block and in the table.
+type intervalCollector struct {
+	name               string
+	blockMin, blockMax uint64
+	tableMin, tableMax uint64
+}
+
+func newIntervalCollector(name string) func() BlockPropertyCollector {
+	return func() BlockPropertyCollector {
+		return &intervalCollector{
+			name:     name,
+			blockMin: math.MaxUint64,
+			tableMin: math.MaxUint64,
+		}
+	}
+}
+
+func (c *intervalCollector) Name() string {
+	return c.name
+}
+
+func (c *intervalCollector) Add(key InternalKey, value []byte) error {
+	v, err := strconv.ParseUint(string(value), 10, 64)
+	if err != nil {
+		return err
+	}
+	if v < c.blockMin {
+		c.blockMin = v
+	}
+	if v+1 > c.blockMax {
+		c.blockMax = v + 1
+	}
+	return nil
+}
+
+func (c *intervalCollector) finish(buf []byte, min, max uint64) []byte {
+	if min > max {
+		return buf
+	}
+	var tmp [2 * binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], min)
+	n += binary.PutUvarint(tmp[n:], max-min)
+	return append(buf, tmp[:n]...)
+}
+
+func (c *intervalCollector) FinishDataBlock(buf []byte) ([]byte, error) {
+	buf = c.finish(buf, c.blockMin, c.blockMax)
+	if c.blockMin < c.tableMin {
+		c.tableMin = c.blockMin
+	}
+	if c.blockMax > c.tableMax {
+		c.tableMax = c.blockMax
+	}
+	c.blockMin, c.blockMax = math.MaxUint64, 0
+	return buf, nil
+}
+
+func (c *intervalCollector) FinishTable(buf []byte) ([]byte, error) {
+	return c.finish(buf, c.tableMin, c.tableMax), nil
+}
+
+// intervalFilter is a BlockPropertyFilter which intersects the intervals
+// collected by an intervalCollector with [lower, upper).
+type intervalFilter struct {
+	name         string
+	lower, upper uint64
+}
+
+func (f intervalFilter) Name() string {
+	return f.name
+}
+
+func (f intervalFilter) Intersects(prop []byte) (bool, error) {
+	if len(prop) == 0 {
+		return true, nil
+	}
+	min, n := binary.Uvarint(prop)
+	if n <= 0 {
+		return false, errors.New("invalid interval")
+	}
+	width, m := binary.Uvarint(prop[n:])
+	if m <= 0 || n+m != len(prop) {
+		return false, errors.New("invalid interval")
+	}
+	return min < f.upper && f.lower < min+width, nil
+}
+
+func TestBlockPropertyFilters(t *testing.T) {
+	// Each key's value increases by one every 100 keys, so that any interval
+	// of values is confined to a contiguous range of data blocks.
+	const numKeys = 2000
+	key := func(i int) []byte { return []byte(fmt.Sprintf("%05d", i)) }
+	value := func(i int) uint64 { return uint64(i / 100) }
+
+	for _, indexBlockSize := range []int{1 << 20, 64} {
+		t.Run(fmt.Sprintf("index-block-size=%d", indexBlockSize), func(t *testing.T) {
+			mem := vfs.NewMem()
+			f, err := mem.Create("test")
+			require.NoError(t, err)
+			w := NewWriter(f, WriterOptions{
+				TableFormat:    TableFormatPebblev1,
+				BlockSize:      256,
+				IndexBlockSize: indexBlockSize,
+				BlockPropertyCollectors: []func() BlockPropertyCollector{
+					newIntervalCollector("unused"),
+					newIntervalCollector("interval"),
+				},
+			})
+			for i := 0; i < numKeys; i++ {
+				require.NoError(t, w.Set(key(i), []byte(strconv.FormatUint(value(i), 10))))
+			}
+			require.NoError(t, w.Close())
+
+			f, err = mem.Open("test")
+			require.NoError(t, err)
+			r, err := NewReader(f, ReaderOptions{})
+			require.NoError(t, err)
+			defer r.Close()
+			require.Equal(t, indexBlockSize == 64, r.Properties.IndexPartitions > 0)
+
+			// Data blocks with properties must still be readable without filters.
+			l, err := r.Layout()
+			require.NoError(t, err)
+			require.Less(t, 10, len(l.Data))
+			size, err := r.EstimateDiskUsage(key(0), key(numKeys-1))
+			require.NoError(t, err)
+			require.Less(t, uint64(0), size)
+
+			// A filter for values beyond the table yields an empty iterator.
+			iter, err := r.NewIterWithOptions(&IterOptions{
+				BlockPropertyFilters: []BlockPropertyFilter{
+					intervalFilter{name: "interval", lower: 100, upper: 200},
+				},
+			})
+			require.NoError(t, err)
+			k, _ := iter.First()
+			require.Nil(t, k)
+			require.NoError(t, iter.Close())
+
+			// A filter for a collector not used by the table is ignored.
+			iter, err = r.NewIterWithOptions(&IterOptions{
+				BlockPropertyFilters: []BlockPropertyFilter{
+					intervalFilter{name: "missing", lower: 100, upper: 200},
+				},
+			})
+			require.NoError(t, err)
+			var n int
+			for k, _ := iter.First(); k != nil; k, _ = iter.Next() {
+				n++
+			}
+			require.Equal(t, numKeys, n)
+			require.NoError(t, iter.Close())
+
+			for _, filter := range []intervalFilter{
+				{lower: 0, upper: 1},
+				{lower: 5, upper: 7},
+				{lower: 19, upper: 20},
+			} {
+				filter.name = "interval"
+				iter, err := r.NewIterWithOptions(&IterOptions{
+					BlockPropertyFilters: []BlockPropertyFilter{filter},
+				})
+				require.NoError(t, err)
+
+				// Every matching key is returned, and most others are skipped.
+				check := func(keys [][]byte) {
+					seen := make(map[string]bool)
+					for _, k := range keys {
+						seen[string(k)] = true
+					}
+					for i := 0; i < numKeys; i++ {
+						if v := value(i); filter.lower <= v && v < filter.upper {
+							require.True(t, seen[string(key(i))], "%s", key(i))
+						}
+					}
+					require.Less(t, len(keys), numKeys/2)
+				}
+
+				var forward [][]byte
+				for k, _ := iter.First(); k != nil; k, _ = iter.Next() {
+					forward = append(forward, append([]byte(nil), k.UserKey...))
+				}
+				require.NoError(t, iter.Error())
+				check(forward)
+
+				var backward [][]byte
+				for k, _ := iter.Last(); k != nil; k, _ = iter.Prev() {
+					backward = append([][]byte{append([]byte(nil), k.UserKey...)}, backward...)
+				}
+				require.NoError(t, iter.Error())
+				require.Equal(t, forward, backward)
+
+				// Seeks land on the first returned key at or after (resp. last
+				// returned key before) the seek key.
+				for i := 0; i < numKeys; i += 37 {
+					j := 0
+					for j < len(forward) && string(forward[j]) < string(key(i)) {
+						j++
+					}
+					k, _ := iter.SeekGE(key(i))
+					if j == len(forward) {
+						require.Nil(t, k)
+					} else {
+						require.NotNil(t, k)
+						require.Equal(t, forward[j], k.UserKey)
+					}
+					k, _ = iter.SeekLT(key(i))
+					if j == 0 {
+						require.Nil(t, k)
+					} else {
+						require.NotNil(t, k)
+						require.Equal(t, forward[j-1], k.UserKey)
+					}
+				}
+				require.NoError(t, iter.Close())
+			}
+		})
+	}
+}
+
+func TestBlockPropertyCollectorErrors(t *testing.T) {
+	mem := vfs.NewMem()
+	f, err := mem.Create("test")
+	require.NoError(t, err)
+	w := NewWriter(f, WriterOptions{
+		BlockPropertyCollectors: []func() BlockPropertyCollector{
+			newIntervalCollector("interval"),
+		},
+	})
+	require.Regexp(t, `require TableFormatPebblev1`, w.Close())
+
+	f, err = mem.Create("test")
+	require.NoError(t, err)
+	w = NewWriter(f, WriterOptions{
+		TableFormat: TableFormatPebblev1,
+		BlockPropertyCollectors: []func() BlockPropertyCollector{
+			newIntervalCollector("interval"),
+		},
+	})
+	require.Regexp(t, `invalid syntax`, w.Set([]byte("a"), []byte("not-an-integer")))
+	require.NoError(t, w.Close())
+
+	collectors := make([]func() BlockPropertyCollector, maxBlockPropertyCollectors+1)
+	for i := range collectors {
+		collectors[i] = newIntervalCollector(fmt.Sprint(i))
+	}
+	f, err = mem.Create("test")
+	require.NoError(t, err)
+	w = NewWriter(f, WriterOptions{
+		TableFormat:             TableFormatPebblev1,
+		BlockPropertyCollectors: collectors,
+	})
+	require.Regexp(t, `too many block property collectors`, w.Close())
+}
+
+func TestBlockPropertiesRequirePebbleFormat(t *testing.T) {
+	mem := vfs.NewMem()
+	f, err := mem.Create("test")
+	require.NoError(t, err)
+	w := NewWriter(f, WriterOptions{
+		TableFormat: TableFormatPebblev1,
+		BlockSize:   256,
+		BlockPropertyCollectors: []func() BlockPropertyCollector{
+			newIntervalCollector("interval"),
+		},
+	})
+	for i := 0; i < 100; i++ {
+		require.NoError(t, w.Set([]byte(fmt.Sprintf("%05d", i)), []byte(strconv.Itoa(i))))
+	}
+	require.NoError(t, w.Close())
+
+	// Stamp the table with the RocksDB magic number and footer version. The
+	// block properties in its index entries must now be reported as corruption.
+	f, err = mem.Open("test")
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	binary.LittleEndian.PutUint32(data[len(data)-12:], rocksDBFormatVersion2)
+	copy(data[len(data)-len(rocksDBMagic):], rocksDBMagic)
+	f, err = mem.Create("rocksdb")
+	require.NoError(t, err)
+	_, err = f.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	f, err = mem.Open("rocksdb")
+	require.NoError(t, err)
+	r, err := NewReader(f, ReaderOptions{})
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = r.Layout()
+	require.Equal(t, errCorruptIndexEntry, err)
+	_, err = r.EstimateDiskUsage([]byte("00000"), []byte("00099"))
+	require.Equal(t, errCorruptIndexEntry, err)
+	iter, err := r.NewIter(nil, nil)
+	require.NoError(t, err)
+	k, _ := iter.First()
+	require.Nil(t, k)
+	require.Equal(t, errCorruptIndexEntry, iter.Error())
+	require.Equal(t, errCorruptIndexEntry, iter.Close())
+}
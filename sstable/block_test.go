@@ -310,45 +310,130 @@ func TestBlockIterReverseDirections(t *testing.T) {
 	}
 }
 
+func TestBlockHashIndex(t *testing.T) {
+	for _, restartInterval := range []int{1, 4, 16} {
+		t.Run(fmt.Sprintf("restart=%d", restartInterval), func(t *testing.T) {
+			// Write every other user key, with several versions of some user keys
+			// so that they span restart intervals.
+			plain := &blockWriter{restartInterval: restartInterval}
+			hashed := &blockWriter{
+				restartInterval: restartInterval,
+				hashIndex:       &hashIndexBuilder{valid: true},
+			}
+			for i := 0; i < 200; i += 2 {
+				for v := i % 3; v >= 0; v-- {
+					key := base.MakeInternalKey([]byte(fmt.Sprintf("%04d", i)), uint64(v), InternalKeyKindSet)
+					value := []byte(fmt.Sprint(i, v))
+					plain.add(key, value)
+					hashed.add(key, value)
+				}
+			}
+			plainIter, err := newBlockIter(bytes.Compare, plain.finish())
+			require.NoError(t, err)
+			require.Nil(t, plainIter.hashIndex)
+			hashedIter, err := newBlockIter(bytes.Compare, hashed.finish())
+			require.NoError(t, err)
+			require.NotNil(t, hashedIter.hashIndex)
+			require.Equal(t, plainIter.numRestarts, hashedIter.numRestarts)
+
+			// SeekGE returns the same result with and without the hash index, for
+			// both present and absent user keys.
+			var hits int
+			for i := 0; i <= 200; i++ {
+				key := []byte(fmt.Sprintf("%04d", i))
+				if hashedIter.seekGEUsingHashIndex(key, base.MakeSearchKey(key)) {
+					hits++
+				}
+				expectedKey, expectedValue := plainIter.SeekGE(key)
+				k, v := hashedIter.SeekGE(key)
+				if expectedKey == nil {
+					require.Nil(t, k)
+					continue
+				}
+				require.NotNil(t, k)
+				require.Equal(t, *expectedKey, *k)
+				require.Equal(t, expectedValue, v)
+
+				// The iterator is positioned for subsequent iteration.
+				expectedKey, _ = plainIter.Next()
+				k, _ = hashedIter.Next()
+				if expectedKey == nil {
+					require.Nil(t, k)
+				} else {
+					require.Equal(t, *expectedKey, *k)
+				}
+			}
+			// User keys with versions in different restart intervals, and user
+			// keys whose buckets collide, cannot use the hash index.
+			require.Less(t, 10, hits)
+		})
+	}
+
+	// A block with more restart points than supported by the hash index is
+	// written without one.
+	w := &blockWriter{restartInterval: 1, hashIndex: &hashIndexBuilder{valid: true}}
+	for i := 0; i <= hashIndexMaxRestarts+1; i++ {
+		w.add(InternalKey{UserKey: []byte(fmt.Sprintf("%04d", i))}, nil)
+	}
+	it, err := newBlockIter(bytes.Compare, w.finish())
+	require.NoError(t, err)
+	require.Nil(t, it.hashIndex)
+	k, _ := it.SeekGE([]byte("0100"))
+	require.Equal(t, []byte("0100"), k.UserKey)
+
+	// The hash index is reset between blocks.
+	w.add(InternalKey{UserKey: []byte("a")}, nil)
+	it, err = newBlockIter(bytes.Compare, w.finish())
+	require.NoError(t, err)
+	require.NotNil(t, it.hashIndex)
+	k, _ = it.SeekGE([]byte("a"))
+	require.Equal(t, []byte("a"), k.UserKey)
+}
+
 func BenchmarkBlockIterSeekGE(b *testing.B) {
 	const blockSize = 32 << 10
 
 	for _, restartInterval := range []int{16} {
-		b.Run(fmt.Sprintf("restart=%d", restartInterval),
-			func(b *testing.B) {
-				w := &blockWriter{
-					restartInterval: restartInterval,
-				}
+		for _, hashIndex := range []bool{false, true} {
+			b.Run(fmt.Sprintf("restart=%d/hash-index=%t", restartInterval, hashIndex),
+				func(b *testing.B) {
+					w := &blockWriter{
+						restartInterval: restartInterval,
+					}
+					if hashIndex {
+						w.hashIndex = &hashIndexBuilder{valid: true}
+					}
 
-				var ikey InternalKey
-				var keys [][]byte
-				for i := 0; w.estimatedSize() < blockSize; i++ {
-					key := []byte(fmt.Sprintf("%05d", i))
-					keys = append(keys, key)
-					ikey.UserKey = key
-					w.add(ikey, nil)
-				}
+					var ikey InternalKey
+					var keys [][]byte
+					for i := 0; w.estimatedSize() < blockSize; i++ {
+						key := []byte(fmt.Sprintf("%05d", i))
+						keys = append(keys, key)
+						ikey.UserKey = key
+						w.add(ikey, nil)
+					}
 
-				it, err := newBlockIter(bytes.Compare, w.finish())
-				if err != nil {
-					b.Fatal(err)
-				}
-				rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+					it, err := newBlockIter(bytes.Compare, w.finish())
+					if err != nil {
+						b.Fatal(err)
+					}
+					rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
 
-				b.ResetTimer()
-				for i := 0; i < b.N; i++ {
-					k := keys[rng.Intn(len(keys))]
-					it.SeekGE(k)
-					if testing.Verbose() {
-						if !it.Valid() {
-							b.Fatal("expected to find key")
-						}
-						if !bytes.Equal(k, it.Key().UserKey) {
-							b.Fatalf("expected %s, but found %s", k, it.Key().UserKey)
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						k := keys[rng.Intn(len(keys))]
+						it.SeekGE(k)
+						if testing.Verbose() {
+							if !it.Valid() {
+								b.Fatal("expected to find key")
+							}
+							if !bytes.Equal(k, it.Key().UserKey) {
+								b.Fatalf("expected %s, but found %s", k, it.Key().UserKey)
+							}
 						}
 					}
-				}
-			})
+				})
+		}
 	}
 }
 
@@ -4,7 +4,22 @@
 
 package sstable
 
-import "sync/atomic"
+import (
+	"encoding/binary"
+	"sync/atomic"
+)
+
+// The metaindex key prefixes for table filters. The filter policy name is
+// appended to the prefix.
+const (
+	fullFilterMetaPrefix = "fullfilter."
+	// partitionedFilterMetaPrefix identifies a filter which has been split into
+	// partitions (see partitionedFilterWriter). The filter block is a raw block
+	// mapping the last key of each partition to the handle of the partition.
+	// The layout differs from RocksDB's partitioned filters, so a distinct
+	// prefix is used.
+	partitionedFilterMetaPrefix = "pebble.partitionedfilter."
+)
 
 // FilterMetrics holds metrics for the filter policy.
 type FilterMetrics struct {
@@ -41,6 +56,9 @@ type filterWriter interface {
 type tableFilterReader struct {
 	policy  FilterPolicy
 	metrics *FilterMetrics
+	// partitioned is true if the filter block is the top-level index of a
+	// partitioned filter.
+	partitioned bool
 }
 
 func newTableFilterReader(policy FilterPolicy) *tableFilterReader {
@@ -51,7 +69,11 @@ func newTableFilterReader(policy FilterPolicy) *tableFilterReader {
 }
 
 func (f *tableFilterReader) mayContain(data, key []byte) bool {
-	mayContain := f.policy.MayContain(TableFilter, data, key)
+	return f.record(f.policy.MayContain(TableFilter, data, key))
+}
+
+// record updates the filter metrics with the result of a filter check.
+func (f *tableFilterReader) record(mayContain bool) bool {
 	if mayContain {
 		atomic.AddInt64(&f.metrics.Misses, 1)
 	} else {
@@ -87,9 +109,103 @@ func (f *tableFilterWriter) finish() ([]byte, error) {
 }
 
 func (f *tableFilterWriter) metaName() string {
-	return "fullfilter." + f.policy.Name()
+	return fullFilterMetaPrefix + f.policy.Name()
 }
 
 func (f *tableFilterWriter) policyName() string {
 	return f.policy.Name()
 }
+
+// filterPartition is a finished partition of a partitioned filter.
+type filterPartition struct {
+	// lastKey is the largest key added to the partition.
+	lastKey []byte
+	data    []byte
+}
+
+// partitionedFilterWriter builds a table-level filter which is split into
+// partitions of roughly blockSize bytes. Each partition is a full table filter
+// over a contiguous range of filter keys (user keys, or prefixes if a prefix
+// extractor is configured). Partitions are only cut between distinct filter
+// keys, so every filter key is contained in exactly one partition: the first
+// partition whose last key is greater than or equal to it.
+//
+// If the filter does not exceed blockSize a single unpartitioned filter is
+// written, exactly as tableFilterWriter would.
+type partitionedFilterWriter struct {
+	tableFilterWriter
+	compare Compare
+	// keysPerPartition is the number of keys after which a partition is
+	// finished. It is estimated from the size of a filter produced by the policy
+	// for a sample of keys.
+	keysPerPartition int
+	// lastKey is the most recently added key.
+	lastKey    []byte
+	partitions []filterPartition
+}
+
+// filterSampleKeys is the number of keys used to estimate the size of a filter
+// per key.
+const filterSampleKeys = 1024
+
+func newPartitionedFilterWriter(
+	policy FilterPolicy, compare Compare, blockSize int,
+) *partitionedFilterWriter {
+	f := &partitionedFilterWriter{
+		tableFilterWriter: *newTableFilterWriter(policy),
+		compare:           compare,
+	}
+	var key [4]byte
+	for i := 0; i < filterSampleKeys; i++ {
+		binary.BigEndian.PutUint32(key[:], uint32(i))
+		f.writer.AddKey(key[:])
+	}
+	sampleSize := len(f.writer.Finish(nil))
+	f.keysPerPartition = filterSampleKeys
+	if sampleSize > 0 {
+		f.keysPerPartition = int(int64(blockSize) * filterSampleKeys / int64(sampleSize))
+	}
+	if f.keysPerPartition < 1 {
+		f.keysPerPartition = 1
+	}
+	return f
+}
+
+func (f *partitionedFilterWriter) addKey(key []byte) {
+	if f.count >= f.keysPerPartition && f.compare(f.lastKey, key) != 0 {
+		f.finishPartition()
+	}
+	f.tableFilterWriter.addKey(key)
+	f.lastKey = append(f.lastKey[:0], key...)
+}
+
+func (f *partitionedFilterWriter) finishPartition() {
+	f.partitions = append(f.partitions, filterPartition{
+		lastKey: append([]byte(nil), f.lastKey...),
+		data:    f.writer.Finish(nil),
+	})
+	f.count = 0
+}
+
+// partitioned returns true if the filter has been split into multiple
+// partitions. finishPartitions must be used to finish a partitioned filter and
+// finish otherwise.
+func (f *partitionedFilterWriter) partitioned() bool {
+	return len(f.partitions) > 0
+}
+
+// finishPartitions finishes the last partition and returns all of the
+// partitions of the filter.
+func (f *partitionedFilterWriter) finishPartitions() []filterPartition {
+	if f.count > 0 {
+		f.finishPartition()
+	}
+	return f.partitions
+}
+
+func (f *partitionedFilterWriter) metaName() string {
+	if f.partitioned() {
+		return partitionedFilterMetaPrefix + f.policy.Name()
+	}
+	return f.tableFilterWriter.metaName()
+}
@@ -5,6 +5,8 @@
 package sstable
 
 import (
+	"context"
+
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/cache"
 )
@@ -57,9 +59,16 @@ type TableFormat uint32
 // The available table formats. Note that these values are not (and should not)
 // be serialized to disk. TableFormatRocksDBv2 is the default if otherwise
 // unspecified.
+//
+// TableFormatPebblev1 tables have the same structure as TableFormatRocksDBv2
+// tables, but are identified by a Pebble-specific magic number and format
+// version in the footer. They may use features which RocksDB and older
+// versions of Pebble cannot read, such as block properties, and are rejected
+// by such readers rather than misinterpreted.
 const (
 	TableFormatRocksDBv2 TableFormat = iota
 	TableFormatLevelDB
+	TableFormatPebblev1
 )
 
 // ChecksumType specifies the checksum used for blocks. The default is CRC32c.
@@ -74,6 +83,21 @@ const (
 	ChecksumTypeXXHash64
 )
 
+func (c ChecksumType) String() string {
+	switch c {
+	case ChecksumTypeCRC32c:
+		return "CRC32c"
+	case ChecksumTypeNone:
+		return "None"
+	case ChecksumTypeXXHash:
+		return "XXHash"
+	case ChecksumTypeXXHash64:
+		return "XXHash64"
+	default:
+		return "Unknown"
+	}
+}
+
 // TablePropertyCollector provides a hook for collecting user-defined
 // properties based on the keys and values stored in an sstable. A new
 // TablePropertyCollector is created for an sstable when the sstable is being
@@ -131,6 +155,35 @@ func (o ReaderOptions) ensureDefaults() ReaderOptions {
 	return o
 }
 
+// IterOptions holds the optional parameters used to create an iterator over
+// the contents of an sstable with Reader.NewIterWithOptions.
+type IterOptions struct {
+	// LowerBound specifies the smallest key (inclusive) that the iterator will
+	// return during iteration. A nil LowerBound indicates that there is no
+	// lower bound.
+	LowerBound []byte
+
+	// UpperBound specifies the largest key (exclusive) that the iterator will
+	// return during iteration. A nil UpperBound indicates that there is no
+	// upper bound.
+	UpperBound []byte
+
+	// BlockPropertyFilters are used to skip data blocks which do not intersect
+	// the filters. If the table as a whole does not intersect the filters, an
+	// empty iterator is returned.
+	BlockPropertyFilters []BlockPropertyFilter
+
+	// Stats, if non-nil, accumulates the blocks loaded by the iterator.
+	Stats *base.InternalIteratorStats
+
+	// Context, if non-nil, stops the iterator with the context's error if the
+	// context is canceled or its deadline is exceeded before a block is loaded.
+	Context context.Context
+
+	// Readahead configures the readahead of data blocks.
+	Readahead ReadaheadConfig
+}
+
 // WriterOptions holds the parameters used to control building an sstable.
 type WriterOptions struct {
 	// BlockRestartInterval is the number of keys between restart points
@@ -168,6 +221,26 @@ type WriterOptions struct {
 	// The default value (DefaultCompression) uses snappy compression.
 	Compression Compression
 
+	// DataBlockHashIndex enables a hash index in each data block, mapping user
+	// keys to the restart interval containing them, which lets point lookups
+	// skip the binary search over the restart points of the block. Blocks with
+	// more than 253 restart points or larger than 64KB are written without a
+	// hash index. The hash index requires a Comparer for which equal user keys
+	// are byte-wise equal, and TableFormatPebblev1.
+	//
+	// The default value is false.
+	DataBlockHashIndex bool
+
+	// FilterBlockSize is the target size in bytes of each partition of a
+	// table-level filter. When the filter for an sstable is larger than this
+	// target, it is split into partitions which are loaded on demand through
+	// the block cache, along with a small top-level block which locates the
+	// partition for a key. Partitioning avoids needing the entire filter of a
+	// large sstable to be resident. Zero disables partitioning.
+	//
+	// The default value is 0.
+	FilterBlockSize int
+
 	// FilterPolicy defines a filter algorithm (such as a Bloom filter) that can
 	// reduce disk reads for Get calls.
 	//
@@ -200,12 +273,27 @@ type WriterOptions struct {
 	// with the value stored in the sstable when it was written.
 	MergerName string
 
+	// Parallelism is the maximum number of data blocks which are compressed
+	// concurrently with the addition of keys to the Writer. Data blocks are
+	// still written to the file in order. Values of 0 and 1 compress each
+	// data block synchronously when it is finished.
+	//
+	// The default value is 0.
+	Parallelism int
+
 	// TableFormat specifies the format version for writing sstables. The default
 	// is TableFormatRocksDBv2 which creates RocksDB compatible sstables. Use
 	// TableFormatLevelDB to create LevelDB compatible sstable which can be used
-	// by a wider range of tools and libraries.
+	// by a wider range of tools and libraries. TableFormatPebblev1 is required
+	// to use BlockPropertyCollectors or DataBlockHashIndex.
 	TableFormat TableFormat
 
+	// BlockPropertyCollectors is a list of BlockPropertyCollector creation
+	// functions. A new BlockPropertyCollector is created for each sstable
+	// built and lives for the lifetime of writing that table. At most 256
+	// collectors may be specified.
+	BlockPropertyCollectors []func() BlockPropertyCollector
+
 	// TablePropertyCollectors is a list of TablePropertyCollector creation
 	// functions. A new TablePropertyCollector is created for each sstable built
 	// and lives for the lifetime of the table.
@@ -6,6 +6,7 @@ package sstable
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -88,6 +89,13 @@ type singleLevelIterator struct {
 	dataBH     BlockHandle
 	err        error
 	closeHook  func(i Iterator) error
+	// bpfs, if non-nil, is used to skip data blocks which do not intersect the
+	// iterator's block property filters.
+	bpfs *blockPropertiesFilterer
+	// stats, if non-nil, accumulates the blocks loaded by the iterator.
+	stats *base.InternalIteratorStats
+	// ctx, if non-nil, is checked for cancellation before loading a block.
+	ctx context.Context
 
 	// boundsCmp and positionedUsingLatestBounds are for optimizing iteration
 	// that uses multiple adjacent bounds. The seek after setting a new bound
@@ -228,7 +236,7 @@ func (i *singleLevelIterator) init(r *Reader, lower, upper []byte) error {
 		_ = i.index.Close()
 		return err
 	}
-	i.dataRS.size = initialReadaheadSize
+	i.dataRS.init(ReadaheadConfig{})
 	return nil
 }
 
@@ -276,7 +284,8 @@ func (i *singleLevelIterator) initBounds() {
 
 // loadBlock loads the block at the current index position and leaves i.data
 // unpositioned. If unsuccessful, it sets i.err to any error encountered, which
-// may be nil if we have simply exhausted the entire table.
+// may be nil if we have simply exhausted the entire table or if the block does
+// not intersect the iterator's block property filters.
 func (i *singleLevelIterator) loadBlock() bool {
 	// Ensure the data block iterator is invalidated even if loading of the block
 	// fails.
@@ -285,14 +294,24 @@ func (i *singleLevelIterator) loadBlock() bool {
 		return false
 	}
 	// Load the next block.
-	v := i.index.Value()
-	var n int
-	i.dataBH, n = decodeBlockHandle(v)
-	if n == 0 || n != len(v) {
-		i.err = errCorruptIndexEntry
+	var props []byte
+	i.dataBH, props, i.err = decodeBlockHandleWithProperties(i.index.Value(), i.reader.blockProps)
+	if i.err != nil {
 		return false
 	}
-	block, err := i.reader.readBlock(i.dataBH, nil /* transform */, &i.dataRS)
+	if i.bpfs != nil {
+		var intersects bool
+		intersects, i.err = i.bpfs.intersects(props)
+		if i.err != nil || !intersects {
+			return false
+		}
+	}
+	if i.ctx != nil {
+		if i.err = i.ctx.Err(); i.err != nil {
+			return false
+		}
+	}
+	block, err := i.reader.readBlock(i.dataBH, nil /* transform */, &i.dataRS, i.stats)
 	if err != nil {
 		i.err = err
 		return false
@@ -467,7 +486,11 @@ func (i *singleLevelIterator) seekGEHelper(
 			return nil, nil
 		}
 		if !i.loadBlock() {
-			return nil, nil
+			if i.err != nil {
+				return nil, nil
+			}
+			// The block does not intersect the block property filters.
+			return i.skipForward()
 		}
 	}
 	if !dontSeekWithinBlock {
@@ -504,14 +527,12 @@ func (i *singleLevelIterator) seekPrefixGE(
 		}
 		i.lastBloomFilterMatched = false
 		// Check prefix bloom filter.
-		var dataH cache.Handle
-		dataH, i.err = i.reader.readFilter()
+		var mayContain bool
+		mayContain, i.err = i.reader.filterMayContain(prefix)
 		if i.err != nil {
 			i.data.invalidate()
 			return nil, nil
 		}
-		mayContain := i.reader.tableFilter.mayContain(dataH.Get(), prefix)
-		dataH.Release()
 		if !mayContain {
 			// This invalidation may not be necessary for correctness, and may
 			// be a place to optimize later by reusing the already loaded
@@ -575,7 +596,11 @@ func (i *singleLevelIterator) SeekLT(key []byte) (*InternalKey, []byte) {
 			i.index.Last()
 		}
 		if !i.loadBlock() {
-			return nil, nil
+			if i.err != nil {
+				return nil, nil
+			}
+			// The block does not intersect the block property filters.
+			return i.skipBackward()
 		}
 	}
 	if !dontSeekWithinBlock {
@@ -628,7 +653,11 @@ func (i *singleLevelIterator) firstInternal() (*InternalKey, []byte) {
 		return nil, nil
 	}
 	if !i.loadBlock() {
-		return nil, nil
+		if i.err != nil {
+			return nil, nil
+		}
+		// The block does not intersect the block property filters.
+		return i.skipForward()
 	}
 	if ikey, val := i.data.First(); ikey != nil {
 		if i.blockUpper != nil && i.cmp(ikey.UserKey, i.blockUpper) >= 0 {
@@ -667,7 +696,11 @@ func (i *singleLevelIterator) lastInternal() (*InternalKey, []byte) {
 		return nil, nil
 	}
 	if !i.loadBlock() {
-		return nil, nil
+		if i.err != nil {
+			return nil, nil
+		}
+		// The block does not intersect the block property filters.
+		return i.skipBackward()
 	}
 	if ikey, val := i.data.Last(); ikey != nil {
 		if i.blockLower != nil && i.cmp(ikey.UserKey, i.blockLower) < 0 {
@@ -876,8 +909,15 @@ func (i *compactionIterator) String() string {
 	return i.reader.fileNum.String()
 }
 
+// SeekGE implements internalIterator.SeekGE, as documented in the pebble
+// package. It is used to position the iterator at the start of a
+// subcompaction's key range. The bytes skipped by the seek are not counted as
+// iterated.
 func (i *compactionIterator) SeekGE(key []byte) (*InternalKey, []byte) {
-	panic("pebble: SeekGE unimplemented")
+	i.err = nil // clear cached iteration error
+	ikey, val := i.singleLevelIterator.SeekGE(key)
+	i.prevOffset = i.recordOffset()
+	return ikey, val
 }
 
 func (i *compactionIterator) SeekPrefixGE(
@@ -962,7 +1002,12 @@ func (i *twoLevelIterator) loadIndex() bool {
 		i.err = base.CorruptionErrorf("pebble/table: corrupt top level index entry")
 		return false
 	}
-	indexBlock, err := i.reader.readBlock(h, nil /* transform */, nil /* readaheadState */)
+	if i.ctx != nil {
+		if i.err = i.ctx.Err(); i.err != nil {
+			return false
+		}
+	}
+	indexBlock, err := i.reader.readBlock(h, i.reader.indexTransform, nil /* readaheadState */, i.stats)
 	if err != nil {
 		i.err = err
 		return false
@@ -1047,14 +1092,12 @@ func (i *twoLevelIterator) SeekPrefixGE(
 			trySeekUsingNext = false
 		}
 		i.lastBloomFilterMatched = false
-		var dataH cache.Handle
-		dataH, i.err = i.reader.readFilter()
+		var mayContain bool
+		mayContain, i.err = i.reader.filterMayContain(prefix)
 		if i.err != nil {
 			i.data.invalidate()
 			return nil, nil
 		}
-		mayContain := i.reader.tableFilter.mayContain(dataH.Get(), prefix)
-		dataH.Release()
 		if !mayContain {
 			// This invalidation may not be necessary for correctness, and may
 			// be a place to optimize later by reusing the already loaded
@@ -1139,7 +1182,10 @@ func (i *twoLevelIterator) SeekLT(key []byte) (*InternalKey, []byte) {
 			return nil, nil
 		}
 
-		return i.singleLevelIterator.lastInternal()
+		if ikey, val := i.singleLevelIterator.lastInternal(); ikey != nil {
+			return ikey, val
+		}
+		return i.skipBackward()
 	}
 
 	if !i.loadIndex() {
@@ -1325,8 +1371,15 @@ func (i *twoLevelCompactionIterator) Close() error {
 	return i.twoLevelIterator.Close()
 }
 
+// SeekGE implements internalIterator.SeekGE, as documented in the pebble
+// package. It is used to position the iterator at the start of a
+// subcompaction's key range. The bytes skipped by the seek are not counted as
+// iterated.
 func (i *twoLevelCompactionIterator) SeekGE(key []byte) (*InternalKey, []byte) {
-	panic("pebble: SeekGE unimplemented")
+	i.err = nil // clear cached iteration error
+	ikey, val := i.twoLevelIterator.SeekGE(key)
+	i.prevOffset = i.recordOffset()
+	return ikey, val
 }
 
 func (i *twoLevelCompactionIterator) SeekPrefixGE(
@@ -1389,13 +1442,35 @@ func (i *twoLevelCompactionIterator) skipForward(
 
 type blockTransform func([]byte) ([]byte, error)
 
+// ReadaheadConfig configures the readahead of data blocks performed by an
+// iterator. Once an iterator has read a number of data blocks sequentially,
+// it prefetches the data following the blocks it reads. The size of the
+// prefetched data starts at InitialSize and doubles with each subsequent
+// sequential read until it reaches MaxSize, after which the iterator defers
+// to OS-level readahead.
+type ReadaheadConfig struct {
+	// InitialSize is the size of the first prefetch. If zero, it defaults to
+	// 64KB. It is capped at MaxSize.
+	InitialSize int64
+	// MaxSize is the maximum size of a prefetch. If zero, it defaults to 256KB.
+	MaxSize int64
+	// Disable disables readahead, which avoids wasted I/O for iterators which
+	// access tables randomly.
+	Disable bool
+}
+
 // readaheadState contains state variables related to readahead. Updated on
 // file reads.
 type readaheadState struct {
+	// initialSize, maxSize and disabled are the readahead configuration. See
+	// ReadaheadConfig.
+	initialSize int64
+	maxSize     int64
+	disabled    bool
 	// Number of sequential reads.
 	numReads int64
 	// Size issued to the next call to Prefetch. Starts at or above
-	// initialReadaheadSize and grows exponentially until maxReadaheadSize.
+	// initialSize and grows exponentially until maxSize.
 	size int64
 	// prevSize is the size used in the last Prefetch call.
 	prevSize int64
@@ -1413,25 +1488,41 @@ type readaheadState struct {
 	sequentialFile vfs.File
 }
 
+func (rs *readaheadState) init(config ReadaheadConfig) {
+	rs.initialSize = config.InitialSize
+	if rs.initialSize <= 0 {
+		rs.initialSize = initialReadaheadSize
+	}
+	rs.maxSize = config.MaxSize
+	if rs.maxSize <= 0 {
+		rs.maxSize = maxReadaheadSize
+	}
+	if rs.initialSize > rs.maxSize {
+		rs.initialSize = rs.maxSize
+	}
+	rs.disabled = config.Disable
+	rs.size = rs.initialSize
+}
+
 func (rs *readaheadState) recordCacheHit(offset, blockLength int64) {
 	currentReadEnd := offset + blockLength
-	if rs.sequentialFile != nil {
+	if rs.disabled || rs.sequentialFile != nil {
 		// Using OS-level readahead instead, so do nothing.
 		return
 	}
 	if rs.numReads >= minFileReadsForReadahead {
-		if currentReadEnd >= rs.limit && offset <= rs.limit+maxReadaheadSize {
+		if currentReadEnd >= rs.limit && offset <= rs.limit+rs.maxSize {
 			// This is a read that would have resulted in a readahead, had it
 			// not been a cache hit.
 			rs.limit = currentReadEnd
 			return
 		}
-		if currentReadEnd < rs.limit-rs.prevSize || offset > rs.limit+maxReadaheadSize {
+		if currentReadEnd < rs.limit-rs.prevSize || offset > rs.limit+rs.maxSize {
 			// We read too far away from rs.limit to benefit from readahead in
 			// any scenario. Reset all variables.
 			rs.numReads = 1
 			rs.limit = currentReadEnd
-			rs.size = initialReadaheadSize
+			rs.size = rs.initialSize
 			rs.prevSize = 0
 			return
 		}
@@ -1440,7 +1531,7 @@ func (rs *readaheadState) recordCacheHit(offset, blockLength int64) {
 		// readahead.
 		return
 	}
-	if currentReadEnd >= rs.limit && offset <= rs.limit+maxReadaheadSize {
+	if currentReadEnd >= rs.limit && offset <= rs.limit+rs.maxSize {
 		// Blocks are being read sequentially and would benefit from readahead
 		// down the line.
 		rs.numReads++
@@ -1450,7 +1541,7 @@ func (rs *readaheadState) recordCacheHit(offset, blockLength int64) {
 	// a random read, where readahead is not desirable. Reset all variables.
 	rs.numReads = 1
 	rs.limit = currentReadEnd
-	rs.size = initialReadaheadSize
+	rs.size = rs.initialSize
 	rs.prevSize = 0
 }
 
@@ -1460,6 +1551,9 @@ func (rs *readaheadState) recordCacheHit(offset, blockLength int64) {
 // would be beneficial.
 func (rs *readaheadState) maybeReadahead(offset, blockLength int64) int64 {
 	currentReadEnd := offset + blockLength
+	if rs.disabled {
+		return 0
+	}
 	if rs.sequentialFile != nil {
 		// Using OS-level readahead instead, so do nothing.
 		return 0
@@ -1476,7 +1570,7 @@ func (rs *readaheadState) maybeReadahead(offset, blockLength int64) int64 {
 		// readahead may not be beneficial with a small readahead size, but over
 		// time the readahead size would increase exponentially to make it
 		// beneficial.
-		if currentReadEnd >= rs.limit && offset <= rs.limit+maxReadaheadSize {
+		if currentReadEnd >= rs.limit && offset <= rs.limit+rs.maxSize {
 			// We are doing a read in the interval ahead of
 			// the last readahead range. In the diagrams below, ++++ is the last
 			// readahead range, ==== is the range represented by
@@ -1505,12 +1599,12 @@ func (rs *readaheadState) maybeReadahead(offset, blockLength int64) int64 {
 			rs.prevSize = rs.size
 			// Increase rs.size for the next read.
 			rs.size *= 2
-			if rs.size > maxReadaheadSize {
-				rs.size = maxReadaheadSize
+			if rs.size > rs.maxSize {
+				rs.size = rs.maxSize
 			}
 			return rs.prevSize
 		}
-		if currentReadEnd < rs.limit-rs.prevSize || offset > rs.limit+maxReadaheadSize {
+		if currentReadEnd < rs.limit-rs.prevSize || offset > rs.limit+rs.maxSize {
 			// The above conditional has rs.limit > rs.prevSize to confirm that
 			// rs.limit - rs.prevSize would not underflow.
 			// We read too far away from rs.limit to benefit from readahead in
@@ -1533,7 +1627,7 @@ func (rs *readaheadState) maybeReadahead(offset, blockLength int64) int64 {
 			//
 			rs.numReads = 1
 			rs.limit = currentReadEnd
-			rs.size = initialReadaheadSize
+			rs.size = rs.initialSize
 			rs.prevSize = 0
 			return 0
 		}
@@ -1552,7 +1646,7 @@ func (rs *readaheadState) maybeReadahead(offset, blockLength int64) int64 {
 		rs.numReads++
 		return 0
 	}
-	if currentReadEnd >= rs.limit && offset <= rs.limit+maxReadaheadSize {
+	if currentReadEnd >= rs.limit && offset <= rs.limit+rs.maxSize {
 		// Blocks are being read sequentially and would benefit from readahead
 		// down the line.
 		//
@@ -1576,7 +1670,7 @@ func (rs *readaheadState) maybeReadahead(offset, blockLength int64) int64 {
 	//
 	rs.numReads = 1
 	rs.limit = currentReadEnd
-	rs.size = initialReadaheadSize
+	rs.size = rs.initialSize
 	rs.prevSize = 0
 	return 0
 }
@@ -1695,6 +1789,7 @@ type Reader struct {
 	filterBH          BlockHandle
 	rangeDelBH        BlockHandle
 	rangeDelTransform blockTransform
+	indexTransform    blockTransform
 	propertiesBH      BlockHandle
 	metaIndexBH       BlockHandle
 	footerBH          BlockHandle
@@ -1703,9 +1798,12 @@ type Reader struct {
 	FormatKey         base.FormatKey
 	Split             Split
 	mergerOK          bool
-	checksumType      ChecksumType
-	tableFilter       *tableFilterReader
-	Properties        Properties
+	// blockProps is true if the index entries of data blocks may be followed
+	// by block properties, which is only the case for TableFormatPebblev1.
+	blockProps   bool
+	checksumType ChecksumType
+	tableFilter  *tableFilterReader
+	Properties   Properties
 }
 
 // Close implements DB.Close, as documented in the pebble package.
@@ -1739,18 +1837,16 @@ func (r *Reader) get(key []byte) (value []byte, err error) {
 	}
 
 	if r.tableFilter != nil {
-		dataH, err := r.readFilter()
-		if err != nil {
-			return nil, err
-		}
 		var lookupKey []byte
 		if r.Split != nil {
 			lookupKey = key[:r.Split(key)]
 		} else {
 			lookupKey = key
 		}
-		mayContain := r.tableFilter.mayContain(dataH.Get(), lookupKey)
-		dataH.Release()
+		mayContain, err := r.filterMayContain(lookupKey)
+		if err != nil {
+			return nil, err
+		}
 		if !mayContain {
 			return nil, base.ErrNotFound
 		}
@@ -1783,23 +1879,55 @@ func (r *Reader) get(key []byte) (value []byte, err error) {
 // NewIter returns an iterator for the contents of the table. If an error
 // occurs, NewIter cleans up after itself and returns a nil iterator.
 func (r *Reader) NewIter(lower, upper []byte) (Iterator, error) {
+	return r.NewIterWithOptions(&IterOptions{LowerBound: lower, UpperBound: upper})
+}
+
+// NewIterWithOptions returns an iterator for the contents of the table
+// configured by the specified options. If an error occurs, NewIterWithOptions
+// cleans up after itself and returns a nil iterator.
+func (r *Reader) NewIterWithOptions(o *IterOptions) (Iterator, error) {
+	ctx := o.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var bpfs *blockPropertiesFilterer
+	if len(o.BlockPropertyFilters) > 0 {
+		var intersects bool
+		var err error
+		bpfs, intersects, err = newBlockPropertiesFilterer(r.Properties.UserProperties, o.BlockPropertyFilters)
+		if err != nil {
+			return nil, err
+		}
+		if !intersects {
+			return &emptyIterator{}, nil
+		}
+	}
+
 	// NB: pebble.tableCache wraps the returned iterator with one which performs
 	// reference counting on the Reader, preventing the Reader from being closed
 	// until the final iterator closes.
 	if r.Properties.IndexType == twoLevelIndex {
 		i := twoLevelIterPool.Get().(*twoLevelIterator)
-		err := i.init(r, lower, upper)
+		err := i.init(r, o.LowerBound, o.UpperBound)
 		if err != nil {
 			return nil, err
 		}
+		i.bpfs = bpfs
+		i.stats = o.Stats
+		i.ctx = ctx
+		i.dataRS.init(o.Readahead)
 		return i, nil
 	}
 
 	i := singleLevelIterPool.Get().(*singleLevelIterator)
-	err := i.init(r, lower, upper)
+	err := i.init(r, o.LowerBound, o.UpperBound)
 	if err != nil {
 		return nil, err
 	}
+	i.bpfs = bpfs
+	i.stats = o.Stats
+	i.ctx = ctx
+	i.dataRS.init(o.Readahead)
 	return i, nil
 }
 
@@ -1849,23 +1977,330 @@ func (r *Reader) NewRawRangeDelIter() (base.InternalIterator, error) {
 	return i, nil
 }
 
+// MultiGet looks up a batch of keys, which must be sorted in increasing
+// order, in the table. Rather than seeking an iterator to each key in turn, it
+// probes the filter and searches the index for all of the keys, skipping those
+// which the filter rules out, and then reads the data blocks which may contain
+// the remaining keys and are not already cached, using a single read for each
+// run of adjacent blocks. fn is then called in turn for each remaining key
+// with the index of the key in keys and an iterator positioned at the first
+// entry whose user key is greater than or equal to the key. fn may step the
+// iterator forward to visit the older entries for the key, but must not retain
+// it after returning. If fn returns an error, MultiGet stops and returns it.
+func (r *Reader) MultiGet(
+	keys [][]byte, fn func(j int, iter Iterator, key *InternalKey, value []byte) error,
+) error {
+	if r.err != nil {
+		return r.err
+	}
+	// handles[j] is the handle of the data block which may contain keys[j],
+	// or the zero handle if the table does not contain the key.
+	handles := make([]BlockHandle, len(keys))
+	mayContain := make([]bool, len(keys))
+	if r.tableFilter != nil {
+		if err := r.filterMayContainBatch(keys, mayContain); err != nil {
+			return err
+		}
+	} else {
+		for j := range mayContain {
+			mayContain[j] = true
+		}
+	}
+
+	iter, err := r.NewIter(nil /* lower */, nil /* upper */)
+	if err != nil {
+		return err
+	}
+	var i *singleLevelIterator
+	switch t := iter.(type) {
+	case *twoLevelIterator:
+		i = &t.singleLevelIterator
+		err = t.dataBlockHandles(keys, mayContain, handles)
+	case *singleLevelIterator:
+		i = t
+		err = t.dataBlockHandles(keys, mayContain, handles)
+	}
+	if err == nil {
+		err = r.readBlocks(handles, nil /* transform */)
+	}
+	for j := 0; err == nil && j < len(keys); j++ {
+		if handles[j] == (BlockHandle{}) {
+			continue
+		}
+		// Keys in the block at which the iterator is already positioned are
+		// found without searching the index.
+		var key *InternalKey
+		var value []byte
+		if !i.data.isDataInvalidated() && i.data.Valid() && i.dataBH == handles[j] {
+			key, value = i.data.SeekGE(keys[j])
+		}
+		if key == nil {
+			key, value = iter.SeekGE(keys[j])
+		}
+		if key != nil {
+			err = fn(j, iter, key, value)
+		} else {
+			err = iter.Error()
+		}
+	}
+	return firstError(err, iter.Close())
+}
+
+// dataBlockHandles sets handles[j] to the handle of the data block which may
+// contain keys[j], for the sorted keys for which mayContain[j] is true,
+// searching the index block once for each key. handles[j] is left zero for
+// keys which are greater than every key in the table.
+func (i *singleLevelIterator) dataBlockHandles(
+	keys [][]byte, mayContain []bool, handles []BlockHandle,
+) error {
+	for j, key := range keys {
+		if !mayContain[j] {
+			continue
+		}
+		if ikey, _ := i.index.SeekGE(key); ikey == nil {
+			break
+		}
+		var err error
+		handles[j], _, err = decodeBlockHandleWithProperties(i.index.Value(), i.reader.blockProps)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dataBlockHandles is like singleLevelIterator.dataBlockHandles, but first
+// reads the index partitions covering the keys in the same way that
+// Reader.MultiGet reads data blocks, and then loads each of them once.
+func (i *twoLevelIterator) dataBlockHandles(
+	keys [][]byte, mayContain []bool, handles []BlockHandle,
+) error {
+	var indexHandles []BlockHandle
+	for j, key := range keys {
+		if !mayContain[j] {
+			continue
+		}
+		if ikey, _ := i.topLevelIndex.SeekGE(key); ikey == nil {
+			break
+		}
+		bh, n := decodeBlockHandle(i.topLevelIndex.Value())
+		if n == 0 || n != len(i.topLevelIndex.Value()) {
+			return base.CorruptionErrorf("pebble/table: corrupt top level index entry")
+		}
+		indexHandles = append(indexHandles, bh)
+	}
+	if err := i.reader.readBlocks(indexHandles, i.reader.indexTransform); err != nil {
+		return err
+	}
+
+	var indexBH BlockHandle
+	for j, key := range keys {
+		if !mayContain[j] {
+			continue
+		}
+		if ikey, _ := i.topLevelIndex.SeekGE(key); ikey == nil {
+			break
+		}
+		if bh, _ := decodeBlockHandle(i.topLevelIndex.Value()); bh != indexBH {
+			if !i.loadIndex() {
+				return i.err
+			}
+			indexBH = bh
+		}
+		if ikey, _ := i.index.SeekGE(key); ikey == nil {
+			continue
+		}
+		var err error
+		handles[j], _, err = decodeBlockHandleWithProperties(i.index.Value(), i.reader.blockProps)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBlocks reads the blocks with the given handles, which must be sorted by
+// offset, into the block cache. Zero and repeated handles are ignored. Blocks
+// which are already cached are skipped, and each run of adjacent blocks which
+// are not is read with a single read.
+func (r *Reader) readBlocks(handles []BlockHandle, transform blockTransform) error {
+	var buf []byte
+	var prev BlockHandle
+	for j := 0; j < len(handles); {
+		if bh := handles[j]; bh == (BlockHandle{}) || bh == prev || r.blockCached(bh) {
+			j++
+			continue
+		}
+		// Extend the run of blocks to read over the adjacent blocks which are
+		// not cached.
+		run := handles[j : j+1]
+		start := handles[j].Offset
+		end := start + handles[j].Length + blockTrailerLen
+		for k := j + 1; k < len(handles); k++ {
+			bh := handles[k]
+			if bh == (BlockHandle{}) || bh == run[len(run)-1] {
+				continue
+			}
+			if bh.Offset != end || r.blockCached(bh) {
+				break
+			}
+			run = handles[j : k+1]
+			end += bh.Length + blockTrailerLen
+		}
+		j += len(run)
+		prev = run[len(run)-1]
+
+		if end-start == run[0].Length+blockTrailerLen {
+			h, err := r.readBlock(run[0], transform, nil /* readaheadState */, nil /* stats */)
+			if err != nil {
+				return err
+			}
+			h.Release()
+			continue
+		}
+		if n := int(end - start); cap(buf) < n {
+			buf = make([]byte, n)
+		} else {
+			buf = buf[:n]
+		}
+		if _, err := r.file.ReadAt(buf, int64(start)); err != nil {
+			return err
+		}
+		var last BlockHandle
+		for _, bh := range run {
+			if bh == (BlockHandle{}) || bh == last {
+				continue
+			}
+			last = bh
+			v := r.opts.Cache.Alloc(int(bh.Length + blockTrailerLen))
+			copy(v.Buf(), buf[bh.Offset-start:])
+			h, err := r.decodeBlock(bh, transform, v)
+			if err != nil {
+				return err
+			}
+			h.Release()
+		}
+	}
+	return nil
+}
+
+// blockCached returns whether the block with the given handle is in the block
+// cache.
+func (r *Reader) blockCached(bh BlockHandle) bool {
+	h := r.opts.Cache.Get(r.cacheID, r.fileNum, bh.Offset)
+	defer h.Release()
+	return h.Get() != nil
+}
+
 func (r *Reader) readIndex() (cache.Handle, error) {
-	return r.readBlock(r.indexBH, nil /* transform */, nil /* readaheadState */)
+	return r.readBlock(r.indexBH, r.indexTransform, nil /* readaheadState */, nil /* stats */)
 }
 
 func (r *Reader) readFilter() (cache.Handle, error) {
-	return r.readBlock(r.filterBH, nil /* transform */, nil /* readaheadState */)
+	return r.readBlock(r.filterBH, nil /* transform */, nil /* readaheadState */, nil /* stats */)
+}
+
+// filterMayContain returns whether the table filter may contain the specified
+// filter key (a user key, or a prefix if a prefix extractor is used). It must
+// only be called if r.tableFilter is non-nil. For a partitioned filter only
+// the top-level filter block and the partition covering the key are read.
+func (r *Reader) filterMayContain(key []byte) (bool, error) {
+	dataH, err := r.readFilter()
+	if err != nil {
+		return false, err
+	}
+	defer dataH.Release()
+	if !r.tableFilter.partitioned {
+		return r.tableFilter.mayContain(dataH.Get(), key), nil
+	}
+
+	var iter rawBlockIter
+	if err := iter.init(r.Compare, dataH.Get()); err != nil {
+		return false, err
+	}
+	if !iter.SeekGE(key) {
+		// The key is larger than every key in the filter.
+		return r.tableFilter.record(false), nil
+	}
+	bh, n := decodeBlockHandle(iter.Value())
+	if n == 0 {
+		return false, base.CorruptionErrorf("pebble/table: invalid table (bad filter partition handle)")
+	}
+	partH, err := r.readBlock(bh, nil /* transform */, nil /* readaheadState */, nil /* stats */)
+	if err != nil {
+		return false, err
+	}
+	defer partH.Release()
+	return r.tableFilter.mayContain(partH.Get(), key), nil
+}
+
+// filterMayContainBatch sets mayContain[j] to whether the table filter may
+// contain keys[j], for keys sorted in increasing order. The filter keys are
+// prefixes of the keys if the table has a prefix extractor. It must only be
+// called if r.tableFilter is non-nil. The filter block, and for a partitioned
+// filter each partition covering the keys, is read once.
+func (r *Reader) filterMayContainBatch(keys [][]byte, mayContain []bool) error {
+	dataH, err := r.readFilter()
+	if err != nil {
+		return err
+	}
+	defer dataH.Release()
+
+	var iter rawBlockIter
+	if r.tableFilter.partitioned {
+		if err := iter.init(r.Compare, dataH.Get()); err != nil {
+			return err
+		}
+	}
+	var partBH BlockHandle
+	var partH cache.Handle
+	defer func() { partH.Release() }()
+	for j, key := range keys {
+		if r.Split != nil {
+			key = key[:r.Split(key)]
+		}
+		if !r.tableFilter.partitioned {
+			mayContain[j] = r.tableFilter.mayContain(dataH.Get(), key)
+			continue
+		}
+		if !iter.SeekGE(key) {
+			// The key is larger than every key in the filter.
+			mayContain[j] = r.tableFilter.record(false)
+			continue
+		}
+		bh, n := decodeBlockHandle(iter.Value())
+		if n == 0 {
+			return base.CorruptionErrorf("pebble/table: invalid table (bad filter partition handle)")
+		}
+		if partH.Get() == nil || bh != partBH {
+			partH.Release()
+			if partH, err = r.readBlock(bh, nil /* transform */, nil /* readaheadState */, nil /* stats */); err != nil {
+				return err
+			}
+			partBH = bh
+		}
+		mayContain[j] = r.tableFilter.mayContain(partH.Get(), key)
+	}
+	return nil
 }
 
 func (r *Reader) readRangeDel() (cache.Handle, error) {
-	return r.readBlock(r.rangeDelBH, r.rangeDelTransform, nil /* readaheadState */)
+	return r.readBlock(r.rangeDelBH, r.rangeDelTransform, nil /* readaheadState */, nil /* stats */)
 }
 
 // readBlock reads and decompresses a block from disk into memory.
 func (r *Reader) readBlock(
-	bh BlockHandle, transform blockTransform, raState *readaheadState,
+	bh BlockHandle,
+	transform blockTransform,
+	raState *readaheadState,
+	stats *base.InternalIteratorStats,
 ) (cache.Handle, error) {
 	if h := r.opts.Cache.Get(r.cacheID, r.fileNum, bh.Offset); h.Get() != nil {
+		if stats != nil {
+			stats.BlockCount++
+			stats.BlockBytes += bh.Length
+			stats.BlockBytesInCache += bh.Length
+		}
 		if raState != nil {
 			raState.recordCacheHit(int64(bh.Offset), int64(bh.Length+blockTrailerLen))
 		}
@@ -1877,7 +2312,7 @@ func (r *Reader) readBlock(
 		if raState.sequentialFile != nil {
 			file = raState.sequentialFile
 		} else if readaheadSize := raState.maybeReadahead(int64(bh.Offset), int64(bh.Length+blockTrailerLen)); readaheadSize > 0 {
-			if readaheadSize >= maxReadaheadSize {
+			if readaheadSize >= raState.maxSize {
 				// We've reached the maximum readahead size. Beyond this
 				// point, rely on OS-level readahead. Note that we can only
 				// reopen a new file handle with this optimization if
@@ -1916,7 +2351,21 @@ func (r *Reader) readBlock(
 		r.opts.Cache.Free(v)
 		return cache.Handle{}, err
 	}
+	if stats != nil {
+		stats.BlockCount++
+		stats.BlockBytes += bh.Length
+	}
+	return r.decodeBlock(bh, transform, v)
+}
 
+// decodeBlock verifies the checksum of the block with the given handle which
+// has been read, along with its trailer, into v. It then decompresses and
+// transforms the block and adds it to the cache. v is freed if an error is
+// returned.
+func (r *Reader) decodeBlock(
+	bh BlockHandle, transform blockTransform, v *cache.Value,
+) (cache.Handle, error) {
+	b := v.Buf()
 	expectedChecksum := binary.LittleEndian.Uint32(b[bh.Length+1:])
 	var computedChecksum uint32
 	switch r.checksumType {
@@ -1925,6 +2374,7 @@ func (r *Reader) readBlock(
 	case ChecksumTypeXXHash64:
 		computedChecksum = uint32(xxhash.Sum64(b[:bh.Length+1]))
 	default:
+		r.opts.Cache.Free(v)
 		return cache.Handle{}, errors.Errorf("unsupported checksum type: %d", r.checksumType)
 	}
 
@@ -2011,8 +2461,101 @@ func (r *Reader) transformRangeDelV1(b []byte) ([]byte, error) {
 	return rangeDelBlock.finish(), nil
 }
 
+// transformIndex converts an index block written by RocksDB with format
+// version 3 or later to the format written by Pebble. Such index blocks may
+// contain user keys rather than internal keys, and may delta-encode the block
+// handle of an entry which shares a key prefix with the previous entry as the
+// difference from the length of the previous block.
+func (r *Reader) transformIndex(b []byte) ([]byte, error) {
+	if len(b) < 4 {
+		return nil, errCorruptIndexEntry
+	}
+	numRestarts := binary.LittleEndian.Uint32(b[len(b)-4:])
+	if uint64(numRestarts) >= uint64(len(b)/4) {
+		return nil, errCorruptIndexEntry
+	}
+	data := b[:len(b)-4*(1+int(numRestarts))]
+	userKeys := r.Properties.IndexKeyIsUserKey != 0
+	deltaEncoded := r.Properties.IndexValueIsDeltaEncoded != 0
+
+	indexBlock := blockWriter{
+		restartInterval: 1,
+	}
+	var key []byte
+	var prevBH BlockHandle
+	var buf [blockHandleMaxLen]byte
+	for len(data) > 0 {
+		shared, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errCorruptIndexEntry
+		}
+		data = data[n:]
+		unshared, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errCorruptIndexEntry
+		}
+		data = data[n:]
+		var valueLen uint64
+		if !deltaEncoded {
+			if valueLen, n = binary.Uvarint(data); n <= 0 {
+				return nil, errCorruptIndexEntry
+			}
+			data = data[n:]
+		}
+		if shared > uint64(len(key)) || unshared > uint64(len(data)) {
+			return nil, errCorruptIndexEntry
+		}
+		key = append(key[:shared], data[:unshared]...)
+		data = data[unshared:]
+
+		var value []byte
+		switch {
+		case !deltaEncoded:
+			if valueLen > uint64(len(data)) {
+				return nil, errCorruptIndexEntry
+			}
+			value = data[:valueLen]
+			data = data[valueLen:]
+		case shared == 0:
+			// An entry which does not share a key prefix with the previous
+			// entry, such as a restart point, stores the full block handle.
+			bh, n := decodeBlockHandle(data)
+			if n == 0 {
+				return nil, errCorruptIndexEntry
+			}
+			data = data[n:]
+			value = buf[:encodeBlockHandle(buf[:], bh)]
+			prevBH = bh
+		default:
+			// The block immediately follows the previous block.
+			delta, n := binary.Varint(data)
+			if n <= 0 {
+				return nil, errCorruptIndexEntry
+			}
+			data = data[n:]
+			bh := BlockHandle{
+				Offset: prevBH.Offset + prevBH.Length + blockTrailerLen,
+				Length: uint64(int64(prevBH.Length) + delta),
+			}
+			value = buf[:encodeBlockHandle(buf[:], bh)]
+			prevBH = bh
+		}
+
+		if userKeys {
+			// RocksDB only uses user keys in the index if no user key spans
+			// two data blocks, so the largest internal key for the separator
+			// is >= every key in the preceding data block and < every key in
+			// the following data block.
+			indexBlock.add(base.MakeInternalKey(key, 0, 0), value)
+		} else {
+			indexBlock.add(base.DecodeInternalKey(key), value)
+		}
+	}
+	return indexBlock.finish(), nil
+}
+
 func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
-	b, err := r.readBlock(metaindexBH, nil /* transform */, nil /* readaheadState */)
+	b, err := r.readBlock(metaindexBH, nil /* transform */, nil /* readaheadState */, nil /* stats */)
 	if err != nil {
 		return err
 	}
@@ -2042,7 +2585,7 @@ func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 	}
 
 	if bh, ok := meta[metaPropertiesName]; ok {
-		b, err = r.readBlock(bh, nil /* transform */, nil /* readaheadState */)
+		b, err = r.readBlock(bh, nil /* transform */, nil /* readaheadState */, nil /* stats */)
 		if err != nil {
 			return err
 		}
@@ -2052,6 +2595,9 @@ func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 		if err != nil {
 			return err
 		}
+		if r.Properties.IndexKeyIsUserKey != 0 || r.Properties.IndexValueIsDeltaEncoded != 0 {
+			r.indexTransform = r.transformIndex
+		}
 	}
 
 	if bh, ok := meta[metaRangeDelV2Name]; ok {
@@ -2065,10 +2611,12 @@ func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 
 	for name, fp := range r.opts.Filters {
 		types := []struct {
-			ftype  FilterType
-			prefix string
+			ftype       FilterType
+			prefix      string
+			partitioned bool
 		}{
-			{TableFilter, "fullfilter."},
+			{TableFilter, fullFilterMetaPrefix, false},
+			{TableFilter, partitionedFilterMetaPrefix, true},
 		}
 		var done bool
 		for _, t := range types {
@@ -2078,6 +2626,7 @@ func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 				switch t.ftype {
 				case TableFilter:
 					r.tableFilter = newTableFilterReader(fp)
+					r.tableFilter.partitioned = t.partitioned
 				default:
 					return base.CorruptionErrorf("unknown filter type: %v", errors.Safe(t.ftype))
 				}
@@ -2108,6 +2657,27 @@ func (r *Reader) Layout() (*Layout, error) {
 		Footer:     r.footerBH,
 	}
 
+	if r.tableFilter != nil && r.tableFilter.partitioned {
+		filterH, err := r.readFilter()
+		if err != nil {
+			return nil, err
+		}
+		iter, err := newRawBlockIter(r.Compare, filterH.Get())
+		if err != nil {
+			filterH.Release()
+			return nil, err
+		}
+		for valid := iter.First(); valid; valid = iter.Next() {
+			bh, n := decodeBlockHandle(iter.Value())
+			if n == 0 {
+				filterH.Release()
+				return nil, base.CorruptionErrorf("pebble/table: invalid table (bad filter partition handle)")
+			}
+			l.FilterPartitions = append(l.FilterPartitions, bh)
+		}
+		filterH.Release()
+	}
+
 	indexH, err := r.readIndex()
 	if err != nil {
 		return nil, err
@@ -2118,9 +2688,9 @@ func (r *Reader) Layout() (*Layout, error) {
 		l.Index = append(l.Index, r.indexBH)
 		iter, _ := newBlockIter(r.Compare, indexH.Get())
 		for key, value := iter.First(); key != nil; key, value = iter.Next() {
-			dataBH, n := decodeBlockHandle(value)
-			if n == 0 || n != len(value) {
-				return nil, errCorruptIndexEntry
+			dataBH, _, err := decodeBlockHandleWithProperties(value, r.blockProps)
+			if err != nil {
+				return nil, err
 			}
 			l.Data = append(l.Data, dataBH)
 		}
@@ -2134,15 +2704,15 @@ func (r *Reader) Layout() (*Layout, error) {
 			}
 			l.Index = append(l.Index, indexBH)
 
-			subIndex, err := r.readBlock(indexBH, nil /* transform */, nil /* readaheadState */)
+			subIndex, err := r.readBlock(indexBH, r.indexTransform, nil /* readaheadState */, nil /* stats */)
 			if err != nil {
 				return nil, err
 			}
 			iter, _ := newBlockIter(r.Compare, subIndex.Get())
 			for key, value := iter.First(); key != nil; key, value = iter.Next() {
-				dataBH, n := decodeBlockHandle(value)
-				if n == 0 || n != len(value) {
-					return nil, errCorruptIndexEntry
+				dataBH, _, err := decodeBlockHandleWithProperties(value, r.blockProps)
+				if err != nil {
+					return nil, err
 				}
 				l.Data = append(l.Data, dataBH)
 			}
@@ -2200,7 +2770,7 @@ func (r *Reader) EstimateDiskUsage(start, end []byte) (uint64, error) {
 		if n == 0 || n != len(val) {
 			return 0, errCorruptIndexEntry
 		}
-		startIdxBlock, err := r.readBlock(startIdxBH, nil /* transform */, nil /* readaheadState */)
+		startIdxBlock, err := r.readBlock(startIdxBH, r.indexTransform, nil /* readaheadState */, nil /* stats */)
 		if err != nil {
 			return 0, err
 		}
@@ -2220,7 +2790,7 @@ func (r *Reader) EstimateDiskUsage(start, end []byte) (uint64, error) {
 			if n == 0 || n != len(val) {
 				return 0, errCorruptIndexEntry
 			}
-			endIdxBlock, err := r.readBlock(endIdxBH, nil /* transform */, nil /* readaheadState */)
+			endIdxBlock, err := r.readBlock(endIdxBH, r.indexTransform, nil /* readaheadState */, nil /* stats */)
 			if err != nil {
 				return 0, err
 			}
@@ -2239,9 +2809,9 @@ func (r *Reader) EstimateDiskUsage(start, end []byte) (uint64, error) {
 		// The range falls completely after this file, or an error occurred.
 		return 0, startIdxIter.Error()
 	}
-	startBH, n := decodeBlockHandle(val)
-	if n == 0 || n != len(val) {
-		return 0, errCorruptIndexEntry
+	startBH, _, err := decodeBlockHandleWithProperties(val, r.blockProps)
+	if err != nil {
+		return 0, err
 	}
 
 	if endIdxIter == nil {
@@ -2256,9 +2826,9 @@ func (r *Reader) EstimateDiskUsage(start, end []byte) (uint64, error) {
 		// The range spans beyond this file. Include data blocks through the last.
 		return r.Properties.DataSize - startBH.Offset, nil
 	}
-	endBH, n := decodeBlockHandle(val)
-	if n == 0 || n != len(val) {
-		return 0, errCorruptIndexEntry
+	endBH, _, err := decodeBlockHandleWithProperties(val, r.blockProps)
+	if err != nil {
+		return 0, err
 	}
 	return endBH.Offset + endBH.Length + blockTrailerLen - startBH.Offset, nil
 }
@@ -2308,6 +2878,7 @@ func NewReader(f ReadableFile, o ReaderOptions, extraOpts ...ReaderOption) (*Rea
 		return nil, r.Close()
 	}
 	r.checksumType = footer.checksum
+	r.blockProps = footer.format == TableFormatPebblev1
 	// Read the metaindex.
 	if err := r.readMetaindex(footer.metaindexBH); err != nil {
 		r.err = err
@@ -2353,14 +2924,15 @@ func NewReader(f ReadableFile, o ReaderOptions, extraOpts ...ReaderOption) (*Rea
 
 // Layout describes the block organization of an sstable.
 type Layout struct {
-	Data       []BlockHandle
-	Index      []BlockHandle
-	TopIndex   BlockHandle
-	Filter     BlockHandle
-	RangeDel   BlockHandle
-	Properties BlockHandle
-	MetaIndex  BlockHandle
-	Footer     BlockHandle
+	Data             []BlockHandle
+	Index            []BlockHandle
+	TopIndex         BlockHandle
+	Filter           BlockHandle
+	FilterPartitions []BlockHandle
+	RangeDel         BlockHandle
+	Properties       BlockHandle
+	MetaIndex        BlockHandle
+	Footer           BlockHandle
 }
 
 // Describe returns a description of the layout. If the verbose parameter is
@@ -2384,7 +2956,14 @@ func (l *Layout) Describe(
 		blocks = append(blocks, block{l.TopIndex, "top-index"})
 	}
 	if l.Filter.Length != 0 {
-		blocks = append(blocks, block{l.Filter, "filter"})
+		if len(l.FilterPartitions) == 0 {
+			blocks = append(blocks, block{l.Filter, "filter"})
+		} else {
+			blocks = append(blocks, block{l.Filter, "top-filter"})
+		}
+	}
+	for i := range l.FilterPartitions {
+		blocks = append(blocks, block{l.FilterPartitions[i], "filter"})
 	}
 	if l.RangeDel.Length != 0 {
 		blocks = append(blocks, block{l.RangeDel, "range-del"})
@@ -2418,7 +2997,16 @@ func (l *Layout) Describe(
 			continue
 		}
 
-		h, err := r.readBlock(b.BlockHandle, nil /* transform */, nil /* readaheadState */)
+		// Blocks must be read with the same transform as the reader uses, as
+		// the transformed block is stored in the cache.
+		var transform blockTransform
+		switch b.name {
+		case "index", "top-index":
+			transform = r.indexTransform
+		case "range-del":
+			transform = r.rangeDelTransform
+		}
+		h, err := r.readBlock(b.BlockHandle, transform, nil /* readaheadState */, nil /* stats */)
 		if err != nil {
 			fmt.Fprintf(w, "  [err: %s]\n", err)
 			continue
@@ -2488,7 +3076,10 @@ func (l *Layout) Describe(
 			iter, _ := newBlockIter(r.Compare, h.Get())
 			for key, value := iter.First(); key != nil; key, value = iter.Next() {
 				bh, n := decodeBlockHandle(value)
-				if n == 0 || n != len(value) {
+				// Only the entries of data block index blocks may be followed
+				// by block properties.
+				blockProps := r.blockProps && b.name == "index"
+				if n == 0 || (!blockProps && n != len(value)) {
 					fmt.Fprintf(w, "%10d    [err: %s]\n", b.Offset+uint64(iter.offset), err)
 					continue
 				}
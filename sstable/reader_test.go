@@ -12,6 +12,7 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"testing"
@@ -122,6 +123,10 @@ func TestReader(t *testing.T) {
 			FilterPolicy: bloom.FilterPolicy(100),
 			FilterType:   base.TableFilter,
 		},
+		"hashIndex": WriterOptions{
+			TableFormat:        TableFormatPebblev1,
+			DataBlockHashIndex: true,
+		},
 	}
 
 	blockSizes := map[string]int{
@@ -166,6 +171,7 @@ func TestHamletReader(t *testing.T) {
 		"testdata/h.sst",
 		"testdata/h.no-compression.sst",
 		"testdata/h.no-compression.two_level_index.sst",
+		"testdata/h.no-compression.format_version_5.sst",
 		"testdata/h.block-bloom.no-compression.sst",
 		"testdata/h.table-bloom.no-compression.prefix_extractor.no_whole_key_filter.sst",
 		"testdata/h.table-bloom.no-compression.sst",
@@ -191,6 +197,7 @@ func TestInjectedErrors(t *testing.T) {
 		"testdata/h.sst",
 		"testdata/h.no-compression.sst",
 		"testdata/h.no-compression.two_level_index.sst",
+		"testdata/h.no-compression.format_version_5.sst",
 		"testdata/h.block-bloom.no-compression.sst",
 		"testdata/h.table-bloom.no-compression.prefix_extractor.no_whole_key_filter.sst",
 		"testdata/h.table-bloom.no-compression.sst",
@@ -479,13 +486,79 @@ func TestCompactionIteratorSetupForCompaction(t *testing.T) {
 	}
 }
 
+func TestIteratorReadaheadConfig(t *testing.T) {
+	for _, indexBlockSize := range []int{100, math.MaxInt32} {
+		r := buildTestTable(t, 1e4, 100, indexBlockSize, DefaultCompression)
+		for _, config := range []ReadaheadConfig{
+			{},
+			{InitialSize: 4 << 10, MaxSize: 16 << 10},
+			{InitialSize: 1 << 20, MaxSize: 16 << 10},
+			{Disable: true},
+		} {
+			iter, err := r.NewIterWithOptions(&IterOptions{Readahead: config})
+			require.NoError(t, err)
+			var rs *readaheadState
+			switch i := iter.(type) {
+			case *singleLevelIterator:
+				rs = &i.dataRS
+			case *twoLevelIterator:
+				rs = &i.dataRS
+			default:
+				t.Fatalf("unknown iterator type: %T", iter)
+			}
+			expectedMax, expectedInitial := int64(maxReadaheadSize), int64(initialReadaheadSize)
+			if config.MaxSize != 0 {
+				expectedMax = config.MaxSize
+			}
+			if config.InitialSize != 0 {
+				expectedInitial = config.InitialSize
+			}
+			if expectedInitial > expectedMax {
+				expectedInitial = expectedMax
+			}
+			require.Equal(t, expectedMax, rs.maxSize)
+			require.Equal(t, expectedInitial, rs.size)
+
+			var n int
+			for key, _ := iter.First(); key != nil; key, _ = iter.Next() {
+				n++
+			}
+			require.Equal(t, int(1e4), n)
+			if config.Disable {
+				require.Equal(t, int64(0), rs.numReads)
+				require.Equal(t, int64(0), rs.limit)
+			}
+			require.NoError(t, iter.Close())
+		}
+		require.NoError(t, r.Close())
+	}
+}
+
 func TestMaybeReadahead(t *testing.T) {
 	var rs readaheadState
 	datadriven.RunTest(t, "testdata/readahead", func(d *datadriven.TestData) string {
 		cacheHit := false
 		switch d.Cmd {
 		case "reset":
-			rs.size = initialReadaheadSize
+			var config ReadaheadConfig
+			for _, arg := range d.CmdArgs {
+				switch arg.Key {
+				case "initial-size":
+					var size int
+					d.ScanArgs(t, "initial-size", &size)
+					config.InitialSize = int64(size)
+				case "max-size":
+					var size int
+					d.ScanArgs(t, "max-size", &size)
+					config.MaxSize = int64(size)
+				case "disable":
+					config.Disable = true
+				default:
+					return fmt.Sprintf("unknown argument: %s", arg.Key)
+				}
+			}
+			rs = readaheadState{}
+			rs.init(config)
 			rs.limit = 0
 			rs.numReads = 0
 			return ""
@@ -614,6 +687,148 @@ func TestReaderChecksumErrors(t *testing.T) {
 	}
 }
 
+// readCountingFile counts the reads issued against a file.
+type readCountingFile struct {
+	vfs.File
+	reads int
+}
+
+func (f *readCountingFile) ReadAt(p []byte, off int64) (int, error) {
+	f.reads++
+	return f.File.ReadAt(p, off)
+}
+
+func TestReaderMultiGet(t *testing.T) {
+	writerOpts := map[string]WriterOptions{
+		"default": {},
+		"bloom": {
+			FilterPolicy: bloom.FilterPolicy(10),
+			FilterType:   base.TableFilter,
+		},
+		"partitionedBloom": {
+			FilterPolicy:    bloom.FilterPolicy(10),
+			FilterType:      base.TableFilter,
+			FilterBlockSize: 64,
+		},
+		"snappy": {
+			Compression: SnappyCompression,
+		},
+	}
+	blockSizes := []int{100, math.MaxInt32}
+
+	const numEntries = 1000
+	makeKey := func(i int) []byte {
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, uint64(i))
+		return key
+	}
+
+	for name, opts := range writerOpts {
+		for _, blockSize := range blockSizes {
+			for _, indexBlockSize := range blockSizes {
+				opts.BlockSize = blockSize
+				opts.IndexBlockSize = indexBlockSize
+				t.Run(fmt.Sprintf("%s,blockSize=%d,indexBlockSize=%d", name, blockSize, indexBlockSize),
+					func(t *testing.T) {
+						mem := vfs.NewMem()
+						f0, err := mem.Create("test")
+						require.NoError(t, err)
+						w := NewWriter(f0, opts)
+						// Write the even keys, each with two versions.
+						for i := 0; i < 2*numEntries; i += 2 {
+							for _, seqNum := range []uint64{2, 1} {
+								ikey := base.MakeInternalKey(makeKey(i), seqNum, InternalKeyKindSet)
+								require.NoError(t, w.Add(ikey, []byte(fmt.Sprintf("%d.%d", i, seqNum))))
+							}
+						}
+						require.NoError(t, w.Close())
+
+						f1, err := mem.Open("test")
+						require.NoError(t, err)
+						f := &readCountingFile{File: f1}
+						c := cache.New(128 << 20)
+						defer c.Unref()
+						r, err := NewReader(f, ReaderOptions{Cache: c})
+						require.NoError(t, err)
+						defer r.Close()
+
+						var keys [][]byte
+						for i := 0; i < 2*numEntries+10; i += 3 {
+							keys = append(keys, makeKey(i))
+						}
+						var found []string
+						require.NoError(t, r.MultiGet(keys, func(j int, iter Iterator, key *InternalKey, value []byte) error {
+							for ; key != nil && bytes.Equal(key.UserKey, keys[j]); key, value = iter.Next() {
+								found = append(found, string(value))
+							}
+							return nil
+						}))
+						var expected []string
+						for i := 0; i < 2*numEntries; i += 6 {
+							expected = append(expected, fmt.Sprintf("%d.2", i), fmt.Sprintf("%d.1", i))
+						}
+						require.Equal(t, expected, found)
+					})
+			}
+		}
+	}
+
+	// The blocks covering the first half of the table, and for a two-level
+	// index their index partitions, are each read with a single read.
+	for _, tc := range []struct {
+		indexBlockSize int
+		reads          int
+	}{
+		{indexBlockSize: math.MaxInt32, reads: 1},
+		{indexBlockSize: 100, reads: 2},
+	} {
+		t.Run(fmt.Sprintf("coalesced,indexBlockSize=%d", tc.indexBlockSize), func(t *testing.T) {
+			mem := vfs.NewMem()
+			f0, err := mem.Create("test")
+			require.NoError(t, err)
+			w := NewWriter(f0, WriterOptions{BlockSize: 100, IndexBlockSize: tc.indexBlockSize})
+			for i := 0; i < numEntries; i++ {
+				ikey := base.MakeInternalKey(makeKey(i), 1, InternalKeyKindSet)
+				require.NoError(t, w.Add(ikey, makeKey(i)))
+			}
+			require.NoError(t, w.Close())
+
+			f1, err := mem.Open("test")
+			require.NoError(t, err)
+			f := &readCountingFile{File: f1}
+			c := cache.New(128 << 20)
+			defer c.Unref()
+			r, err := NewReader(f, ReaderOptions{Cache: c})
+			require.NoError(t, err)
+			defer r.Close()
+
+			count := func(keys [][]byte) int {
+				// Load the top-level index block first so that it is not
+				// counted.
+				require.NoError(t, r.MultiGet(nil, nil))
+				f.reads = 0
+				var n int
+				require.NoError(t, r.MultiGet(keys, func(j int, iter Iterator, key *InternalKey, value []byte) error {
+					require.Equal(t, keys[j], key.UserKey)
+					require.Equal(t, keys[j], value)
+					n++
+					return nil
+				}))
+				require.Equal(t, len(keys), n)
+				return f.reads
+			}
+
+			var keys [][]byte
+			for i := 0; i < numEntries/2; i++ {
+				keys = append(keys, makeKey(i))
+			}
+			require.Equal(t, tc.reads, count(keys))
+			// The blocks are now cached.
+			require.Equal(t, 0, count(keys))
+		})
+	}
+}
+
 func buildTestTable(
 	t *testing.T, numEntries uint64, blockSize, indexBlockSize int, compression Compression,
 ) *Reader {
@@ -817,3 +1032,152 @@ func BenchmarkTableIterPrev(b *testing.B) {
 			})
 	}
 }
+
+func BenchmarkReaderMultiGet(b *testing.B) {
+	const numKeys = 100000
+	mem := vfs.NewMem()
+	f0, err := mem.Create("bench")
+	require.NoError(b, err)
+	w := NewWriter(f0, WriterOptions{BlockSize: 4 << 10})
+	makeKey := func(i int) []byte {
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, uint64(i))
+		return key
+	}
+	for i := 0; i < numKeys; i++ {
+		require.NoError(b, w.Add(base.MakeInternalKey(makeKey(i), 1, InternalKeyKindSet), makeKey(i)))
+	}
+	require.NoError(b, w.Close())
+
+	// Each lookup starts with an empty block cache, and reports the number of
+	// reads issued against the file.
+	run := func(b *testing.B, batch [][]byte, lookup func(r *Reader, batch [][]byte)) {
+		var reads int
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			f1, err := mem.Open("bench")
+			require.NoError(b, err)
+			f := &readCountingFile{File: f1}
+			c := cache.New(128 << 20)
+			r, err := NewReader(f, ReaderOptions{Cache: c})
+			require.NoError(b, err)
+			c.Unref()
+			f.reads = 0
+			b.StartTimer()
+
+			lookup(r, batch)
+
+			b.StopTimer()
+			reads += f.reads
+			require.NoError(b, r.Close())
+			b.StartTimer()
+		}
+		b.ReportMetric(float64(reads)/float64(b.N), "reads/op")
+	}
+
+	rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+	for _, window := range []int{1000, numKeys} {
+		// Look up a sorted batch of keys drawn from a window of the table.
+		batch := make([][]byte, 100)
+		start := rng.Intn(numKeys - window + 1)
+		for i, k := range rng.Perm(window)[:len(batch)] {
+			batch[i] = makeKey(start + k)
+		}
+		sort.Slice(batch, func(i, j int) bool { return bytes.Compare(batch[i], batch[j]) < 0 })
+
+		b.Run(fmt.Sprintf("window=%d/multiget", window), func(b *testing.B) {
+			run(b, batch, func(r *Reader, batch [][]byte) {
+				require.NoError(b, r.MultiGet(batch, func(int, Iterator, *InternalKey, []byte) error {
+					return nil
+				}))
+			})
+		})
+		b.Run(fmt.Sprintf("window=%d/seekge", window), func(b *testing.B) {
+			run(b, batch, func(r *Reader, batch [][]byte) {
+				it, err := r.NewIter(nil /* lower */, nil /* upper */)
+				require.NoError(b, err)
+				for _, key := range batch {
+					it.SeekGE(key)
+				}
+				require.NoError(b, it.Close())
+			})
+		})
+	}
+}
+
+func TestReaderTransformIndex(t *testing.T) {
+	// Build an index block in the format written by RocksDB with format
+	// version 4: user keys, a restart interval of 2 and delta-encoded block
+	// handles.
+	type entry struct {
+		key string
+		bh  BlockHandle
+	}
+	entries := []entry{
+		{"apple", BlockHandle{Offset: 0, Length: 100}},
+		{"apricot", BlockHandle{Offset: 105, Length: 50}},
+		{"banana", BlockHandle{Offset: 160, Length: 70}},
+		{"blueberry", BlockHandle{Offset: 235, Length: 10}},
+	}
+	var buf []byte
+	var restarts []uint32
+	var tmp [binary.MaxVarintLen64]byte
+	putUvarint := func(v uint64) {
+		buf = append(buf, tmp[:binary.PutUvarint(tmp[:], v)]...)
+	}
+	var prevKey string
+	for i, e := range entries {
+		shared := 0
+		if i%2 == 0 {
+			restarts = append(restarts, uint32(len(buf)))
+		} else {
+			for shared < len(prevKey) && shared < len(e.key) && prevKey[shared] == e.key[shared] {
+				shared++
+			}
+		}
+		putUvarint(uint64(shared))
+		putUvarint(uint64(len(e.key) - shared))
+		buf = append(buf, e.key[shared:]...)
+		if shared == 0 {
+			buf = append(buf, tmp[:encodeBlockHandle(tmp[:], e.bh)]...)
+		} else {
+			delta := int64(e.bh.Length) - int64(entries[i-1].bh.Length)
+			buf = append(buf, tmp[:binary.PutVarint(tmp[:], delta)]...)
+		}
+		prevKey = e.key
+	}
+	for _, r := range restarts {
+		buf = append(buf, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(buf[len(buf)-4:], r)
+	}
+	buf = append(buf, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(buf[len(buf)-4:], uint32(len(restarts)))
+
+	r := &Reader{Compare: base.DefaultComparer.Compare}
+	r.Properties.IndexKeyIsUserKey = 1
+	r.Properties.IndexValueIsDeltaEncoded = 1
+	b, err := r.transformIndex(buf)
+	require.NoError(t, err)
+
+	iter, err := newBlockIter(r.Compare, b)
+	require.NoError(t, err)
+	var i int
+	for key, value := iter.First(); key != nil; key, value = iter.Next() {
+		require.Equal(t, entries[i].key, string(key.UserKey))
+		require.EqualValues(t, 0, key.Trailer)
+		bh, n := decodeBlockHandle(value)
+		require.Equal(t, len(value), n)
+		require.Equal(t, entries[i].bh, bh)
+		i++
+	}
+	require.Equal(t, len(entries), i)
+
+	// Seeking to a user key finds the entry for the data block containing it.
+	key, _ := iter.SeekGE([]byte("apricot"))
+	require.NotNil(t, key)
+	require.Equal(t, "apricot", string(key.UserKey))
+	require.NoError(t, iter.Close())
+
+	_, err = r.transformIndex(buf[:len(buf)-5])
+	require.Error(t, err)
+}
@@ -141,6 +141,8 @@ const (
 	rocksDBMagicOffset   = rocksDBFooterLen - len(rocksDBMagic)
 	rocksDBVersionOffset = rocksDBMagicOffset - 4
 
+	pebbleDBMagic = "\xf0\x9f\xaa\xb3\xf0\x9f\xaa\xb3"
+
 	rocksDBExternalFormatVersion = 2
 
 	minFooterLen = levelDBFooterLen
@@ -148,6 +150,8 @@ const (
 
 	levelDBFormatVersion  = 0
 	rocksDBFormatVersion2 = 2
+	rocksDBFormatVersion5 = 5
+	pebbleFormatVersion1  = 1
 
 	noChecksum       = 0
 	checksumCRC32c   = 1
@@ -201,6 +205,9 @@ const (
 //    <padding> to make the total size 2 * BlockHandle::kMaxEncodedLength + 1
 //    footer version (4 bytes)
 //    table_magic_number (8 bytes)
+// The Pebble footer format is the same as the RocksDB footer format, with a
+// different magic number and footer version. A reader rejects a footer with a
+// version newer than it supports.
 type footer struct {
 	format      TableFormat
 	checksum    ChecksumType
@@ -242,7 +249,7 @@ func readFooter(f ReadableFile) (footer, error) {
 		footer.format = TableFormatLevelDB
 		footer.checksum = ChecksumTypeCRC32c
 
-	case rocksDBMagic:
+	case rocksDBMagic, pebbleDBMagic:
 		if len(buf) < rocksDBFooterLen {
 			return footer, base.CorruptionErrorf("pebble/table: invalid table (footer too short): %d", errors.Safe(len(buf)))
 		}
@@ -250,10 +257,21 @@ func readFooter(f ReadableFile) (footer, error) {
 		buf = buf[len(buf)-rocksDBFooterLen:]
 		footer.footerBH.Length = uint64(len(buf))
 		version := binary.LittleEndian.Uint32(buf[rocksDBVersionOffset:rocksDBMagicOffset])
-		if version != rocksDBFormatVersion2 {
-			return footer, base.CorruptionErrorf("pebble/table: unsupported format version %d", errors.Safe(version))
+		if string(buf[rocksDBMagicOffset:]) == pebbleDBMagic {
+			if version != pebbleFormatVersion1 {
+				return footer, base.CorruptionErrorf("pebble/table: unsupported format version %d", errors.Safe(version))
+			}
+			footer.format = TableFormatPebblev1
+		} else {
+			// RocksDB format versions 3 to 5 differ from version 2 in the
+			// encoding of index blocks, which is recorded in the table
+			// properties, and in the format of bloom filters. Both are handled
+			// when reading the table.
+			if version < rocksDBFormatVersion2 || version > rocksDBFormatVersion5 {
+				return footer, base.CorruptionErrorf("pebble/table: unsupported format version %d", errors.Safe(version))
+			}
+			footer.format = TableFormatRocksDBv2
 		}
-		footer.format = TableFormatRocksDBv2
 		switch uint8(buf[0]) {
 		case checksumCRC32c:
 			footer.checksum = ChecksumTypeCRC32c
@@ -297,7 +315,7 @@ func (f footer) encode(buf []byte) []byte {
 		encodeBlockHandle(buf[n:], f.indexBH)
 		copy(buf[len(buf)-len(levelDBMagic):], levelDBMagic)
 
-	case TableFormatRocksDBv2:
+	case TableFormatRocksDBv2, TableFormatPebblev1:
 		buf = buf[:rocksDBFooterLen]
 		for i := range buf {
 			buf[i] = 0
@@ -317,8 +335,13 @@ func (f footer) encode(buf []byte) []byte {
 		n := 1
 		n += encodeBlockHandle(buf[n:], f.metaindexBH)
 		encodeBlockHandle(buf[n:], f.indexBH)
-		binary.LittleEndian.PutUint32(buf[rocksDBVersionOffset:], rocksDBFormatVersion2)
-		copy(buf[len(buf)-len(rocksDBMagic):], rocksDBMagic)
+		if f.format == TableFormatPebblev1 {
+			binary.LittleEndian.PutUint32(buf[rocksDBVersionOffset:], pebbleFormatVersion1)
+			copy(buf[len(buf)-len(pebbleDBMagic):], pebbleDBMagic)
+		} else {
+			binary.LittleEndian.PutUint32(buf[rocksDBVersionOffset:], rocksDBFormatVersion2)
+			copy(buf[len(buf)-len(rocksDBMagic):], rocksDBMagic)
+		}
 	}
 
 	return buf
@@ -328,7 +351,7 @@ func supportsTwoLevelIndex(format TableFormat) bool {
 	switch format {
 	case TableFormatLevelDB:
 		return false
-	case TableFormatRocksDBv2:
+	case TableFormatRocksDBv2, TableFormatPebblev1:
 		return true
 	}
 	return true
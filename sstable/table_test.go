@@ -435,6 +435,19 @@ func TestReaderBlockBloomIgnored(t *testing.T) {
 func TestReaderTableBloomIgnored(t *testing.T) {
 	testReader(t, "h.table-bloom.no-compression.sst", nil, nil)
 }
+func TestReaderRocksDBFormatVersion5(t *testing.T) {
+	const filename = "h.no-compression.format_version_5.sst"
+	f, err := os.Open(filepath.FromSlash("testdata/" + filename))
+	require.NoError(t, err)
+	r, err := NewReader(f, ReaderOptions{})
+	require.NoError(t, err)
+	// The index uses user keys and delta-encoded block handles.
+	require.EqualValues(t, 1, r.Properties.IndexKeyIsUserKey)
+	require.EqualValues(t, 1, r.Properties.IndexValueIsDeltaEncoded)
+	require.NoError(t, r.Close())
+
+	testReader(t, filename, nil, nil)
+}
 
 func TestReaderBloomUsed(t *testing.T) {
 	// wantActualNegatives is the minimum number of nonsense words (i.e. false
@@ -597,6 +610,125 @@ func TestWriterRoundTrip(t *testing.T) {
 	}
 }
 
+func TestPartitionedFilter(t *testing.T) {
+	prefixComparer := *base.DefaultComparer
+	prefixComparer.Split = func(a []byte) int {
+		if i := bytes.IndexByte(a, '@'); i >= 0 {
+			return i
+		}
+		return len(a)
+	}
+
+	testCases := []struct {
+		name     string
+		comparer *Comparer
+	}{
+		{"whole-key", nil},
+		{"prefix", &prefixComparer},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Write 2000 prefixes with 1-5 versions each, so that prefixes are
+			// candidates for spanning partition boundaries.
+			const numPrefixes = 2000
+			var keys [][]byte
+			for i := 0; i < numPrefixes; i++ {
+				for v := 0; v <= i%5; v++ {
+					keys = append(keys, []byte(fmt.Sprintf("%05d@%d", i, v)))
+				}
+			}
+
+			mem := vfs.NewMem()
+			f, err := mem.Create("test")
+			require.NoError(t, err)
+			w := NewWriter(f, WriterOptions{
+				Comparer:        tc.comparer,
+				FilterBlockSize: 256,
+				FilterPolicy:    bloom.FilterPolicy(10),
+				FilterType:      TableFilter,
+			})
+			for _, k := range keys {
+				require.NoError(t, w.Set(k, k))
+			}
+			require.NoError(t, w.Close())
+
+			f, err = mem.Open("test")
+			require.NoError(t, err)
+			r, err := NewReader(f, ReaderOptions{
+				Comparer: tc.comparer,
+				Filters: map[string]FilterPolicy{
+					bloom.FilterPolicy(10).Name(): bloom.FilterPolicy(10),
+				},
+			})
+			require.NoError(t, err)
+			defer r.Close()
+			require.True(t, r.tableFilter.partitioned)
+
+			l, err := r.Layout()
+			require.NoError(t, err)
+			require.Less(t, 1, len(l.FilterPartitions))
+
+			lookup := func(k []byte) []byte {
+				if tc.comparer != nil {
+					return k[:tc.comparer.Split(k)]
+				}
+				return k
+			}
+
+			// The filter must never produce a false negative.
+			for _, k := range keys {
+				mayContain, err := r.filterMayContain(lookup(k))
+				require.NoError(t, err)
+				require.True(t, mayContain, "%s", k)
+				v, err := r.get(k)
+				require.NoError(t, err)
+				require.Equal(t, k, v)
+			}
+
+			// Absent keys, both within and beyond the range of the table, should
+			// mostly be rejected.
+			var falsePositives int
+			for i := 0; i < 2*numPrefixes; i++ {
+				k := []byte(fmt.Sprintf("%05d@%d", i, 9))
+				if i >= numPrefixes {
+					k = []byte(fmt.Sprintf("%05d", i))
+				} else if tc.comparer != nil {
+					k = []byte(fmt.Sprintf("%05dx", i))
+				}
+				mayContain, err := r.filterMayContain(lookup(k))
+				require.NoError(t, err)
+				if mayContain {
+					falsePositives++
+				}
+			}
+			require.Less(t, falsePositives, numPrefixes/10)
+		})
+	}
+
+	// A filter which fits within FilterBlockSize is not partitioned.
+	mem := vfs.NewMem()
+	f, err := mem.Create("test")
+	require.NoError(t, err)
+	w := NewWriter(f, WriterOptions{
+		FilterBlockSize: 4096,
+		FilterPolicy:    bloom.FilterPolicy(10),
+		FilterType:      TableFilter,
+	})
+	require.NoError(t, w.Set([]byte("a"), nil))
+	require.NoError(t, w.Close())
+	f, err = mem.Open("test")
+	require.NoError(t, err)
+	r, err := NewReader(f, ReaderOptions{
+		Filters: map[string]FilterPolicy{
+			bloom.FilterPolicy(10).Name(): bloom.FilterPolicy(10),
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, r.tableFilter)
+	require.False(t, r.tableFilter.partitioned)
+	require.NoError(t, r.Close())
+}
+
 func TestFinalBlockIsWritten(t *testing.T) {
 	keys := []string{"A", "B", "C", "D", "E", "F", "G", "H", "I", "J"}
 	valueLengths := []int{0, 1, 22, 28, 33, 40, 50, 61, 87, 100, 143, 200}
@@ -692,7 +824,7 @@ func TestMetaIndexEntriesSorted(t *testing.T) {
 	r, err := NewReader(f, ReaderOptions{})
 	require.NoError(t, err)
 
-	b, err := r.readBlock(r.metaIndexBH, nil /* transform */, nil /* attrs */)
+	b, err := r.readBlock(r.metaIndexBH, nil /* transform */, nil /* attrs */, nil /* stats */)
 	require.NoError(t, err)
 	defer b.Release()
 
@@ -716,6 +848,7 @@ func TestFooterRoundTrip(t *testing.T) {
 	for _, format := range []TableFormat{
 		TableFormatRocksDBv2,
 		TableFormatLevelDB,
+		TableFormatPebblev1,
 	} {
 		t.Run(fmt.Sprintf("format=%d", format), func(t *testing.T) {
 			checksums := []ChecksumType{ChecksumTypeCRC32c}
@@ -774,6 +907,11 @@ func TestReadFooter(t *testing.T) {
 		}
 		return string(f.encode(make([]byte, maxFooterLen)))
 	}
+	withVersion := func(encoded string, version uint32) string {
+		b := []byte(encoded)
+		binary.LittleEndian.PutUint32(b[rocksDBVersionOffset:], version)
+		return string(b)
+	}
 
 	testCases := []struct {
 		encoded  string
@@ -786,6 +924,9 @@ func TestReadFooter(t *testing.T) {
 		{encode(TableFormatRocksDBv2, 0)[1:], "footer too short"},
 		{encode(TableFormatRocksDBv2, ChecksumTypeNone), "unsupported checksum type"},
 		{encode(TableFormatRocksDBv2, ChecksumTypeXXHash), "unsupported checksum type"},
+		{withVersion(encode(TableFormatRocksDBv2, ChecksumTypeCRC32c), 1), "unsupported format version"},
+		{withVersion(encode(TableFormatRocksDBv2, ChecksumTypeCRC32c), 6), "unsupported format version"},
+		{withVersion(encode(TableFormatPebblev1, ChecksumTypeCRC32c), 2), "unsupported format version"},
 	}
 	for _, c := range testCases {
 		t.Run("", func(t *testing.T) {
@@ -807,6 +948,23 @@ func TestReadFooter(t *testing.T) {
 			}
 		})
 	}
+
+	// RocksDB format versions 3 to 5 are readable.
+	for version := uint32(3); version <= 5; version++ {
+		mem := vfs.NewMem()
+		f, err := mem.Create("test")
+		require.NoError(t, err)
+		_, err = f.Write([]byte(withVersion(encode(TableFormatRocksDBv2, ChecksumTypeCRC32c), version)))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		f, err = mem.Open("test")
+		require.NoError(t, err)
+		footer, err := readFooter(f)
+		require.NoError(t, err)
+		require.Equal(t, TableFormatRocksDBv2, footer.format)
+		require.NoError(t, f.Close())
+	}
 }
 
 type errorPropCollector struct{}
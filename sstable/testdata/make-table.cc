@@ -81,7 +81,7 @@ class KeyCountPropertyCollectorFactory : public rocksdb::TablePropertiesCollecto
 };
 
 int write() {
-  for (int i = 0; i < 12; ++i) {
+  for (int i = 0; i < 13; ++i) {
     rocksdb::Options options;
     rocksdb::BlockBasedTableOptions table_options;
     const char* outfile;
@@ -191,6 +191,19 @@ int write() {
         table_options.whole_key_filtering = false;
         break;
 
+      case 12:
+        outfile = "h.no-compression.format_version_5.sst";
+        options.table_properties_collector_factories.emplace_back(
+            new KeyCountPropertyCollectorFactory);
+        options.compression = rocksdb::kNoCompression;
+        table_options.format_version = 5;
+        // Use small blocks and a larger index restart interval so that index
+        // entries share key prefixes and delta-encode their block handles.
+        table_options.block_size = 256;
+        table_options.index_block_restart_interval = 16;
+        table_options.whole_key_filtering = false;
+        break;
+
       default:
         continue;
     }
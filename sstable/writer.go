@@ -134,10 +134,26 @@ type Writer struct {
 	rangeDelBlock    blockWriter
 	props            Properties
 	propCollectors   []TablePropertyCollector
+	// blockPropCollectors collect properties for each data block and for the
+	// table as a whole. blockPropsBuf holds the encoded properties of the most
+	// recently finished data block, and indexValueBuf the index entry value
+	// consisting of the block's handle followed by its encoded properties.
+	blockPropCollectors []BlockPropertyCollector
+	blockPropsBuf       []byte
+	blockPropScratch    []byte
+	indexValueBuf       []byte
 	// compressedBuf is the destination buffer for compression. It is
 	// re-used over the lifetime of the writer, avoiding the allocation of a
 	// temporary buffer for each block.
 	compressedBuf []byte
+	// parallelism is the maximum number of data blocks which are compressed
+	// concurrently. pendingBlocks holds the data blocks being compressed in
+	// the order in which they were finished, pendingSize their total
+	// uncompressed size, and freePendingBlocks the blocks available for reuse.
+	parallelism       int
+	pendingBlocks     []*pendingDataBlock
+	pendingSize       uint64
+	freePendingBlocks []*pendingDataBlock
 	// filter accumulates the filter block. If populated, the filter ingests
 	// either the output of w.split (i.e. a prefix extractor) if w.split is not
 	// nil, or the full keys otherwise.
@@ -241,6 +257,11 @@ func (w *Writer) addPoint(key InternalKey, value []byte) error {
 			return err
 		}
 	}
+	for i := range w.blockPropCollectors {
+		if err := w.blockPropCollectors[i].Add(key, value); err != nil {
+			return err
+		}
+	}
 
 	w.maybeAddToFilter(key.UserKey)
 	w.block.add(key, value)
@@ -367,39 +388,153 @@ func (w *Writer) maybeFlush(key InternalKey, value []byte) error {
 		return nil
 	}
 
+	if w.parallelism > 1 {
+		if err := w.queueDataBlock(key); err != nil {
+			w.err = err
+			return w.err
+		}
+		return nil
+	}
+
 	bh, err := w.writeBlock(w.block.finish(), w.compression)
 	if err != nil {
 		w.err = err
 		return w.err
 	}
-	w.addIndexEntry(key, bh)
+	props, err := w.finishDataBlockProps()
+	if err != nil {
+		w.err = err
+		return w.err
+	}
+	w.addIndexEntry(w.indexSeparator(key), bh, props)
 	return nil
 }
 
-// addIndexEntry adds an index entry for the specified key and block handle.
-func (w *Writer) addIndexEntry(key InternalKey, bh BlockHandle) {
+// pendingDataBlock is a finished data block which is being compressed
+// concurrently with the addition of further keys to the Writer.
+type pendingDataBlock struct {
+	// sep is the index separator for the block and props its encoded block
+	// properties. They are copied into sepBuf and props as the Writer reuses
+	// the buffers they were built in.
+	sep    InternalKey
+	sepBuf []byte
+	props  []byte
+	// uncompressed is a copy of the finished block. Once done is signaled,
+	// compressed holds the data to write with the block type blockType.
+	uncompressed  []byte
+	compressed    []byte
+	compressedBuf []byte
+	blockType     byte
+	done          chan struct{}
+}
+
+// queueDataBlock finishes the current data block and starts compressing it
+// on a separate goroutine. The block is written and added to the index by
+// writePendingBlock once all of the blocks finished before it are written.
+func (w *Writer) queueDataBlock(key InternalKey) error {
+	if len(w.pendingBlocks) >= w.parallelism {
+		if err := w.writePendingBlock(); err != nil {
+			return err
+		}
+	}
+
+	var p *pendingDataBlock
+	if n := len(w.freePendingBlocks); n > 0 {
+		p = w.freePendingBlocks[n-1]
+		w.freePendingBlocks = w.freePendingBlocks[:n-1]
+	} else {
+		p = &pendingDataBlock{done: make(chan struct{}, 1)}
+	}
+	sep := w.indexSeparator(key)
+	p.sepBuf = append(p.sepBuf[:0], sep.UserKey...)
+	p.sep = InternalKey{UserKey: p.sepBuf, Trailer: sep.Trailer}
+	props, err := w.finishDataBlockProps()
+	if err != nil {
+		return err
+	}
+	p.props = append(p.props[:0], props...)
+	p.uncompressed = append(p.uncompressed[:0], w.block.finish()...)
+	w.pendingBlocks = append(w.pendingBlocks, p)
+	w.pendingSize += uint64(len(p.uncompressed))
+
+	compression := w.compression
+	go func() {
+		p.blockType, p.compressed, p.compressedBuf =
+			compressBlockIfSmaller(compression, p.uncompressed, p.compressedBuf)
+		p.done <- struct{}{}
+	}()
+	return nil
+}
+
+// writePendingBlock waits for the oldest pending data block to be compressed,
+// then writes it and adds it to the index.
+func (w *Writer) writePendingBlock() error {
+	p := w.pendingBlocks[0]
+	<-p.done
+	n := copy(w.pendingBlocks, w.pendingBlocks[1:])
+	w.pendingBlocks = w.pendingBlocks[:n]
+	w.pendingSize -= uint64(len(p.uncompressed))
+	defer func() {
+		w.freePendingBlocks = append(w.freePendingBlocks, p)
+	}()
+
+	bh, err := w.writeCompressedBlock(p.compressed, p.blockType)
+	if err != nil {
+		return err
+	}
+	w.addIndexEntry(p.sep, bh, p.props)
+	return nil
+}
+
+// finishDataBlockProps finishes the properties of the current data block for
+// each block property collector and returns their encoding.
+func (w *Writer) finishDataBlockProps() ([]byte, error) {
+	w.blockPropsBuf = w.blockPropsBuf[:0]
+	for i := range w.blockPropCollectors {
+		prop, err := w.blockPropCollectors[i].FinishDataBlock(w.blockPropScratch[:0])
+		if err != nil {
+			return nil, err
+		}
+		w.blockPropScratch = prop
+		w.blockPropsBuf = encodeBlockProperty(w.blockPropsBuf, i, prop)
+	}
+	return w.blockPropsBuf, nil
+}
+
+// indexSeparator returns the index separator between the last key in the
+// current data block and the specified key, which is the first key of the next
+// data block, or the zero key if there is no next data block.
+func (w *Writer) indexSeparator(key InternalKey) InternalKey {
+	prevKey := base.DecodeInternalKey(w.block.curKey)
+	if key.UserKey == nil && key.Trailer == 0 {
+		return prevKey.Successor(w.compare, w.successor, nil)
+	}
+	return prevKey.Separator(w.compare, w.separator, nil, key)
+}
+
+// addIndexEntry adds an index entry for the specified separator and block
+// handle, followed by the encoded properties of the block.
+func (w *Writer) addIndexEntry(sep InternalKey, bh BlockHandle, props []byte) {
 	if bh.Length == 0 {
 		// A valid blockHandle must be non-zero.
 		// In particular, it must have a non-zero length.
 		return
 	}
-	prevKey := base.DecodeInternalKey(w.block.curKey)
-	var sep InternalKey
-	if key.UserKey == nil && key.Trailer == 0 {
-		sep = prevKey.Successor(w.compare, w.successor, nil)
-	} else {
-		sep = prevKey.Separator(w.compare, w.separator, nil, key)
-	}
 	n := encodeBlockHandle(w.tmp[:], bh)
+	value := w.tmp[:n]
+	if len(props) > 0 {
+		w.indexValueBuf = append(append(w.indexValueBuf[:0], w.tmp[:n]...), props...)
+		value = w.indexValueBuf
+	}
 
 	if supportsTwoLevelIndex(w.tableFormat) &&
-		shouldFlush(sep, w.tmp[:n], &w.indexBlock, w.indexBlockSize, w.indexBlockSizeThreshold) {
+		shouldFlush(sep, value, &w.indexBlock, w.indexBlockSize, w.indexBlockSizeThreshold) {
 		// Enable two level indexes if there is more than one index block.
 		w.twoLevelIndex = true
 		w.finishIndexBlock()
 	}
 
-	w.indexBlock.add(sep, w.tmp[:n])
+	w.indexBlock.add(sep, value)
 }
 
 func shouldFlush(
@@ -441,6 +576,30 @@ func (w *Writer) finishIndexBlock() {
 	}
 }
 
+// writePartitionedFilter writes the partitions of a partitioned filter
+// followed by the top-level filter block which maps the last key of each
+// partition to the partition's block handle. It returns the handle of the
+// top-level filter block.
+func (w *Writer) writePartitionedFilter(f *partitionedFilterWriter) (BlockHandle, error) {
+	var topLevel rawBlockWriter
+	topLevel.restartInterval = 1
+	for _, p := range f.finishPartitions() {
+		bh, err := w.writeBlock(p.data, NoCompression)
+		if err != nil {
+			return BlockHandle{}, err
+		}
+		w.props.FilterSize += bh.Length
+		n := encodeBlockHandle(w.tmp[:], bh)
+		topLevel.add(InternalKey{UserKey: p.lastKey}, w.tmp[:n])
+	}
+	bh, err := w.writeBlock(topLevel.finish(), NoCompression)
+	if err != nil {
+		return BlockHandle{}, err
+	}
+	w.props.FilterSize += bh.Length
+	return bh, nil
+}
+
 func (w *Writer) writeTwoLevelIndex() (BlockHandle, error) {
 	// Add the final unfinished index.
 	w.finishIndexBlock()
@@ -469,19 +628,30 @@ func (w *Writer) writeTwoLevelIndex() (BlockHandle, error) {
 	return w.writeBlock(w.topLevelIndexBlock.finish(), w.compression)
 }
 
-func (w *Writer) writeBlock(b []byte, compression Compression) (BlockHandle, error) {
-	// Compress the buffer, discarding the result if the improvement isn't at
-	// least 12.5%.
-	blockType, compressed := compressBlock(compression, b, w.compressedBuf)
-	if blockType != noCompressionBlockType && cap(compressed) > cap(w.compressedBuf) {
-		w.compressedBuf = compressed[:cap(compressed)]
+// compressBlockIfSmaller compresses b using buf as the destination buffer. It
+// returns the block type and the data to write, discarding the compressed data
+// if the improvement isn't at least 12.5%, along with the destination buffer
+// to reuse for the next block.
+func compressBlockIfSmaller(compression Compression, b, buf []byte) (byte, []byte, []byte) {
+	blockType, compressed := compressBlock(compression, b, buf)
+	if blockType != noCompressionBlockType && cap(compressed) > cap(buf) {
+		buf = compressed[:cap(compressed)]
 	}
 	if len(compressed) < len(b)-len(b)/8 {
-		b = compressed
-	} else {
-		blockType = noCompressionBlockType
+		return blockType, compressed, buf
 	}
+	return noCompressionBlockType, b, buf
+}
 
+func (w *Writer) writeBlock(b []byte, compression Compression) (BlockHandle, error) {
+	var blockType byte
+	blockType, b, w.compressedBuf = compressBlockIfSmaller(compression, b, w.compressedBuf)
+	return w.writeCompressedBlock(b, blockType)
+}
+
+// writeCompressedBlock writes the block with the specified block type, which
+// has already been compressed, followed by the block trailer.
+func (w *Writer) writeCompressedBlock(b []byte, blockType byte) (BlockHandle, error) {
 	w.tmp[0] = blockType
 
 	// Calculate the checksum.
@@ -545,6 +715,14 @@ func (w *Writer) Close() (err error) {
 		return w.err
 	}
 
+	// Write the data blocks which are still being compressed.
+	for len(w.pendingBlocks) > 0 {
+		if err := w.writePendingBlock(); err != nil {
+			w.err = err
+			return w.err
+		}
+	}
+
 	// Finish the last data block, or force an empty data block if there
 	// aren't any data blocks at all.
 	if w.block.nEntries > 0 || w.indexBlock.nEntries == 0 {
@@ -553,7 +731,12 @@ func (w *Writer) Close() (err error) {
 			w.err = err
 			return w.err
 		}
-		w.addIndexEntry(InternalKey{}, bh)
+		props, err := w.finishDataBlockProps()
+		if err != nil {
+			w.err = err
+			return w.err
+		}
+		w.addIndexEntry(w.indexSeparator(InternalKey{}), bh, props)
 	}
 	w.props.DataSize = w.meta.Size
 
@@ -561,12 +744,18 @@ func (w *Writer) Close() (err error) {
 	var metaindex rawBlockWriter
 	metaindex.restartInterval = 1
 	if w.filter != nil {
-		b, err := w.filter.finish()
-		if err != nil {
-			w.err = err
-			return w.err
+		var bh BlockHandle
+		var err error
+		if pf, ok := w.filter.(*partitionedFilterWriter); ok && pf.partitioned() {
+			bh, err = w.writePartitionedFilter(pf)
+		} else {
+			var b []byte
+			b, err = w.filter.finish()
+			if err == nil {
+				bh, err = w.writeBlock(b, NoCompression)
+			}
+			w.props.FilterSize = bh.Length
 		}
-		bh, err := w.writeBlock(b, NoCompression)
 		if err != nil {
 			w.err = err
 			return w.err
@@ -574,7 +763,6 @@ func (w *Writer) Close() (err error) {
 		n := encodeBlockHandle(w.tmp[:], bh)
 		metaindex.add(InternalKey{UserKey: []byte(w.filter.metaName())}, w.tmp[:n])
 		w.props.FilterPolicyName = w.filter.policyName()
-		w.props.FilterSize = bh.Length
 	}
 
 	var indexBH BlockHandle
@@ -634,6 +822,16 @@ func (w *Writer) Close() (err error) {
 				return err
 			}
 		}
+		for i := range w.blockPropCollectors {
+			// The table property is prefixed with the index of the collector,
+			// which identifies the collector's properties in the index entries.
+			buf := []byte{byte(i)}
+			buf, err := w.blockPropCollectors[i].FinishTable(buf)
+			if err != nil {
+				return err
+			}
+			userProps[w.blockPropCollectors[i].Name()] = string(buf)
+		}
 		if len(userProps) > 0 {
 			w.props.UserProperties = userProps
 		}
@@ -715,7 +913,8 @@ func (w *Writer) Close() (err error) {
 // EstimatedSize returns the estimated size of the sstable being written if a
 // called to Finish() was made without adding additional keys.
 func (w *Writer) EstimatedSize() uint64 {
-	return w.meta.Size + uint64(w.block.estimatedSize()+w.indexBlock.estimatedSize())
+	return w.meta.Size + w.pendingSize +
+		uint64(w.block.estimatedSize()+w.indexBlock.estimatedSize())
 }
 
 // Metadata returns the metadata for the finished sstable. Only valid to call
@@ -767,6 +966,7 @@ func NewWriter(f writeCloseSyncer, o WriterOptions, extraOpts ...WriterOption) *
 		successor:               o.Comparer.Successor,
 		tableFormat:             o.TableFormat,
 		checksumType:            o.Checksum,
+		parallelism:             o.Parallelism,
 		cache:                   o.Cache,
 		block: blockWriter{
 			restartInterval: o.BlockRestartInterval,
@@ -796,11 +996,23 @@ func NewWriter(f writeCloseSyncer, o WriterOptions, extraOpts ...WriterOption) *
 		}
 	}
 
+	if o.DataBlockHashIndex {
+		if o.TableFormat != TableFormatPebblev1 {
+			w.err = errors.New("pebble: data block hash index requires TableFormatPebblev1")
+			return w
+		}
+		w.block.hashIndex = &hashIndexBuilder{valid: true}
+	}
+
 	w.props.PrefixExtractorName = "nullptr"
 	if o.FilterPolicy != nil {
 		switch o.FilterType {
 		case TableFilter:
-			w.filter = newTableFilterWriter(o.FilterPolicy)
+			if o.FilterBlockSize > 0 {
+				w.filter = newPartitionedFilterWriter(o.FilterPolicy, w.compare, o.FilterBlockSize)
+			} else {
+				w.filter = newTableFilterWriter(o.FilterPolicy)
+			}
 			if w.split != nil {
 				w.props.PrefixExtractorName = o.Comparer.Name
 				w.props.PrefixFiltering = true
@@ -834,6 +1046,22 @@ func NewWriter(f writeCloseSyncer, o WriterOptions, extraOpts ...WriterOption) *
 		w.props.PropertyCollectorNames = buf.String()
 	}
 
+	if len(o.BlockPropertyCollectors) > 0 {
+		if o.TableFormat != TableFormatPebblev1 {
+			w.err = errors.New("pebble: block property collectors require TableFormatPebblev1")
+			return w
+		}
+		if len(o.BlockPropertyCollectors) > maxBlockPropertyCollectors {
+			w.err = errors.Errorf("pebble: too many block property collectors: %d",
+				errors.Safe(len(o.BlockPropertyCollectors)))
+			return w
+		}
+		w.blockPropCollectors = make([]BlockPropertyCollector, len(o.BlockPropertyCollectors))
+		for i := range o.BlockPropertyCollectors {
+			w.blockPropCollectors[i] = o.BlockPropertyCollectors[i]()
+		}
+	}
+
 	// Apply the remaining WriterOptions that do not have a preApply() method.
 	for _, opt := range extraOpts {
 		if _, ok := opt.(preApply); !ok {
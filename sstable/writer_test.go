@@ -177,6 +177,68 @@ func TestWriterClearCache(t *testing.T) {
 	require.NoError(t, r.Close())
 }
 
+func TestWriterDataBlockHashIndexTableFormat(t *testing.T) {
+	// The hash index is recorded in the restart count of data blocks, which
+	// readers of other formats would misinterpret.
+	mem := vfs.NewMem()
+	for _, format := range []TableFormat{TableFormatRocksDBv2, TableFormatLevelDB} {
+		f, err := mem.Create("test")
+		require.NoError(t, err)
+		w := NewWriter(f, WriterOptions{TableFormat: format, DataBlockHashIndex: true})
+		require.Regexp(t, `requires TableFormatPebblev1`, w.Close())
+	}
+
+	f, err := mem.Create("test")
+	require.NoError(t, err)
+	w := NewWriter(f, WriterOptions{TableFormat: TableFormatPebblev1, DataBlockHashIndex: true})
+	require.NoError(t, w.Set([]byte("hello"), []byte("world")))
+	require.NoError(t, w.Close())
+}
+
+func TestWriterParallelism(t *testing.T) {
+	// A table written with parallel compression must be identical to one
+	// written with serial compression.
+	build := func(parallelism, indexBlockSize int) []byte {
+		mem := vfs.NewMem()
+		f, err := mem.Create("test")
+		require.NoError(t, err)
+		w := NewWriter(f, WriterOptions{
+			BlockSize:      512,
+			Compression:    SnappyCompression,
+			FilterPolicy:   bloom.FilterPolicy(10),
+			IndexBlockSize: indexBlockSize,
+			Parallelism:    parallelism,
+		})
+		for i := 0; i < 10000; i++ {
+			key := []byte(fmt.Sprintf("%08d", i))
+			require.NoError(t, w.Set(key, bytes.Repeat(key, i%7)))
+			if i%1000 == 0 {
+				// EstimatedSize accounts for the blocks being compressed.
+				require.LessOrEqual(t, uint64(i*8), w.EstimatedSize())
+			}
+		}
+		require.NoError(t, w.Close())
+
+		f, err = mem.Open("test")
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		_, err = buf.ReadFrom(f)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		return buf.Bytes()
+	}
+
+	for _, indexBlockSize := range []int{1 << 20, 256} {
+		expected := build(1, indexBlockSize)
+		for _, parallelism := range []int{2, 4, 16} {
+			t.Run(fmt.Sprintf("index-block-size=%d/parallelism=%d", indexBlockSize, parallelism),
+				func(t *testing.T) {
+					require.Equal(t, expected, build(parallelism, indexBlockSize))
+				})
+		}
+	}
+}
+
 type discardFile struct{}
 
 func (f discardFile) Close() error {
@@ -221,6 +283,16 @@ func BenchmarkWriter(b *testing.B) {
 				FilterPolicy:         bloom.FilterPolicy(10),
 			},
 		},
+		{
+			name: "ZstdParallel",
+			options: WriterOptions{
+				BlockRestartInterval: 16,
+				BlockSize:            32 << 10,
+				Compression:          ZstdCompression,
+				FilterPolicy:         bloom.FilterPolicy(10),
+				Parallelism:          4,
+			},
+		},
 	}
 
 	for _, bm := range benchmarks {
@@ -206,8 +206,20 @@ func (c *tableCacheShard) newIters(
 	var err error
 	if bytesIterated != nil {
 		iter, err = v.reader.NewCompactionIter(bytesIterated)
+	} else if opts != nil {
+		// NB: If the table does not intersect the filters, an empty point
+		// iterator is returned but the range deletions in the table are still
+		// returned below, as they may delete keys in lower levels.
+		iter, err = v.reader.NewIterWithOptions(&sstable.IterOptions{
+			LowerBound:           opts.LowerBound,
+			UpperBound:           opts.UpperBound,
+			BlockPropertyFilters: opts.BlockPropertyFilters,
+			Stats:                opts.stats,
+			Context:              opts.getContext(),
+			Readahead:            opts.Readahead,
+		})
 	} else {
-		iter, err = v.reader.NewIter(opts.GetLowerBound(), opts.GetUpperBound())
+		iter, err = v.reader.NewIter(nil /* lower */, nil /* upper */)
 	}
 	if err != nil {
 		c.unrefValue(v)
@@ -123,7 +123,8 @@ func (d *DB) collectTableStats() {
 	maybeCompact := false
 	for _, c := range collected {
 		c.fileMetadata.Stats = c.TableStats
-		maybeCompact = maybeCompact || c.fileMetadata.Stats.RangeDeletionsBytesEstimate > 0
+		maybeCompact = maybeCompact || c.fileMetadata.Stats.RangeDeletionsBytesEstimate > 0 ||
+			tombstoneDense(d.opts, &c.fileMetadata.Stats)
 	}
 	d.mu.tableStats.cond.Broadcast()
 	d.maybeCollectTableStats()
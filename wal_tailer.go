@@ -0,0 +1,228 @@
+// Copyright 2021 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"io"
+	"math"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/record"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// walBlockSize is the size of the blocks of the record format used by WALs.
+// Records never span a block boundary without being split into chunks, so
+// reading a WAL can resume at any block boundary.
+const walBlockSize = 32 << 10
+
+// A WALTailer reads the batches written to the WALs in a directory, in the
+// order in which they were committed. It can be used while the DB is open to
+// tail the most recent WAL, which makes it suitable for change data capture
+// and physical replication. The sequence number of each batch is available
+// from Batch.SeqNum, and its contents from Batch.Reader.
+//
+// A WAL which becomes obsolete is deleted or recycled by the DB, which can
+// cause a WALTailer which has fallen behind to miss batches. Next detects
+// missed batches from a gap in the sequence numbers of the batches it reads
+// and returns an error wrapping ErrWALGap. Configuring Options.Cleaner with a
+// cleaner which archives obsolete files, such as ArchiveCleaner, disables WAL
+// recycling and retains the obsolete WALs. A WALTailer does not read the
+// archive directory.
+//
+// A WALTailer is not safe for concurrent use.
+type WALTailer struct {
+	fs      vfs.FS
+	dirname string
+	// logNum is the file number of the current WAL and file is the open
+	// current WAL. The file is nil until the first WAL is opened.
+	logNum FileNum
+	file   vfs.File
+	// rr reads the current WAL, starting at the block boundary start. It is
+	// nil if reading needs to be restarted, which is necessary to observe
+	// records written after rr encountered the end of the WAL.
+	rr    *record.Reader
+	start int64
+	// offset is the offset in the current WAL just past the last record read.
+	offset int64
+	buf    bytes.Buffer
+	// seqNum is the sequence number expected for the next batch, or 0 if no
+	// batch has been read yet. gapBatch is the batch read after a gap in the
+	// sequence numbers was reported, to be returned by the next call to Next.
+	seqNum   uint64
+	gapBatch *Batch
+}
+
+// ErrWALGap is returned, wrapped, by WALTailer.Next when the sequence number
+// of a batch does not follow from the previous batch read. Batches may have
+// been missed because the WAL containing them was deleted or recycled before
+// they were read. Ingested sstables are also assigned sequence numbers without
+// writing a batch to the WAL. Use errors.Is(err, ErrWALGap) to check for this
+// error. Calling Next again returns the batch which followed the gap.
+var ErrWALGap = errors.New("pebble: gap in WAL sequence numbers")
+
+// NewWALTailer returns a WALTailer which reads the WALs in the specified
+// directory, starting with the oldest one. The directory is the DB's
+// Options.WALDir if set, and its data directory otherwise.
+func NewWALTailer(fs vfs.FS, dirname string) *WALTailer {
+	return &WALTailer{
+		fs:      fs,
+		dirname: dirname,
+	}
+}
+
+// Next returns the next batch written to the WALs. It returns io.EOF if all of
+// the batches written so far have been read. Calling Next again later returns
+// any batches written in the meantime. The returned batch is owned by the
+// caller and must not be committed.
+func (t *WALTailer) Next() (*Batch, error) {
+	if b := t.gapBatch; b != nil {
+		t.gapBatch = nil
+		return b, nil
+	}
+	b, err := t.next()
+	if err != nil {
+		return nil, err
+	}
+	seqNum := t.seqNum
+	t.seqNum = b.SeqNum() + uint64(b.Count())
+	if seqNum != 0 && b.SeqNum() != seqNum {
+		t.gapBatch = b
+		return nil, errors.Wrapf(ErrWALGap, "pebble: expected batch at seqnum %d, found %d",
+			errors.Safe(seqNum), errors.Safe(b.SeqNum()))
+	}
+	return b, nil
+}
+
+func (t *WALTailer) next() (*Batch, error) {
+	for {
+		if t.file == nil {
+			logNum, ok, err := t.findLog(0)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, io.EOF
+			}
+			if err := t.openLog(logNum); err != nil {
+				return nil, err
+			}
+		}
+
+		b, err := t.read()
+		if !isWALEnd(err) {
+			return b, err
+		}
+
+		// We have read all of the current WAL that was visible to rr. Look for
+		// a newer WAL before reading the current WAL again from the last record
+		// read. A newer WAL is only created after the current WAL is closed, so
+		// if one exists, the current WAL is complete once it has been read
+		// again.
+		nextLogNum, ok, err := t.findLog(t.logNum)
+		if err != nil {
+			return nil, err
+		}
+		t.rr = nil
+		b, err = t.read()
+		if !isWALEnd(err) {
+			return b, err
+		}
+		t.rr = nil
+		if !ok {
+			return nil, io.EOF
+		}
+		if err := t.openLog(nextLogNum); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Close closes the WALTailer.
+func (t *WALTailer) Close() error {
+	var err error
+	if t.file != nil {
+		err = t.file.Close()
+		t.file = nil
+	}
+	t.rr = nil
+	return err
+}
+
+// isWALEnd returns true if the error marks the end of the records written to
+// a WAL so far. Besides a clean EOF, the tail of a WAL being written may be
+// zeroed due to preallocation, contain a partially written record, or
+// contain records from a previous incarnation of a recycled WAL.
+func isWALEnd(err error) bool {
+	return err == io.EOF || record.IsInvalidRecord(err)
+}
+
+// findLog returns the file number of the oldest WAL in the directory newer
+// than the specified one.
+func (t *WALTailer) findLog(after FileNum) (_ FileNum, ok bool, _ error) {
+	ls, err := t.fs.List(t.dirname)
+	if err != nil {
+		return 0, false, err
+	}
+	var logNum FileNum
+	for _, filename := range ls {
+		ft, fn, ok := base.ParseFilename(t.fs, filename)
+		if ok && ft == fileTypeLog && fn > after && (logNum == 0 || fn < logNum) {
+			logNum = fn
+		}
+	}
+	return logNum, logNum != 0, nil
+}
+
+func (t *WALTailer) openLog(logNum FileNum) error {
+	if err := t.Close(); err != nil {
+		return err
+	}
+	file, err := t.fs.Open(base.MakeFilename(t.fs, t.dirname, fileTypeLog, logNum))
+	if err != nil {
+		return err
+	}
+	t.logNum, t.file, t.offset = logNum, file, 0
+	return nil
+}
+
+// read returns the next batch in the current WAL.
+func (t *WALTailer) read() (*Batch, error) {
+	if t.rr == nil {
+		// Resume reading at the start of the block containing the end of the
+		// last record read. Records in that block which have already been read
+		// are skipped below.
+		t.start = t.offset &^ (walBlockSize - 1)
+		t.rr = record.NewReader(io.NewSectionReader(t.file, t.start, math.MaxInt64-t.start), t.logNum)
+	}
+	for {
+		r, err := t.rr.Next()
+		if err != nil {
+			return nil, err
+		}
+		t.buf.Reset()
+		if _, err := io.Copy(&t.buf, r); err != nil {
+			return nil, err
+		}
+		end := t.start + t.rr.Offset()
+		if end <= t.offset {
+			continue
+		}
+		t.offset = end
+
+		if t.buf.Len() < batchHeaderLen {
+			filename := base.MakeFilename(t.fs, t.dirname, fileTypeLog, t.logNum)
+			return nil, base.CorruptionErrorf("pebble: corrupt log file %q (num %s)",
+				filename, errors.Safe(t.logNum))
+		}
+		b := &Batch{}
+		if err := b.SetRepr(append([]byte(nil), t.buf.Bytes()...)); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+}
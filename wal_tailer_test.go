@@ -0,0 +1,111 @@
+// Copyright 2021 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWALTailer(t *testing.T) {
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{
+		FS:      mem,
+		Cleaner: ArchiveCleaner{},
+	})
+	require.NoError(t, err)
+
+	tailer := NewWALTailer(mem, "")
+	defer tailer.Close()
+
+	// readAll reads the batches written since the last call, and returns the
+	// keys they contain along with their sequence numbers.
+	readAll := func() []string {
+		var keys []string
+		for {
+			b, err := tailer.Next()
+			if err == io.EOF {
+				return keys
+			}
+			require.NoError(t, err)
+			r := b.Reader()
+			for seqNum := b.SeqNum(); ; seqNum++ {
+				_, ukey, _, ok := r.Next()
+				if !ok {
+					break
+				}
+				keys = append(keys, fmt.Sprintf("%s#%d", ukey, seqNum))
+			}
+		}
+	}
+
+	require.Empty(t, readAll())
+
+	// The writes are synced so that they are visible to the tailer.
+	require.NoError(t, d.Set([]byte("a"), nil, Sync))
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("b"), nil, nil))
+	require.NoError(t, b.Set([]byte("c"), nil, nil))
+	require.NoError(t, b.Commit(Sync))
+	require.Equal(t, []string{"a#1", "b#2", "c#3"}, readAll())
+	require.Empty(t, readAll())
+
+	// Batches larger than a WAL block and batches written to a new WAL after
+	// a flush are read.
+	require.NoError(t, d.Set([]byte("d"), []byte(strings.Repeat("x", 100<<10)), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("e"), nil, Sync))
+	require.Equal(t, []string{"d#4", "e#5"}, readAll())
+
+	require.NoError(t, d.Close())
+}
+
+func TestWALTailerGap(t *testing.T) {
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{FS: mem})
+	require.NoError(t, err)
+
+	tailer := NewWALTailer(mem, "")
+	defer tailer.Close()
+
+	next := func() string {
+		b, err := tailer.Next()
+		if err != nil {
+			return err.Error()
+		}
+		r := b.Reader()
+		_, ukey, _, _ := r.Next()
+		return fmt.Sprintf("%s#%d", ukey, b.SeqNum())
+	}
+
+	require.NoError(t, d.Set([]byte("a"), nil, Sync))
+	require.Equal(t, "a#1", next())
+
+	// The WAL being read by the tailer becomes obsolete and is recycled before
+	// the tailer reads "b".
+	require.NoError(t, d.Set([]byte("b"), nil, Sync))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("c"), nil, Sync))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("d"), nil, Sync))
+
+	err = func() error {
+		_, err := tailer.Next()
+		return err
+	}()
+	require.True(t, errors.Is(err, ErrWALGap), "%v", err)
+	require.Regexp(t, "expected batch at seqnum 2, found 3", err)
+	require.Equal(t, "c#3", next())
+	require.Equal(t, "d#4", next())
+	require.Equal(t, io.EOF.Error(), next())
+
+	require.NoError(t, d.Close())
+}